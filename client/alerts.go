@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"price-alert-system/models"
+)
+
+// Message is a rendered notification.
+type Message struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// filterQuery encodes the filter as the query parameters of listing and
+// exporting alerts
+func filterQuery(filter *models.AlertFilter) url.Values {
+	q := url.Values{}
+	if filter == nil {
+		return q
+	}
+	setInt(q, "user_id", filter.UserID)
+	setInt(q, "team_id", filter.TeamID)
+	setString(q, "symbol", filter.Symbol)
+	setString(q, "indicator", filter.Indicator)
+	setString(q, "status", strings.Join(filter.Statuses, ","))
+	if filter.CreatedAfter != nil {
+		q.Set("created_after", filter.CreatedAfter.Format(time.RFC3339))
+	}
+	if filter.CreatedBefore != nil {
+		q.Set("created_before", filter.CreatedBefore.Format(time.RFC3339))
+	}
+	return q
+}
+
+// ListAlerts returns a page of the alerts matching the filter. Pass the
+// page's NextCursor as the filter's Cursor to get the next one.
+func (c *Client) ListAlerts(ctx context.Context, filter *models.AlertFilter) (*models.AlertPage, error) {
+	q := filterQuery(filter)
+	if filter != nil {
+		setString(q, "sort", filter.Sort)
+		setString(q, "order", filter.Order)
+		setString(q, "cursor", filter.Cursor)
+		setInt(q, "limit", filter.Limit)
+	}
+	page := new(models.AlertPage)
+	return page, c.do(ctx, &request{method: http.MethodGet, path: "/alerts", query: q}, page)
+}
+
+// CreateAlert creates an alert. Retrying with the same non-empty
+// idempotencyKey returns the first response instead of creating it again.
+func (c *Client) CreateAlert(ctx context.Context, alert *models.AlertRequest, idempotencyKey string) (*models.Alert, error) {
+	created := new(models.Alert)
+	r := &request{method: http.MethodPost, path: "/alerts", header: idempotencyHeader(idempotencyKey), body: alert}
+	return created, c.do(ctx, r, created)
+}
+
+// CreateAlerts creates up to 500 alerts, all or none.
+func (c *Client) CreateAlerts(ctx context.Context, alerts []*models.AlertRequest, idempotencyKey string) ([]*models.Alert, error) {
+	body := struct {
+		Alerts []*models.AlertRequest `json:"alerts"`
+	}{alerts}
+	r := &request{method: http.MethodPost, path: "/alerts/bulk", header: idempotencyHeader(idempotencyKey), body: body}
+	return c.bulkCreate(ctx, r)
+}
+
+// ImportAlertsCSV creates the alerts of a CSV export, all or none.
+func (c *Client) ImportAlertsCSV(ctx context.Context, csv io.Reader, idempotencyKey string) ([]*models.Alert, error) {
+	r := &request{method: http.MethodPost, path: "/alerts/bulk", header: idempotencyHeader(idempotencyKey), body: csv, contentType: "text/csv"}
+	return c.bulkCreate(ctx, r)
+}
+
+func (c *Client) bulkCreate(ctx context.Context, r *request) ([]*models.Alert, error) {
+	var created struct {
+		Alerts []*models.Alert `json:"alerts"`
+	}
+	if err := c.do(ctx, r, &created); err != nil {
+		return nil, err
+	}
+	return created.Alerts, nil
+}
+
+// ExportAlerts returns the definitions of the alerts matching the filter,
+// which CreateAlerts creates again. Paging fields are ignored.
+func (c *Client) ExportAlerts(ctx context.Context, filter *models.AlertFilter) ([]*models.AlertRequest, error) {
+	var exported struct {
+		Alerts []*models.AlertRequest `json:"alerts"`
+	}
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/alerts/export", query: filterQuery(filter)}, &exported); err != nil {
+		return nil, err
+	}
+	return exported.Alerts, nil
+}
+
+// ExportAlertsCSV returns the definitions of the alerts matching the filter
+// as CSV, which ImportAlertsCSV creates again.
+func (c *Client) ExportAlertsCSV(ctx context.Context, filter *models.AlertFilter) ([]byte, error) {
+	q := filterQuery(filter)
+	q.Set("format", "csv")
+	return c.read(ctx, &request{method: http.MethodGet, path: "/alerts/export", query: q})
+}
+
+// BacktestAlert evaluates an alert definition on historical klines.
+func (c *Client) BacktestAlert(ctx context.Context, req *models.BacktestRequest) (*models.BacktestResult, error) {
+	result := new(models.BacktestResult)
+	return result, c.do(ctx, &request{method: http.MethodPost, path: "/alerts/backtest", body: req}, result)
+}
+
+func (c *Client) GetAlert(ctx context.Context, id int) (*models.Alert, error) {
+	return c.alert(ctx, http.MethodGet, fmt.Sprintf("/alerts/%d", id), nil)
+}
+
+// UpdateAlert changes the fields of an alert that are set in update.
+func (c *Client) UpdateAlert(ctx context.Context, id int, update *models.AlertUpdate) (*models.Alert, error) {
+	return c.alert(ctx, http.MethodPatch, fmt.Sprintf("/alerts/%d", id), update)
+}
+
+func (c *Client) DeleteAlert(ctx context.Context, id int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/alerts/%d", id)}, nil)
+}
+
+func (c *Client) PauseAlert(ctx context.Context, id int) (*models.Alert, error) {
+	return c.alert(ctx, http.MethodPost, fmt.Sprintf("/alerts/%d/pause", id), nil)
+}
+
+func (c *Client) ResumeAlert(ctx context.Context, id int) (*models.Alert, error) {
+	return c.alert(ctx, http.MethodPost, fmt.Sprintf("/alerts/%d/resume", id), nil)
+}
+
+func (c *Client) alert(ctx context.Context, method, path string, body interface{}) (*models.Alert, error) {
+	alert := new(models.Alert)
+	return alert, c.do(ctx, &request{method: method, path: path, body: body}, alert)
+}
+
+// GetDeliveries returns the notifications of an alert per channel.
+func (c *Client) GetDeliveries(ctx context.Context, alertID int) ([]*models.Delivery, error) {
+	var deliveries []*models.Delivery
+	return deliveries, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/alerts/%d/deliveries", alertID)}, &deliveries)
+}
+
+// RetryDelivery sends a dead-lettered delivery again.
+func (c *Client) RetryDelivery(ctx context.Context, alertID int, deliveryID int64) error {
+	path := fmt.Sprintf("/alerts/%d/deliveries/%d/retry", alertID, deliveryID)
+	return c.do(ctx, &request{method: http.MethodPost, path: path}, nil)
+}
+
+// PreviewNotification renders what the alert would send on channel (email
+// if empty), with a subject template if not empty.
+func (c *Client) PreviewNotification(ctx context.Context, alertID int, channel, subject string) (*Message, error) {
+	q := url.Values{}
+	setString(q, "channel", channel)
+	setString(q, "subject", subject)
+	msg := new(Message)
+	return msg, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/alerts/%d/preview", alertID), query: q}, msg)
+}
+
+// PreviewChart returns the PNG chart a notification of the alert would carry.
+func (c *Client) PreviewChart(ctx context.Context, alertID int) ([]byte, error) {
+	return c.read(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/alerts/%d/chart", alertID)})
+}
+
+// read returns the raw body of a response
+func (c *Client) read(ctx context.Context, r *request) ([]byte, error) {
+	body, err := c.send(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
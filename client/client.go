@@ -0,0 +1,175 @@
+// Package client is a typed Go client of the price alert system's HTTP API,
+// as described by its OpenAPI specification at /openapi.json. Requests and
+// responses use the types of the models package.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the API with an API key or JWT. It is safe for concurrent
+// use.
+type Client struct {
+	baseURL string
+	token   string
+	// HTTPClient sends the requests; http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// New returns a client of the API at baseURL, e.g. http://localhost:3030,
+// authenticating with an API key or JWT.
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+	}
+}
+
+// FieldError is the problem with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is an error response of the API.
+type APIError struct {
+	StatusCode int
+	// Code is the machine readable code, e.g. "not_found" or
+	// "validation_failed"
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	for _, d := range e.Details {
+		msg += fmt.Sprintf("; %s %s", d.Field, d.Message)
+	}
+	return msg
+}
+
+// request describes a call of the API
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	// body is encoded as JSON unless it is an io.Reader, which is sent as
+	// is with contentType
+	body        interface{}
+	contentType string
+}
+
+// do sends a request and decodes the JSON response into out, if not nil.
+func (c *Client) do(ctx context.Context, r *request, out interface{}) error {
+	body, err := c.send(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding %s %s response: %v", r.method, r.path, err)
+	}
+	return nil
+}
+
+// send sends a request and returns the body of a successful response.
+func (c *Client) send(ctx context.Context, r *request) (io.ReadCloser, error) {
+	var body io.Reader
+	contentType := r.contentType
+	switch b := r.body.(type) {
+	case nil:
+	case io.Reader:
+		body = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	u := c.baseURL + r.path
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// responseError reads the error envelope of a response
+func responseError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var envelope struct {
+		Error *APIError `json:"error"`
+	}
+	envelope.Error = apiErr
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, &envelope); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	return apiErr
+}
+
+// idempotencyHeader passes an Idempotency-Key, if set
+func idempotencyHeader(key string) http.Header {
+	if key == "" {
+		return nil
+	}
+	return http.Header{"Idempotency-Key": {key}}
+}
+
+// setInt adds a query parameter if v is not zero
+func setInt(q url.Values, name string, v int) {
+	if v != 0 {
+		q.Set(name, fmt.Sprint(v))
+	}
+}
+
+// setString adds a query parameter if v is not empty
+func setString(q url.Values, name, v string) {
+	if v != "" {
+		q.Set(name, v)
+	}
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"price-alert-system/models"
+)
+
+// ListSymbols returns the state of every tracked symbol's live data.
+func (c *Client) ListSymbols(ctx context.Context) ([]*models.SymbolStatus, error) {
+	var symbols []*models.SymbolStatus
+	return symbols, c.do(ctx, &request{method: http.MethodGet, path: "/symbols"}, &symbols)
+}
+
+// GetPrice returns the latest traded price of a symbol.
+func (c *Client) GetPrice(ctx context.Context, symbol string) (*models.SymbolPrice, error) {
+	price := new(models.SymbolPrice)
+	return price, c.do(ctx, &request{method: http.MethodGet, path: "/symbols/" + url.PathEscape(symbol) + "/price"}, price)
+}
+
+// GetKlines returns the last limit klines of a symbol (100 if zero): the
+// live ones if interval is empty, otherwise the exchange's of interval.
+func (c *Client) GetKlines(ctx context.Context, symbol, interval string, limit int) (*models.SymbolKlines, error) {
+	q := url.Values{}
+	setString(q, "interval", interval)
+	setInt(q, "limit", limit)
+	klines := new(models.SymbolKlines)
+	return klines, c.do(ctx, &request{method: http.MethodGet, path: "/symbols/" + url.PathEscape(symbol) + "/klines", query: q}, klines)
+}
+
+// GetIndicators returns the indicators of a symbol, live if interval is
+// empty. name selects one, and params overrides its periods, e.g. "7" for
+// RSI.
+func (c *Client) GetIndicators(ctx context.Context, symbol, interval, name, params string) (*models.SymbolIndicators, error) {
+	q := url.Values{}
+	setString(q, "interval", interval)
+	setString(q, "name", name)
+	setString(q, "params", params)
+	indicators := new(models.SymbolIndicators)
+	return indicators, c.do(ctx, &request{method: http.MethodGet, path: "/symbols/" + url.PathEscape(symbol) + "/indicators", query: q}, indicators)
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"price-alert-system/models"
+)
+
+// CreateTeam creates a team owned by the caller, or with the admin key by
+// userID.
+func (c *Client) CreateTeam(ctx context.Context, name string, userID int) (*models.Team, error) {
+	body := struct {
+		Name   string `json:"name"`
+		UserID int    `json:"user_id,omitempty"`
+	}{name, userID}
+	team := new(models.Team)
+	return team, c.do(ctx, &request{method: http.MethodPost, path: "/teams", body: body}, team)
+}
+
+// ListTeams returns the caller's teams.
+func (c *Client) ListTeams(ctx context.Context) ([]*models.Team, error) {
+	var teams []*models.Team
+	return teams, c.do(ctx, &request{method: http.MethodGet, path: "/teams"}, &teams)
+}
+
+// GetTeam returns a team with its members.
+func (c *Client) GetTeam(ctx context.Context, id int) (*models.Team, error) {
+	team := new(models.Team)
+	return team, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/teams/%d", id)}, team)
+}
+
+// DeleteTeam deletes a team and its alerts.
+func (c *Client) DeleteTeam(ctx context.Context, id int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/teams/%d", id)}, nil)
+}
+
+// SetTeamMember adds a user to a team or changes their role: "owner",
+// "editor" or "viewer".
+func (c *Client) SetTeamMember(ctx context.Context, teamID, userID int, role string) (*models.TeamMember, error) {
+	path := fmt.Sprintf("/teams/%d/members/%d", teamID, userID)
+	member := new(models.TeamMember)
+	return member, c.do(ctx, &request{method: http.MethodPut, path: path, body: map[string]string{"role": role}}, member)
+}
+
+func (c *Client) RemoveTeamMember(ctx context.Context, teamID, userID int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/teams/%d/members/%d", teamID, userID)}, nil)
+}
+
+// GetTeamRoutes returns the contacts the team's alerts are delivered to.
+func (c *Client) GetTeamRoutes(ctx context.Context, teamID int) ([]*models.TeamRoute, error) {
+	var routes []*models.TeamRoute
+	return routes, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/teams/%d/routes", teamID)}, &routes)
+}
+
+// AddTeamRoute delivers the team's alerts to one of the caller's contacts.
+func (c *Client) AddTeamRoute(ctx context.Context, teamID, contactID int) (*models.TeamRoute, error) {
+	body := map[string]int{"contact_id": contactID}
+	route := new(models.TeamRoute)
+	return route, c.do(ctx, &request{method: http.MethodPost, path: fmt.Sprintf("/teams/%d/routes", teamID), body: body}, route)
+}
+
+func (c *Client) DeleteTeamRoute(ctx context.Context, teamID, id int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/teams/%d/routes/%d", teamID, id)}, nil)
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"price-alert-system/models"
+)
+
+// ListChannels returns the notification channels of the service.
+func (c *Client) ListChannels(ctx context.Context) ([]string, error) {
+	var list struct {
+		Channels []string `json:"channels"`
+	}
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/channels"}, &list); err != nil {
+		return nil, err
+	}
+	return list.Channels, nil
+}
+
+// CreateAPIKey issues an API key for the user. The key is only returned
+// here.
+func (c *Client) CreateAPIKey(ctx context.Context, userID int, name string) (*models.APIKey, string, error) {
+	created := struct {
+		*models.APIKey
+		Key string `json:"key"`
+	}{APIKey: new(models.APIKey)}
+	body := map[string]string{"name": name}
+	if err := c.do(ctx, &request{method: http.MethodPost, path: fmt.Sprintf("/users/%d/api-keys", userID), body: body}, &created); err != nil {
+		return nil, "", err
+	}
+	return created.APIKey, created.Key, nil
+}
+
+func (c *Client) GetAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	return keys, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/users/%d/api-keys", userID)}, &keys)
+}
+
+func (c *Client) DeleteAPIKey(ctx context.Context, userID, id int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/users/%d/api-keys/%d", userID, id)}, nil)
+}
+
+func (c *Client) GetUserChannels(ctx context.Context, userID int) ([]*models.UserChannel, error) {
+	var channels []*models.UserChannel
+	return channels, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/users/%d/channels", userID)}, &channels)
+}
+
+// SetUserChannel enables or disables a channel for the user.
+func (c *Client) SetUserChannel(ctx context.Context, userID int, channel string, enabled bool) (*models.UserChannel, error) {
+	path := fmt.Sprintf("/users/%d/channels/%s", userID, url.PathEscape(channel))
+	uc := new(models.UserChannel)
+	return uc, c.do(ctx, &request{method: http.MethodPut, path: path, body: map[string]bool{"enabled": enabled}}, uc)
+}
+
+func (c *Client) DeleteUserChannel(ctx context.Context, userID int, channel string) error {
+	path := fmt.Sprintf("/users/%d/channels/%s", userID, url.PathEscape(channel))
+	return c.do(ctx, &request{method: http.MethodDelete, path: path}, nil)
+}
+
+// CreateContact adds an address of the user on a channel. Email addresses
+// are sent a verification link.
+func (c *Client) CreateContact(ctx context.Context, userID int, channel, address string) (*models.Contact, error) {
+	body := map[string]string{"channel": channel, "address": address}
+	contact := new(models.Contact)
+	return contact, c.do(ctx, &request{method: http.MethodPost, path: fmt.Sprintf("/users/%d/contacts", userID), body: body}, contact)
+}
+
+func (c *Client) GetContacts(ctx context.Context, userID int) ([]*models.Contact, error) {
+	var contacts []*models.Contact
+	return contacts, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/users/%d/contacts", userID)}, &contacts)
+}
+
+func (c *Client) DeleteContact(ctx context.Context, userID, id int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/users/%d/contacts/%d", userID, id)}, nil)
+}
+
+// ResendVerification sends the verification of a contact again.
+func (c *Client) ResendVerification(ctx context.Context, userID, id int) error {
+	path := fmt.Sprintf("/users/%d/contacts/%d/verification", userID, id)
+	return c.do(ctx, &request{method: http.MethodPost, path: path}, nil)
+}
+
+// VerifyContact verifies a contact with the token of its verification link.
+func (c *Client) VerifyContact(ctx context.Context, token string) (*models.Contact, error) {
+	contact := new(models.Contact)
+	return contact, c.do(ctx, &request{method: http.MethodGet, path: "/contacts/verify", query: url.Values{"token": {token}}}, contact)
+}
+
+// CreateTelegramLink issues a code linking a Telegram chat to the user.
+func (c *Client) CreateTelegramLink(ctx context.Context, userID int) (*models.TelegramLink, error) {
+	link := new(models.TelegramLink)
+	return link, c.do(ctx, &request{method: http.MethodPost, path: fmt.Sprintf("/users/%d/telegram/link", userID)}, link)
+}
+
+// GetSuppressed returns the user's latest suppressed notifications, at most
+// limit (100 if zero).
+func (c *Client) GetSuppressed(ctx context.Context, userID, limit int) ([]*models.Delivery, error) {
+	q := url.Values{}
+	setInt(q, "limit", limit)
+	var deliveries []*models.Delivery
+	return deliveries, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/users/%d/suppressed", userID), query: q}, &deliveries)
+}
+
+func (c *Client) GetPreferences(ctx context.Context, userID int) (*models.Preferences, error) {
+	prefs := new(models.Preferences)
+	return prefs, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/users/%d/preferences", userID)}, prefs)
+}
+
+func (c *Client) SetPreferences(ctx context.Context, userID int, prefs *models.Preferences) (*models.Preferences, error) {
+	saved := new(models.Preferences)
+	return saved, c.do(ctx, &request{method: http.MethodPut, path: fmt.Sprintf("/users/%d/preferences", userID), body: prefs}, saved)
+}
+
+// GetSubject returns the user's email subject template.
+func (c *Client) GetSubject(ctx context.Context, userID int) (string, error) {
+	var subject struct {
+		Subject string `json:"subject"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/users/%d/subject", userID)}, &subject)
+	return subject.Subject, err
+}
+
+func (c *Client) SetSubject(ctx context.Context, userID int, subject string) error {
+	body := map[string]string{"subject": subject}
+	return c.do(ctx, &request{method: http.MethodPut, path: fmt.Sprintf("/users/%d/subject", userID), body: body}, nil)
+}
+
+// DeleteSubject resets the user's email subject template to the default.
+func (c *Client) DeleteSubject(ctx context.Context, userID int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/users/%d/subject", userID)}, nil)
+}
+
+// CreateWebhook adds a URL receiving signed notifications. The returned
+// webhook carries its secret, which is only returned here.
+func (c *Client) CreateWebhook(ctx context.Context, userID int, hook *models.Webhook) (*models.Webhook, error) {
+	created := new(models.Webhook)
+	return created, c.do(ctx, &request{method: http.MethodPost, path: fmt.Sprintf("/users/%d/webhooks", userID), body: hook}, created)
+}
+
+func (c *Client) GetWebhooks(ctx context.Context, userID int) ([]*models.Webhook, error) {
+	var hooks []*models.Webhook
+	return hooks, c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/users/%d/webhooks", userID)}, &hooks)
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, userID, id int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/users/%d/webhooks/%d", userID, id)}, nil)
+}
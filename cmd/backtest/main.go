@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"price-alert-system/config"
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+func main() {
+	symbol := flag.String("symbol", "BTCUSDT", "Symbol to backtest")
+	interval := flag.String("interval", "1m", "Kline interval")
+	indicator := flag.String("indicator", "RSI", "Indicator (RSI or MACD)")
+	direction := flag.String("direction", "UP", "Direction (UP or DOWN)")
+	value := flag.Float64("value", 0, "Threshold value")
+	start := flag.String("start", "", "Range start (RFC3339), defaults to 24h before end")
+	end := flag.String("end", "", "Range end (RFC3339), defaults to now")
+	asJSON := flag.Bool("json", false, "Print the result as JSON")
+	flag.Parse()
+
+	req := &models.BacktestRequest{
+		Symbol:    *symbol,
+		Interval:  *interval,
+		Indicator: *indicator,
+		Direction: *direction,
+		Value:     *value,
+		EndTime:   time.Now(),
+	}
+
+	var err error
+	if *end != "" {
+		if req.EndTime, err = time.Parse(time.RFC3339, *end); err != nil {
+			log.Fatalf("Invalid end time: %v", err)
+		}
+	}
+	req.StartTime = req.EndTime.Add(-24 * time.Hour)
+	if *start != "" {
+		if req.StartTime, err = time.Parse(time.RFC3339, *start); err != nil {
+			log.Fatalf("Invalid start time: %v", err)
+		}
+	}
+
+	cfg := config.NewConfig()
+	if err := cfg.Binance.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	binanceService, err := services.NewBinanceService(cfg.Binance)
+	if err != nil {
+		log.Fatalf("Failed to initialize Binance service: %v", err)
+	}
+	backtestService := services.NewBacktestService(binanceService)
+	result, err := backtestService.Backtest(req)
+	if err != nil {
+		log.Fatalf("Backtest failed: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return
+	}
+
+	fmt.Printf("%s %s %s %s %g: %d triggers over %d klines\n",
+		result.Symbol, result.Interval, result.Indicator, result.Direction, result.Value, len(result.Triggers), result.Klines)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tVALUE\tPRICE")
+	for _, trigger := range result.Triggers {
+		fmt.Fprintf(w, "%s\t%f\t%f\n", trigger.Time.Format(time.RFC3339), trigger.Value, trigger.Price)
+	}
+	w.Flush()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"price-alert-system/simulator"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "Listen address")
+	symbol := flag.String("symbol", "BTCUSDT", "Simulated symbol")
+	mode := flag.String("path", "random", "Price path: random, step or replay")
+	speed := flag.Float64("speed", 1, "Simulated time per real time, 0 emits trades without waiting")
+	interval := flag.Duration("interval", time.Second, "Simulated time between trades (random and step paths)")
+	startPrice := flag.Float64("start-price", 60000, "Starting price (random path)")
+	volatility := flag.Float64("volatility", 0.001, "Per trade volatility (random path)")
+	count := flag.Int("count", 86400, "Number of trades (random path)")
+	seed := flag.Int64("seed", 1, "Random seed (random path)")
+	steps := flag.String("steps", "", "Comma separated price:duration steps, e.g. 60000:1m,58000:30s (step path)")
+	files := flag.String("files", "", "Comma separated recordings (replay path)")
+	flag.Parse()
+
+	var path simulator.PricePath
+	switch *mode {
+	case "random":
+		path = simulator.NewRandomWalk(*startPrice, *volatility, *interval, *count, *seed)
+	case "step":
+		parsed, err := parseSteps(*steps)
+		if err != nil {
+			log.Fatalf("Invalid steps: %v", err)
+		}
+		path = simulator.NewStepPath(*interval, parsed...)
+	case "replay":
+		replay, err := simulator.NewReplayPath(strings.Split(*files, ",")...)
+		if err != nil {
+			log.Fatalf("Failed to open recordings: %v", err)
+		}
+		path = replay
+	default:
+		log.Fatalf("Unknown path: %s", *mode)
+	}
+
+	server := simulator.NewServer(path, simulator.Options{Symbol: *symbol, Speed: *speed})
+	server.Start()
+	go func() {
+		<-server.Finished()
+		log.Println("Price path finished")
+	}()
+
+	log.Printf("Simulating %s on %s (BINANCE_BASE_URL=http://localhost%s BINANCE_WS_URL=ws://localhost%s BINANCE_SYMBOLS=%s)",
+		*symbol, *addr, *addr, *addr, strings.ToUpper(*symbol))
+	log.Fatal(http.ListenAndServe(*addr, server.Handler()))
+}
+
+func parseSteps(value string) ([]simulator.Step, error) {
+	var steps []simulator.Step
+	for _, item := range strings.Split(value, ",") {
+		priceStr, durationStr, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return nil, fmt.Errorf("step %q is not price:duration", item)
+		}
+		price, err := strconv.ParseFloat(priceStr, 64)
+		if err != nil {
+			return nil, err
+		}
+		duration, err := time.ParseDuration(durationStr)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, simulator.Step{Price: price, Duration: duration})
+	}
+	return steps, nil
+}
@@ -1,13 +1,513 @@
 package config
 
-import "os"
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Config struct {
 	DatabaseURL string
+	// PublicURL is where users reach the API, used in links sent to them
+	PublicURL string
+
+	// Binance is the spot market data provider
+	Binance ProviderConfig
+	// Futures is the optional USDⓈ-M futures market data provider
+	Futures FuturesConfig
+
+	SMTP          SMTPConfig
+	Notifications NotificationConfig
+	Outbox        OutboxConfig
+	RateLimit     RateLimitConfig
+	Stream        StreamConfig
+	Auth          AuthConfig
+
+	// IdempotencyRetention is how long the responses of requests with an
+	// Idempotency-Key are kept for retries
+	IdempotencyRetention time.Duration
+
+	// RecordFile, when set, receives every raw market data message as gzip NDJSON
+	RecordFile string
+	// ReplayFiles replaces the live Binance stream with recorded files
+	ReplayFiles []string
+	// ReplaySpeed scales recorded time: 1 is real time, 0 is as fast as possible
+	ReplaySpeed float64
+
+	// envErrors are the variables that could not be parsed
+	envErrors []error
+}
+
+type SMTPConfig struct {
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	FromEmail string
+}
+
+type NotificationConfig struct {
+	// DefaultChannels are used for alerts and users without channels of their own
+	DefaultChannels  []string
+	TelegramAPIURL   string
+	TelegramBotToken string
+	// TelegramBot answers chat commands by polling for updates; only one
+	// instance per bot token may poll
+	TelegramBot bool
+	// SlackBotToken lets the slack channel post to channel IDs and upload charts
+	SlackAPIURL   string
+	SlackBotToken string
+	// SlackSigningSecret and DiscordPublicKey (hex) verify the interaction
+	// requests of message buttons; without them the buttons do nothing
+	SlackSigningSecret string
+	DiscordPublicKey   string
+	// InteractionSecret signs the values of message buttons, so that
+	// interactions only act on the alerts their messages were sent for
+	InteractionSecret string
+	// SnoozeDuration is how long the snooze button pauses an alert
+	SnoozeDuration time.Duration
+	// SMSGatewayURL enables the sms channel
+	SMSGatewayURL   string
+	SMSGatewayToken string
+}
+
+// OutboxConfig controls notification delivery retries.
+type OutboxConfig struct {
+	MaxAttempts int
+	// BaseDelay before the first retry, doubling with every further attempt
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// StreamConfig controls the real-time alert stream.
+type StreamConfig struct {
+	// BufferSize is the number of events buffered per subscriber
+	BufferSize int
+}
+
+// AuthConfig controls how API requests are authenticated. API keys always
+// work; JWTs are accepted if a secret or JWKS file is set.
+type AuthConfig struct {
+	// JWTSecret verifies HS256 tokens
+	JWTSecret string
+	// JWKSFile holds the RSA keys that verify RS256 tokens
+	JWKSFile string
+	// JWTIssuer and JWTAudience, if set, must match the iss and aud claims
+	JWTIssuer   string
+	JWTAudience string
+	// AdminKey acts as any user
+	AdminKey string
+}
+
+// RateLimitConfig bounds the notifications sent per user and per user and
+// channel with token buckets. A rate of zero disables the limit.
+type RateLimitConfig struct {
+	UserPerMinute    int
+	UserBurst        int
+	ChannelPerMinute int
+	ChannelBurst     int
+}
+
+// ProviderConfig describes how to reach a market data provider.
+type ProviderConfig struct {
+	Name string
+	// Endpoint is the preset the URLs default to, e.g. spot, us or testnet
+	Endpoint string
+	// BaseURL of the REST API, e.g. https://api.binance.com
+	BaseURL string
+	// WSURL is the stream host without a path, e.g. wss://stream.binance.com:9443
+	WSURL string
+	// StreamType is trade, aggTrade or kline for spot, markPrice or
+	// markPrice@1s for futures
+	StreamType string
+	// KlineInterval is used when StreamType is kline
+	KlineInterval string
+	Symbols       []string
+	// ProxyURL routes REST and stream connections through an HTTP(S) or SOCKS5 proxy
+	ProxyURL string
+	TLS      TLSConfig
+}
+
+type FuturesConfig struct {
+	Enabled  bool
+	Provider ProviderConfig
+	// OpenInterestPollInterval is how often open interest is fetched
+	OpenInterestPollInterval time.Duration
+	// OpenInterestWindow is the lookback of the OPEN_INTEREST_CHANGE indicator
+	OpenInterestWindow time.Duration
+}
+
+type TLSConfig struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots
+	CAFile             string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+type endpointPreset struct {
+	baseURL string
+	wsURL   string
+}
+
+var providerPresets = map[string]map[string]endpointPreset{
+	"binance": {
+		"spot":    {"https://api.binance.com", "wss://stream.binance.com:9443"},
+		"us":      {"https://api.binance.us", "wss://stream.binance.us:9443"},
+		"testnet": {"https://testnet.binance.vision", "wss://stream.testnet.binance.vision"},
+	},
+	"futures": {
+		"usdm":    {"https://fapi.binance.com", "wss://fstream.binance.com"},
+		"testnet": {"https://testnet.binancefuture.com", "wss://stream.binancefuture.com"},
+	},
+}
+
+// providerDefaults are the stream type each provider uses unless configured
+var providerDefaults = map[string]string{
+	"binance": "trade",
+	"futures": "markPrice@1s",
 }
 
+var (
+	streamTypes = map[string]map[string]bool{
+		"binance": {"trade": true, "aggTrade": true, "kline": true},
+		"futures": {"markPrice": true, "markPrice@1s": true},
+	}
+	klineIntervals = map[string]bool{
+		"1s": true, "1m": true, "3m": true, "5m": true, "15m": true, "30m": true, "1h": true, "2h": true,
+		"4h": true, "6h": true, "8h": true, "12h": true, "1d": true, "3d": true, "1w": true, "1M": true,
+	}
+	symbolPattern = regexp.MustCompile(`^[A-Z0-9]{2,20}$`)
+)
+
 func NewConfig() *Config {
-	return &Config{
+	e := &env{}
+	cfg := &Config{
 		DatabaseURL: os.Getenv("DATABASE_URL"),
+		PublicURL:   getString("PUBLIC_URL", "http://localhost:3030"),
+		Binance:     loadProvider(e, "binance", "BINANCE", "spot"),
+		Futures: FuturesConfig{
+			Enabled:                  e.getBool("FUTURES_ENABLED", false),
+			Provider:                 loadProvider(e, "futures", "FUTURES", "usdm"),
+			OpenInterestPollInterval: e.getDuration("FUTURES_OPEN_INTEREST_POLL_INTERVAL", time.Minute),
+			OpenInterestWindow:       e.getDuration("FUTURES_OPEN_INTEREST_WINDOW", 15*time.Minute),
+		},
+		SMTP: SMTPConfig{
+			Host:      os.Getenv("SMTP_HOST"),
+			Port:      e.getInt("SMTP_PORT", 587),
+			Username:  os.Getenv("SMTP_USERNAME"),
+			Password:  os.Getenv("SMTP_PASSWORD"),
+			FromEmail: os.Getenv("FROM_EMAIL"),
+		},
+		Notifications: NotificationConfig{
+			DefaultChannels:    splitList(getString("NOTIFY_DEFAULT_CHANNELS", "email")),
+			TelegramAPIURL:     getString("TELEGRAM_API_URL", "https://api.telegram.org"),
+			TelegramBotToken:   os.Getenv("TELEGRAM_BOT_TOKEN"),
+			TelegramBot:        e.getBool("TELEGRAM_BOT", true),
+			SlackAPIURL:        getString("SLACK_API_URL", "https://slack.com/api"),
+			SlackBotToken:      os.Getenv("SLACK_BOT_TOKEN"),
+			SlackSigningSecret: os.Getenv("SLACK_SIGNING_SECRET"),
+			DiscordPublicKey:   os.Getenv("DISCORD_PUBLIC_KEY"),
+			InteractionSecret:  os.Getenv("INTERACTION_SECRET"),
+			SnoozeDuration:     e.getDuration("SNOOZE_DURATION", time.Hour),
+			SMSGatewayURL:      os.Getenv("SMS_GATEWAY_URL"),
+			SMSGatewayToken:    os.Getenv("SMS_GATEWAY_TOKEN"),
+		},
+		Outbox: OutboxConfig{
+			MaxAttempts: e.getInt("OUTBOX_MAX_ATTEMPTS", 8),
+			BaseDelay:   e.getDuration("OUTBOX_BASE_DELAY", 30*time.Second),
+			MaxDelay:    e.getDuration("OUTBOX_MAX_DELAY", time.Hour),
+		},
+		RateLimit: RateLimitConfig{
+			UserPerMinute:    e.getInt("RATE_LIMIT_USER_PER_MINUTE", 30),
+			UserBurst:        e.getInt("RATE_LIMIT_USER_BURST", 30),
+			ChannelPerMinute: e.getInt("RATE_LIMIT_CHANNEL_PER_MINUTE", 10),
+			ChannelBurst:     e.getInt("RATE_LIMIT_CHANNEL_BURST", 10),
+		},
+		Stream: StreamConfig{
+			BufferSize: e.getInt("STREAM_BUFFER_SIZE", 64),
+		},
+		Auth: AuthConfig{
+			JWTSecret:   os.Getenv("AUTH_JWT_SECRET"),
+			JWKSFile:    os.Getenv("AUTH_JWKS_FILE"),
+			JWTIssuer:   os.Getenv("AUTH_JWT_ISSUER"),
+			JWTAudience: os.Getenv("AUTH_JWT_AUDIENCE"),
+			AdminKey:    os.Getenv("AUTH_ADMIN_KEY"),
+		},
+		IdempotencyRetention: e.getDuration("IDEMPOTENCY_RETENTION", 24*time.Hour),
+
+		RecordFile:  os.Getenv("RECORD_FILE"),
+		ReplayFiles: splitList(os.Getenv("REPLAY_FILES")),
+		ReplaySpeed: e.getFloat("REPLAY_SPEED", 1),
+	}
+	cfg.envErrors = e.errs
+	return cfg
+}
+
+// loadProvider reads <PREFIX>_* variables. <PREFIX>_ENDPOINT picks a preset
+// whose URLs <PREFIX>_BASE_URL and <PREFIX>_WS_URL can override.
+func loadProvider(e *env, name, prefix, defaultEndpoint string) ProviderConfig {
+	endpoint := getString(prefix+"_ENDPOINT", defaultEndpoint)
+	preset := providerPresets[name][endpoint]
+
+	symbols := splitList(strings.ToUpper(os.Getenv(prefix + "_SYMBOLS")))
+	if len(symbols) == 0 {
+		symbols = []string{"BTCUSDT"}
+	}
+
+	return ProviderConfig{
+		Name:          name,
+		Endpoint:      endpoint,
+		BaseURL:       strings.TrimSuffix(getString(prefix+"_BASE_URL", preset.baseURL), "/"),
+		WSURL:         strings.TrimSuffix(getString(prefix+"_WS_URL", preset.wsURL), "/"),
+		StreamType:    getString(prefix+"_STREAM_TYPE", providerDefaults[name]),
+		KlineInterval: getString(prefix+"_KLINE_INTERVAL", "1m"),
+		Symbols:       symbols,
+		ProxyURL:      os.Getenv(prefix + "_PROXY_URL"),
+		TLS: TLSConfig{
+			CAFile:             os.Getenv(prefix + "_TLS_CA_FILE"),
+			ServerName:         os.Getenv(prefix + "_TLS_SERVER_NAME"),
+			InsecureSkipVerify: e.getBool(prefix+"_TLS_INSECURE_SKIP_VERIFY", false),
+		},
+	}
+}
+
+// Validate reports every configuration problem at once.
+func (c *Config) Validate() error {
+	errs := append([]error(nil), c.envErrors...)
+	if c.DatabaseURL == "" {
+		errs = append(errs, errors.New("DATABASE_URL is required"))
+	}
+	if err := validateURL(c.PublicURL, "http", "https"); err != nil {
+		errs = append(errs, fmt.Errorf("invalid PUBLIC_URL: %v", err))
+	}
+	if err := c.Binance.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Futures.Enabled {
+		if err := c.Futures.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(c.Notifications.DefaultChannels) == 0 {
+		errs = append(errs, errors.New("NOTIFY_DEFAULT_CHANNELS must name at least one channel"))
+	}
+	if c.Notifications.SMSGatewayURL != "" {
+		if err := validateURL(c.Notifications.SMSGatewayURL, "http", "https"); err != nil {
+			errs = append(errs, fmt.Errorf("invalid SMS_GATEWAY_URL: %v", err))
+		}
+	}
+	if key := c.Notifications.DiscordPublicKey; key != "" {
+		if b, err := hex.DecodeString(key); err != nil || len(b) != 32 {
+			errs = append(errs, errors.New("DISCORD_PUBLIC_KEY must be a hex encoded Ed25519 public key"))
+		}
+	}
+	if secret := c.Notifications.InteractionSecret; secret != "" && len(secret) < 32 {
+		errs = append(errs, errors.New("INTERACTION_SECRET must be at least 32 characters"))
+	}
+	if secret := c.Notifications.InteractionSecret; secret == "" && (c.Notifications.SlackSigningSecret != "" || c.Notifications.DiscordPublicKey != "") {
+		errs = append(errs, errors.New("INTERACTION_SECRET is required with SLACK_SIGNING_SECRET or DISCORD_PUBLIC_KEY"))
+	}
+	if c.Notifications.SnoozeDuration <= 0 {
+		errs = append(errs, errors.New("SNOOZE_DURATION must be positive"))
+	}
+	if c.Outbox.MaxAttempts < 1 {
+		errs = append(errs, errors.New("OUTBOX_MAX_ATTEMPTS must be at least 1"))
+	}
+	if c.Outbox.BaseDelay <= 0 || c.Outbox.MaxDelay < c.Outbox.BaseDelay {
+		errs = append(errs, errors.New("OUTBOX_BASE_DELAY must be positive and not exceed OUTBOX_MAX_DELAY"))
+	}
+	if c.RateLimit.UserPerMinute < 0 || c.RateLimit.ChannelPerMinute < 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_*_PER_MINUTE must not be negative"))
+	}
+	if (c.RateLimit.UserPerMinute > 0 && c.RateLimit.UserBurst < 1) || (c.RateLimit.ChannelPerMinute > 0 && c.RateLimit.ChannelBurst < 1) {
+		errs = append(errs, errors.New("RATE_LIMIT_*_BURST must be at least 1 when the rate limit is enabled"))
+	}
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < 32 {
+		errs = append(errs, errors.New("AUTH_JWT_SECRET must be at least 32 characters"))
+	}
+	if c.Auth.AdminKey != "" && len(c.Auth.AdminKey) < 32 {
+		errs = append(errs, errors.New("AUTH_ADMIN_KEY must be at least 32 characters"))
+	}
+	if c.Stream.BufferSize < 1 {
+		errs = append(errs, errors.New("STREAM_BUFFER_SIZE must be at least 1"))
+	}
+	if c.IdempotencyRetention < time.Minute {
+		errs = append(errs, errors.New("IDEMPOTENCY_RETENTION must be at least 1m"))
+	}
+	if c.ReplaySpeed < 0 {
+		errs = append(errs, errors.New("REPLAY_SPEED must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *ProviderConfig) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{p.Name}, args...)...))
+	}
+
+	if _, ok := providerPresets[p.Name][p.Endpoint]; !ok {
+		fail("unknown endpoint %q", p.Endpoint)
+	}
+	if err := validateURL(p.BaseURL, "http", "https"); err != nil {
+		fail("invalid base URL: %v", err)
+	}
+	if err := validateURL(p.WSURL, "ws", "wss"); err != nil {
+		fail("invalid stream URL: %v", err)
+	} else if u, _ := url.Parse(p.WSURL); u.Path != "" && u.Path != "/" {
+		fail("stream URL must be the stream host without a path, got %s", p.WSURL)
+	}
+	if !streamTypes[p.Name][p.StreamType] {
+		fail("unsupported stream type %q", p.StreamType)
+	}
+	if p.StreamType == "kline" && !klineIntervals[p.KlineInterval] {
+		fail("unknown kline interval %q", p.KlineInterval)
+	}
+	if len(p.Symbols) == 0 {
+		fail("at least one symbol is required")
+	}
+	for _, symbol := range p.Symbols {
+		if !symbolPattern.MatchString(symbol) {
+			fail("invalid symbol %q", symbol)
+		}
+	}
+	if p.ProxyURL != "" {
+		if err := validateURL(p.ProxyURL, "http", "https", "socks5"); err != nil {
+			fail("invalid proxy URL: %v", err)
+		}
+	}
+	if p.TLS.CAFile != "" {
+		if _, err := p.TLS.LoadCAFile(); err != nil {
+			fail("%v", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FuturesConfig) Validate() error {
+	errs := []error{f.Provider.Validate()}
+	if f.OpenInterestPollInterval < time.Second {
+		errs = append(errs, errors.New("futures: open interest poll interval must be at least 1s"))
+	}
+	if f.OpenInterestWindow < f.OpenInterestPollInterval {
+		errs = append(errs, errors.New("futures: open interest window must not be shorter than the poll interval"))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadCAFile returns the system roots plus the certificates in CAFile.
+func (t TLSConfig) LoadCAFile() (*x509.CertPool, error) {
+	pem, err := os.ReadFile(t.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA file: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", t.CAFile)
+	}
+	return pool, nil
+}
+
+func validateURL(value string, schemes ...string) error {
+	if value == "" {
+		return errors.New("URL is empty")
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s has no host", value)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must use one of the schemes %v", value, schemes)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getString(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// env reads typed variables, collecting the malformed ones so Validate
+// can report them instead of silently using the default.
+type env struct {
+	errs []error
+}
+
+func (e *env) getInt(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be an integer, got %q", key, raw))
+		return def
+	}
+	return value
+}
+
+func (e *env) getFloat(key string, def float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a number, got %q", key, raw))
+		return def
+	}
+	return value
+}
+
+func (e *env) getDuration(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a duration such as 30s or 1h, got %q", key, raw))
+		return def
+	}
+	return value
+}
+
+func (e *env) getBool(key string, def bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be true or false, got %q", key, raw))
+		return def
 	}
+	return value
 }
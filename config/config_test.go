@@ -0,0 +1,34 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateReportsMalformedVariables(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/alerts")
+	t.Setenv("SMTP_PORT", "58x")
+	t.Setenv("OUTBOX_BASE_DELAY", "30")
+	t.Setenv("TELEGRAM_BOT", "yes")
+	t.Setenv("REPLAY_SPEED", "fast")
+	t.Setenv("STREAM_BUFFER_SIZE", "128")
+
+	cfg := NewConfig()
+	if cfg.Stream.BufferSize != 128 || cfg.Outbox.BaseDelay != 30*time.Second {
+		t.Errorf("BufferSize = %d, BaseDelay = %v", cfg.Stream.BufferSize, cfg.Outbox.BaseDelay)
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() accepted malformed variables")
+	}
+	for _, key := range []string{"SMTP_PORT", "OUTBOX_BASE_DELAY", "TELEGRAM_BOT", "REPLAY_SPEED"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Validate() = %q, does not name %s", err, key)
+		}
+	}
+	if strings.Contains(err.Error(), "STREAM_BUFFER_SIZE") {
+		t.Errorf("Validate() = %q, names the valid STREAM_BUFFER_SIZE", err)
+	}
+}
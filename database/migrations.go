@@ -0,0 +1,180 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order on every start, so each statement must be
+// idempotent. Append new statements, never edit applied ones.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS alerts (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		value DOUBLE PRECISION NOT NULL,
+		direction TEXT NOT NULL,
+		indicator TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		email TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS symbol TEXT NOT NULL DEFAULT 'BTCUSDT'`,
+	`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS channels TEXT[] NOT NULL DEFAULT '{}'`,
+	`CREATE TABLE IF NOT EXISTS user_channels (
+		user_id INTEGER NOT NULL,
+		channel TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, channel)
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		alert_id INTEGER REFERENCES alerts (id) ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhooks_user_id_idx ON webhooks (user_id)`,
+	`CREATE TABLE IF NOT EXISTS notification_outbox (
+		id BIGSERIAL PRIMARY KEY,
+		alert_id INTEGER NOT NULL REFERENCES alerts (id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL,
+		channel TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		payload JSONB NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		delivered_at TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS notification_outbox_due_idx ON notification_outbox (next_attempt_at) WHERE status = 'pending'`,
+	`CREATE INDEX IF NOT EXISTS notification_outbox_alert_id_idx ON notification_outbox (alert_id)`,
+	`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`INSERT INTO users (id) SELECT DISTINCT user_id FROM alerts ON CONFLICT (id) DO NOTHING`,
+	`INSERT INTO users (id) SELECT DISTINCT user_id FROM user_channels ON CONFLICT (id) DO NOTHING`,
+	`CREATE TABLE IF NOT EXISTS contacts (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		channel TEXT NOT NULL,
+		address TEXT NOT NULL,
+		verified_at TIMESTAMP,
+		verification_token TEXT UNIQUE,
+		token_expires_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, channel, address)
+	)`,
+	// Addresses given with existing alerts become unverified email contacts
+	`INSERT INTO contacts (user_id, channel, address)
+		SELECT DISTINCT user_id, 'email', LOWER(email) FROM alerts WHERE email <> ''
+		ON CONFLICT DO NOTHING`,
+	`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS contact_id INTEGER REFERENCES contacts (id) ON DELETE SET NULL`,
+	`UPDATE alerts SET contact_id = contacts.id FROM contacts
+		WHERE alerts.contact_id IS NULL AND contacts.user_id = alerts.user_id
+		AND contacts.channel = 'email' AND contacts.address = LOWER(alerts.email)`,
+	// Channel targets move to contacts, which hold every address of a user
+	`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'user_channels' AND column_name = 'target') THEN
+			INSERT INTO contacts (user_id, channel, address, verified_at)
+				SELECT user_id, channel, target, CASE WHEN channel = 'email' THEN NULL ELSE CURRENT_TIMESTAMP END
+				FROM user_channels WHERE target <> '' AND channel <> 'webhook'
+				ON CONFLICT DO NOTHING;
+			ALTER TABLE user_channels DROP COLUMN target;
+		END IF;
+	END $$`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS subject_template TEXT`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_mode TEXT NOT NULL DEFAULT 'immediate'`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_interval INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_hour INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS digest BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC'`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS quiet_start TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS quiet_end TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'normal'`,
+	`ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS held_reason TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS occurrence INTEGER NOT NULL DEFAULT 1`,
+	`ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS dedupe_key TEXT`,
+	`ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS suppressed_reason TEXT NOT NULL DEFAULT ''`,
+	// Each trigger occurrence of an alert is queued once per channel and target
+	`CREATE UNIQUE INDEX IF NOT EXISTS notification_outbox_dedupe_key_idx ON notification_outbox (dedupe_key) WHERE status <> 'suppressed'`,
+	`CREATE INDEX IF NOT EXISTS notification_outbox_suppressed_idx ON notification_outbox (user_id, created_at) WHERE status = 'suppressed'`,
+	`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS snoozed_until TIMESTAMP`,
+	`CREATE INDEX IF NOT EXISTS alerts_user_id_created_at_idx ON alerts (user_id, created_at, id)`,
+	// One-time codes that link a Telegram chat to a user
+	`CREATE TABLE IF NOT EXISTS telegram_link_codes (
+		code TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		expires_at TIMESTAMP NOT NULL
+	)`,
+	// API keys are stored as SHA-256 hashes
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		name TEXT NOT NULL DEFAULT '',
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id)`,
+	// Teams share alerts; their members are owners, editors or viewers
+	`CREATE TABLE IF NOT EXISTS teams (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS team_members (
+		team_id INTEGER NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (team_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS team_members_user_id_idx ON team_members (user_id)`,
+	// Contacts the alerts of a team are delivered to
+	`CREATE TABLE IF NOT EXISTS team_routes (
+		id SERIAL PRIMARY KEY,
+		team_id INTEGER NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+		contact_id INTEGER NOT NULL REFERENCES contacts (id) ON DELETE CASCADE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (team_id, contact_id)
+	)`,
+	`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS team_id INTEGER REFERENCES teams (id) ON DELETE CASCADE`,
+	`CREATE INDEX IF NOT EXISTS alerts_team_id_idx ON alerts (team_id) WHERE team_id IS NOT NULL`,
+	// Responses of requests with an Idempotency-Key, per caller. status is
+	// NULL while the first request is in progress.
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		scope TEXT NOT NULL,
+		key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status INTEGER,
+		content_type TEXT NOT NULL DEFAULT '',
+		body BYTEA,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (scope, key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at)`,
+	// Chats linked with the Telegram bot, which may manage the user's alerts
+	`ALTER TABLE contacts ADD COLUMN IF NOT EXISTS linked_at TIMESTAMP`,
+}
+
+// Migrate brings the schema up to date.
+func Migrate(db *sql.DB) error {
+	for i, statement := range migrations {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("migration %d failed: %v", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+// alertFilter reads the alert filter of the query parameters user_id,
+// team_id, symbol, indicator, status (comma separated), created_after and
+// created_before.
+func alertFilter(c echo.Context) (*models.AlertFilter, error) {
+	filter := &models.AlertFilter{
+		Symbol:    c.QueryParam("symbol"),
+		Indicator: c.QueryParam("indicator"),
+	}
+	for param, dest := range map[string]*int{"user_id": &filter.UserID, "team_id": &filter.TeamID} {
+		s := c.QueryParam(param)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid "+param)
+		}
+		*dest = id
+	}
+	for _, status := range strings.Split(c.QueryParam("status"), ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	for param, dest := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		s := c.QueryParam(param)
+		if s == "" {
+			continue
+		}
+		t, err := parseTime(s)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid "+param+", use RFC 3339 or YYYY-MM-DD")
+		}
+		*dest = &t
+	}
+	return filter, nil
+}
+
+// listAlerts lists the alerts matching the alertFilter parameters, sorted
+// by sort and order, a page of limit at a time. Later pages are fetched by
+// passing the returned next_cursor as cursor. Only the alerts the caller
+// can see are listed; user_id and team_id narrow them to a creator or team.
+func listAlerts(alertService *services.AlertService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter, err := alertFilter(c)
+		if err != nil {
+			return err
+		}
+		filter.Sort = c.QueryParam("sort")
+		filter.Order = c.QueryParam("order")
+		filter.Cursor = c.QueryParam("cursor")
+		if s := c.QueryParam("limit"); s != "" {
+			limit, err := strconv.Atoi(s)
+			if err != nil {
+				return errorJSON(c, http.StatusBadRequest, "Invalid limit")
+			}
+			filter.Limit = limit
+		}
+
+		page, err := alertService.ListAlerts(principal(c), filter)
+		if errors.Is(err, services.ErrInvalidQuery) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error listing alerts: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to list alerts")
+		}
+
+		return c.JSON(http.StatusOK, page)
+	}
+}
+
+func updateAlert(alertService *services.AlertService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
+		}
+		update := new(models.AlertUpdate)
+		if err := c.Bind(update); err != nil {
+			return bindError(c, err, "Invalid alert data")
+		}
+
+		alert, err := alertService.UpdateAlert(principal(c), id, update)
+		if err != nil {
+			return alertError(c, err, "Failed to update alert")
+		}
+
+		return c.JSON(http.StatusOK, alert)
+	}
+}
+
+func deleteAlert(alertService *services.AlertService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
+		}
+
+		err = alertService.DeleteAlert(principal(c), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errorJSON(c, http.StatusNotFound, "Alert not found")
+		}
+		if err != nil {
+			log.Printf("Error deleting alert %d: %v", id, err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to delete alert")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// changeAlertState runs pause or resume. The change fails with 409 if the
+// alert exists but is not in a state it applies to.
+func changeAlertState(alertService *services.AlertService, change func(p *services.Principal, id int) (*models.Alert, error), action string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
+		}
+
+		alert, err := change(principal(c), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			current, getErr := alertService.GetAlert(principal(c), id)
+			if errors.Is(getErr, sql.ErrNoRows) {
+				return errorJSON(c, http.StatusNotFound, "Alert not found")
+			}
+			if getErr != nil {
+				log.Printf("Error fetching alert %d: %v", id, getErr)
+				return errorJSON(c, http.StatusInternalServerError, "Failed to "+action+" alert")
+			}
+			return errorJSON(c, http.StatusConflict, "Cannot "+action+" a "+current.Status+" alert")
+		}
+		if err != nil {
+			log.Printf("Error changing alert %d: %v", id, err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to "+action+" alert")
+		}
+
+		return c.JSON(http.StatusOK, alert)
+	}
+}
+
+// alertError writes the response for an error of creating or changing an
+// alert, logging unexpected errors.
+func alertError(c echo.Context, err error, message string) error {
+	var verr *services.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return validationJSON(c, verr)
+	case errors.Is(err, sql.ErrNoRows):
+		return errorJSON(c, http.StatusNotFound, "Alert not found")
+	case errors.Is(err, services.ErrInvalidAlert), errors.Is(err, services.ErrUnknownChannel),
+		errors.Is(err, services.ErrInvalidContact), errors.Is(err, services.ErrContactNotFound):
+		return errorJSON(c, http.StatusBadRequest, err.Error())
+	}
+	log.Printf("%s: %v", message, err)
+	return errorJSON(c, http.StatusInternalServerError, message)
+}
+
+// parseTime accepts RFC 3339 times and dates
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// alertFromRequest returns the alert a create request describes
+func alertFromRequest(userID int, req *models.AlertRequest) *models.Alert {
+	return &models.Alert{
+		UserID:    userID,
+		TeamID:    req.TeamID,
+		Value:     req.Value,
+		Direction: req.Direction,
+		Indicator: req.Indicator,
+		Email:     req.Email,
+		Symbol:    req.Symbol,
+		Channels:  req.Channels,
+		ContactID: req.ContactID,
+		Priority:  req.Priority,
+		Status:    req.Status,
+	}
+}
+
+const (
+	maxBulkAlerts = 500
+	maxBulkBody   = 1 << 20
+)
+
+// bulkCreateAlerts creates up to maxBulkAlerts alerts at once, all or none.
+// The body is {"alerts": [...]} like the JSON export, or with a text/csv
+// content type the CSV export.
+func bulkCreateAlerts(alertService *services.AlertService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, maxBulkBody)
+
+		var requests []*models.AlertRequest
+		if strings.HasPrefix(req.Header.Get(echo.HeaderContentType), "text/csv") {
+			var err error
+			requests, err = services.ReadAlertsCSV(req.Body)
+			if err != nil {
+				return bulkError(c, err)
+			}
+		} else {
+			body := new(alertRequests)
+			if err := c.Bind(body); err != nil {
+				return bulkError(c, err)
+			}
+			requests = body.Alerts
+		}
+		if len(requests) == 0 || len(requests) > maxBulkAlerts {
+			return errorJSON(c, http.StatusBadRequest, fmt.Sprintf("Send 1 to %d alerts", maxBulkAlerts))
+		}
+
+		alerts := make([]*models.Alert, len(requests))
+		for i, r := range requests {
+			if r == nil {
+				return errorJSON(c, http.StatusBadRequest, fmt.Sprintf("Alert %d is null", i))
+			}
+			userID, err := actingUser(c, r.UserID)
+			if err != nil {
+				return err
+			}
+			alerts[i] = alertFromRequest(userID, r)
+		}
+		if err := alertService.CreateAlerts(principal(c), alerts); err != nil {
+			return alertError(c, err, "Failed to create alerts")
+		}
+
+		return c.JSON(http.StatusCreated, alertList{Alerts: alerts})
+	}
+}
+
+// bulkError writes the response for a bulk body that could not be read
+func bulkError(c echo.Context, err error) error {
+	var tooLarge *http.MaxBytesError
+	var verr *services.ValidationError
+	switch {
+	case errors.As(err, &tooLarge):
+		return errorJSON(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("The body must be at most %d bytes", maxBulkBody))
+	case errors.As(err, &verr):
+		return validationJSON(c, verr)
+	case errors.Is(err, services.ErrInvalidAlert):
+		return errorJSON(c, http.StatusBadRequest, err.Error())
+	}
+	return bindError(c, err, "Invalid alerts data")
+}
+
+// exportAlerts returns the definitions of the alerts matching the
+// alertFilter parameters, as {"alerts": [...]} or with format=csv as CSV.
+// Both can be created again with bulkCreateAlerts.
+func exportAlerts(alertService *services.AlertService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		format := c.QueryParam("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			return errorJSON(c, http.StatusBadRequest, "format must be json or csv")
+		}
+		filter, err := alertFilter(c)
+		if err != nil {
+			return err
+		}
+
+		alerts, err := alertService.ExportAlerts(principal(c), filter)
+		if errors.Is(err, services.ErrInvalidQuery) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error exporting alerts: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to export alerts")
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="alerts.`+format+`"`)
+		if format == "json" {
+			return c.JSON(http.StatusOK, alertRequests{Alerts: alerts})
+		}
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		return services.WriteAlertsCSV(c.Response(), alerts)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+// createAPIKey issues an API key for the user. The response is the only
+// time the key is shown.
+func createAPIKey(auth *services.Authenticator) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		req := new(apiKeyRequest)
+		if err := c.Bind(req); err != nil {
+			return bindError(c, err, "Invalid API key data")
+		}
+		if len(req.Name) > 100 {
+			verr := &services.ValidationError{}
+			verr.Add("name", "must be at most 100 characters")
+			return validationJSON(c, verr)
+		}
+
+		key, secret, err := auth.CreateAPIKey(userID, req.Name)
+		if err != nil {
+			log.Printf("Error creating API key: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to create API key")
+		}
+
+		return c.JSON(http.StatusCreated, newAPIKey{APIKey: key, Key: secret})
+	}
+}
+
+func getAPIKeys(auth *services.Authenticator) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		keys, err := auth.GetAPIKeys(userID)
+		if err != nil {
+			log.Printf("Error fetching API keys: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch API keys")
+		}
+
+		return c.JSON(http.StatusOK, keys)
+	}
+}
+
+func deleteAPIKey(auth *services.Authenticator) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		id, err := strconv.Atoi(c.Param("keyId"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid API key ID")
+		}
+
+		if err := auth.DeleteAPIKey(userID, id); err != nil {
+			log.Printf("Error deleting API key: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to delete API key")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+// principalKey is the context key of the authenticated principal
+const principalKey = "principal"
+
+// authenticate rejects requests without a valid API key or JWT, passed as
+// a bearer token or in the X-API-Key header. EventSource and browser
+// WebSockets cannot set headers, so stream requests may also pass it as
+// the access_token query parameter. Routes in public are not checked.
+func authenticate(auth *services.Authenticator, public ...string) echo.MiddlewareFunc {
+	skip := make(map[string]bool)
+	for _, path := range public {
+		skip[path] = true
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skip[c.Path()] {
+				return next(c)
+			}
+			credential := c.Request().Header.Get("X-API-Key")
+			if header := c.Request().Header.Get(echo.HeaderAuthorization); strings.HasPrefix(header, "Bearer ") {
+				credential = strings.TrimPrefix(header, "Bearer ")
+			}
+			if credential == "" && (c.Path() == "/stream" || c.Path() == "/ws") {
+				credential = c.QueryParam("access_token")
+			}
+
+			principal, err := auth.Authenticate(credential)
+			if err != nil {
+				if !errors.Is(err, services.ErrUnauthenticated) {
+					log.Printf("Error authenticating request: %v", err)
+					return errorJSON(c, http.StatusInternalServerError, "Failed to authenticate request")
+				}
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="price-alert-system"`)
+				return errorJSON(c, http.StatusUnauthorized, "Missing or invalid API key or token")
+			}
+			c.Set(principalKey, principal)
+			return next(c)
+		}
+	}
+}
+
+// principal returns who the request is authenticated as.
+func principal(c echo.Context) *services.Principal {
+	p, _ := c.Get(principalKey).(*services.Principal)
+	return p
+}
+
+// requireUser only lets principals that can act as the :id user through.
+func requireUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		if !principal(c).CanActAs(userID) {
+			return errorJSON(c, http.StatusForbidden, "Not allowed to access this user")
+		}
+		return next(c)
+	}
+}
+
+// requireAlert only lets principals that can see the :id alert through,
+// and with change only those that can also change it. Alerts the principal
+// cannot see are reported as not found so their IDs cannot be probed.
+func requireAlert(alertService *services.AlertService, change bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
+			}
+
+			_, err = alertService.GetAlert(principal(c), id)
+			if errors.Is(err, sql.ErrNoRows) {
+				return errorJSON(c, http.StatusNotFound, "Alert not found")
+			}
+			if err != nil {
+				log.Printf("Error fetching alert %d: %v", id, err)
+				return errorJSON(c, http.StatusInternalServerError, "Failed to fetch alert")
+			}
+			if change {
+				ok, err := alertService.CanChangeAlert(principal(c), id)
+				if err != nil {
+					log.Printf("Error checking access to alert %d: %v", id, err)
+					return errorJSON(c, http.StatusInternalServerError, "Failed to fetch alert")
+				}
+				if !ok {
+					return errorJSON(c, http.StatusForbidden, "Team viewers cannot change the team's alerts")
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// actingUser returns the user a request acts for: the principal's own user,
+// or for admins the user passed, which they must pass. userID is 0 if the
+// request passed none.
+func actingUser(c echo.Context, userID int) (int, error) {
+	p := principal(c)
+	switch {
+	case p.Admin && userID <= 0:
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "user_id is required with the admin key")
+	case p.Admin:
+		return userID, nil
+	case userID != 0 && userID != p.UserID:
+		return 0, echo.NewHTTPError(http.StatusForbidden, "Not allowed to act as another user")
+	}
+	return p.UserID, nil
+}
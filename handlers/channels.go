@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+func listChannels(dispatcher *services.Dispatcher) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, channelList{Channels: dispatcher.Channels()})
+	}
+}
+
+func getUserChannels(dispatcher *services.Dispatcher) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		channels, err := dispatcher.GetUserChannels(userID)
+		if err != nil {
+			log.Printf("Error fetching user channels: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch channels")
+		}
+		if channels == nil {
+			channels = []*models.UserChannel{}
+		}
+
+		return c.JSON(http.StatusOK, channels)
+	}
+}
+
+func setUserChannel(dispatcher *services.Dispatcher) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		uc := &models.UserChannel{Enabled: true}
+		if err := c.Bind(uc); err != nil {
+			return bindError(c, err, "Invalid channel data")
+		}
+		uc.UserID = userID
+		uc.Channel = c.Param("channel")
+
+		err = dispatcher.SetUserChannel(uc)
+		if errors.Is(err, services.ErrUnknownChannel) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error saving user channel: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to save channel")
+		}
+
+		return c.JSON(http.StatusOK, uc)
+	}
+}
+
+func deleteUserChannel(dispatcher *services.Dispatcher) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		if err := dispatcher.DeleteUserChannel(userID, c.Param("channel")); err != nil {
+			log.Printf("Error deleting user channel: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to delete channel")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
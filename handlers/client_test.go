@@ -0,0 +1,907 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/client"
+	"price-alert-system/config"
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+const (
+	testAdminKey    = "test-admin-key"
+	testAPIKey      = "pak_test"
+	testSlackSecret = "slack-signing-secret"
+)
+
+var testTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testAPI serves the real routes on services backed by a mock database and
+// a stand-in of the Binance API.
+type testAPI struct {
+	echo   *echo.Echo
+	server *httptest.Server
+	mock   sqlmock.Sqlmock
+	// admin calls with the admin key, user as user 1 with an API key
+	admin      *client.Client
+	user       *client.Client
+	discordKey ed25519.PrivateKey
+}
+
+func newTestAPI(t *testing.T, rec *recorder) *testAPI {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	binance := httptest.NewServer(http.HandlerFunc(serveKlines))
+	t.Cleanup(binance.Close)
+	binanceService, err := services.NewBinanceService(config.ProviderConfig{BaseURL: binance.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renderer := services.NewRenderer(db, services.NewPriceFormatter(nil))
+	emailNotifier := services.NewEmailNotifier("localhost", 0, "", "", "alerts@example.com", renderer)
+	contactService := services.NewContactService(db, emailNotifier, "http://localhost")
+	dispatcher := services.NewDispatcher(db, contactService, []string{"email"})
+	dispatcher.Register(emailNotifier)
+	webhookNotifier := services.NewWebhookNotifier(db)
+	dispatcher.Register(webhookNotifier)
+
+	indicatorService := services.NewIndicatorService()
+	for i := 0; i < 60; i++ {
+		open := testTime.Add(time.Duration(i-60) * time.Minute)
+		price := 60000 + float64(i%7)*25
+		indicatorService.UpdateKlines("BTCUSDT", models.Kline{
+			OpenTime: open.UnixMilli(), Open: price, High: price + 30, Low: price - 30, Close: price + 10,
+			CloseTime: open.Add(time.Minute).UnixMilli() - 1,
+		})
+	}
+
+	preferenceService := services.NewPreferenceService(db)
+	outbox := services.NewOutbox(db, dispatcher, preferenceService, services.NewRateLimiter(60, 10, 600, 100), 5, time.Second, time.Minute)
+	hub := services.NewHub(16)
+	alertService := services.NewAlertService(db, indicatorService, dispatcher, outbox, contactService, hub)
+	auth, err := services.NewAuthenticator(db, "", "", "", "", testAdminKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, discordKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := services.NewButtonSigner(strings.Repeat("s", 32))
+	interactions := services.NewInteractions(alertService, signer, testSlackSecret,
+		hex.EncodeToString(discordKey.Public().(ed25519.PublicKey)), time.Hour)
+	telegramBot := services.NewTelegramBot(db, services.NewTelegramNotifier("http://localhost", "token", renderer),
+		alertService, contactService, services.NewPriceFormatter(nil))
+
+	e := echo.New()
+	e.HideBanner = true
+	RegisterRoutes(e, &Services{
+		Alerts:       alertService,
+		Backtest:     services.NewBacktestService(binanceService),
+		Dispatcher:   dispatcher,
+		Webhooks:     webhookNotifier,
+		Outbox:       outbox,
+		Contacts:     contactService,
+		Renderer:     renderer,
+		Preferences:  preferenceService,
+		Hub:          hub,
+		Auth:         auth,
+		Teams:        services.NewTeamService(db, contactService),
+		TelegramBot:  telegramBot,
+		Interactions: interactions,
+		Idempotency:  services.NewIdempotencyStore(db, time.Hour),
+		MarketData:   services.NewMarketDataService(indicatorService, alertService, binanceService, []string{"BTCUSDT"}),
+	})
+	if rec != nil {
+		rec.install(e)
+	}
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	return &testAPI{
+		echo:       e,
+		server:     server,
+		mock:       mock,
+		admin:      client.New(server.URL, testAdminKey),
+		user:       client.New(server.URL, testAPIKey),
+		discordKey: discordKey,
+	}
+}
+
+// serveKlines answers kline requests with five closed hourly klines
+func serveKlines(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v3/klines" {
+		http.NotFound(w, r)
+		return
+	}
+	var rows [][]interface{}
+	for i := 0; i < 5; i++ {
+		open := testTime.Add(time.Duration(i-5) * time.Hour)
+		price := strconv.Itoa(60000 + i*100)
+		rows = append(rows, []interface{}{open.UnixMilli(), price, price, price, price, "10",
+			open.Add(time.Hour).UnixMilli() - 1, "600000", 100, "5", "300000", "0"})
+	}
+	json.NewEncoder(w).Encode(rows)
+}
+
+// apiCall runs one operation against a fresh testAPI after setting up the
+// queries it is expected to make, and checks the result.
+type apiCall struct {
+	name   string
+	expect func(mock sqlmock.Sqlmock)
+	run    func(ctx context.Context, api *testAPI) error
+}
+
+// runCalls runs each call on its own testAPI, recording into rec.
+func runCalls(t *testing.T, rec *recorder, calls []apiCall) {
+	for _, call := range calls {
+		t.Run(call.name, func(t *testing.T) {
+			api := newTestAPI(t, rec)
+			if call.expect != nil {
+				call.expect(api.mock)
+			}
+			if err := call.run(context.Background(), api); err != nil {
+				t.Error(err)
+			}
+			if err := api.mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestClient runs every method of the client against the real routes.
+func TestClient(t *testing.T) {
+	calls := clientCalls()
+	covered := make(map[string]bool)
+	for _, call := range calls {
+		covered[call.name] = true
+	}
+	clientType := reflect.TypeOf(&client.Client{})
+	for i := 0; i < clientType.NumMethod(); i++ {
+		if name := clientType.Method(i).Name; !covered[name] {
+			t.Errorf("client method %s is not tested", name)
+		}
+	}
+
+	runCalls(t, nil, calls)
+}
+
+// Queries and rows of the mock database
+
+var (
+	alertColumns    = []string{"id", "user_id", "team_id", "value", "direction", "indicator", "status", "email", "symbol", "channels", "contact_id", "priority", "occurrence", "snoozed_until", "created_at", "updated_at"}
+	contactColumns  = []string{"id", "user_id", "channel", "address", "verified_at", "created_at"}
+	deliveryColumns = []string{"id", "alert_id", "channel", "target", "status", "attempts", "max_attempts", "next_attempt_at", "last_error", "created_at", "delivered_at", "digest", "held_reason", "dedupe_key", "suppressed_reason"}
+	routeColumns    = []string{"id", "team_id", "contact_id", "channel", "address", "verified", "created_at"}
+)
+
+func sqlPattern(query string) string {
+	return regexp.QuoteMeta(query)
+}
+
+func testAlert(id int) *models.Alert {
+	contactID := 3
+	return &models.Alert{
+		ID: id, UserID: 1, Value: 70, Direction: "UP", Indicator: "RSI", Status: "active", Email: "ada@example.com",
+		Symbol: "BTCUSDT", Channels: []string{"email"}, ContactID: &contactID, Priority: "normal", Occurrence: 1,
+		CreatedAt: testTime, UpdatedAt: testTime,
+	}
+}
+
+func alertRows(alerts ...*models.Alert) *sqlmock.Rows {
+	rows := sqlmock.NewRows(alertColumns)
+	for _, a := range alerts {
+		rows.AddRow(a.ID, a.UserID, nullInt(a.TeamID), a.Value, a.Direction, a.Indicator, a.Status, a.Email, a.Symbol,
+			"{"+strings.Join(a.Channels, ",")+"}", nullInt(a.ContactID), a.Priority, a.Occurrence, nil, a.CreatedAt, a.UpdatedAt)
+	}
+	return rows
+}
+
+func nullInt(v *int) driver.Value {
+	if v == nil {
+		return nil
+	}
+	return int64(*v)
+}
+
+func contactRow(id int, channel, address string) *sqlmock.Rows {
+	return sqlmock.NewRows(contactColumns).AddRow(id, 1, channel, address, testTime, testTime)
+}
+
+func deliveryRow(id int64, status string) *sqlmock.Rows {
+	return sqlmock.NewRows(deliveryColumns).
+		AddRow(id, 1, "email", "ada@example.com", status, 1, 5, testTime, "", testTime, nil, false, "", "1:1:email:ada@example.com", "")
+}
+
+func routeRow(id int) *sqlmock.Rows {
+	return sqlmock.NewRows(routeColumns).AddRow(id, 2, 6, "telegram", "12345", true, testTime)
+}
+
+// expectAlert expects an alert to be fetched
+func expectAlert(mock sqlmock.Sqlmock, alert *models.Alert) {
+	mock.ExpectQuery(`SELECT .+ FROM alerts WHERE id = \$1`).WithArgs(alert.ID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(alertRows(alert))
+}
+
+// expectChangeAlert expects the checks of requireAlert for changes
+func expectChangeAlert(mock sqlmock.Sqlmock, alert *models.Alert) {
+	expectAlert(mock, alert)
+	mock.ExpectQuery(sqlPattern(`SELECT EXISTS (SELECT 1 FROM alerts WHERE id = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+}
+
+// expectNewAlert expects an alert of user 1 for contact 3 to be prepared
+func expectNewAlert(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(sqlPattern(`INSERT INTO users (id)`)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(sqlPattern(`FROM contacts WHERE id = $1 AND user_id = $2`)).WithArgs(3, 1).
+		WillReturnRows(contactRow(3, "email", "ada@example.com"))
+}
+
+func expectInsertAlert(mock sqlmock.Sqlmock, id int) {
+	mock.ExpectQuery(sqlPattern(`INSERT INTO alerts`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(id, testTime, testTime))
+}
+
+// expectRole expects the principal's role in team 2 to be fetched
+func expectRole(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(sqlPattern(`SELECT CASE WHEN $3 THEN 'owner' ELSE m.role END FROM teams t`)).WithArgs(2, 0, true).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(services.RoleOwner))
+}
+
+// expectUser expects the API key of user 1 to be looked up
+func expectUser(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(sqlPattern(`SELECT id, user_id FROM api_keys WHERE key_hash = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(4, 1))
+	mock.ExpectExec(sqlPattern(`UPDATE api_keys SET last_used_at`)).WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectOwners(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(sqlPattern(`SELECT COUNT(*) FROM team_members WHERE team_id = $1 AND role = 'owner'`)).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+}
+
+func newAlertRequest() *models.AlertRequest {
+	contactID := 3
+	return &models.AlertRequest{UserID: 1, Symbol: "BTCUSDT", Value: 70, Direction: "UP", Indicator: "RSI", ContactID: &contactID}
+}
+
+func ok(result bool, format string, args ...interface{}) error {
+	if result {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
+
+// clientCalls calls every method of the client.
+func clientCalls() []apiCall {
+	return []apiCall{
+		{"ListAlerts", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT .+ FROM alerts WHERE .+ LIMIT 3`).
+				WithArgs(true, 0, sqlmock.AnyArg(), "BTCUSDT").
+				WillReturnRows(alertRows(testAlert(1), testAlert(2)))
+		}, func(ctx context.Context, api *testAPI) error {
+			page, err := api.admin.ListAlerts(ctx, &models.AlertFilter{Symbol: "btcusdt", Limit: 2})
+			if err != nil {
+				return err
+			}
+			return ok(len(page.Alerts) == 2 && page.Alerts[1].ID == 2 && page.NextCursor == "", "ListAlerts() = %+v", page)
+		}},
+		{"CreateAlert", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2`)).
+				WithArgs("admin", "create-1", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(sqlPattern(`INSERT INTO idempotency_keys`)).WillReturnResult(sqlmock.NewResult(0, 1))
+			expectNewAlert(mock)
+			expectInsertAlert(mock, 10)
+			mock.ExpectExec(sqlPattern(`UPDATE idempotency_keys SET status = $3`)).
+				WithArgs("admin", "create-1", http.StatusCreated, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			alert, err := api.admin.CreateAlert(ctx, newAlertRequest(), "create-1")
+			if err != nil {
+				return err
+			}
+			return ok(alert.ID == 10 && alert.Status == "pending" && alert.Email == "ada@example.com", "CreateAlert() = %+v", alert)
+		}},
+		{"CreateAlerts", func(mock sqlmock.Sqlmock) {
+			expectNewAlert(mock)
+			expectNewAlert(mock)
+			mock.ExpectBegin()
+			expectInsertAlert(mock, 11)
+			expectInsertAlert(mock, 12)
+			mock.ExpectCommit()
+		}, func(ctx context.Context, api *testAPI) error {
+			alerts, err := api.admin.CreateAlerts(ctx, []*models.AlertRequest{newAlertRequest(), newAlertRequest()}, "")
+			if err != nil {
+				return err
+			}
+			return ok(len(alerts) == 2 && alerts[0].ID == 11 && alerts[1].ID == 12, "CreateAlerts() = %v", alerts)
+		}},
+		{"ImportAlertsCSV", func(mock sqlmock.Sqlmock) {
+			expectUser(mock)
+			expectNewAlert(mock)
+			mock.ExpectBegin()
+			expectInsertAlert(mock, 13)
+			mock.ExpectCommit()
+		}, func(ctx context.Context, api *testAPI) error {
+			var csv bytes.Buffer
+			if err := services.WriteAlertsCSV(&csv, []*models.AlertRequest{newAlertRequest()}); err != nil {
+				return err
+			}
+			alerts, err := api.user.ImportAlertsCSV(ctx, &csv, "")
+			if err != nil {
+				return err
+			}
+			return ok(len(alerts) == 1 && alerts[0].ID == 13 && alerts[0].UserID == 1, "ImportAlertsCSV() = %v", alerts)
+		}},
+		{"ExportAlerts", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT .+ FROM alerts WHERE .+ status = ANY`).WillReturnRows(alertRows(testAlert(1)))
+		}, func(ctx context.Context, api *testAPI) error {
+			exported, err := api.admin.ExportAlerts(ctx, &models.AlertFilter{Symbol: "BTCUSDT"})
+			if err != nil {
+				return err
+			}
+			return ok(len(exported) == 1 && exported[0].Email == "ada@example.com" && exported[0].Status == "active",
+				"ExportAlerts() = %v", exported)
+		}},
+		{"ExportAlertsCSV", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT .+ FROM alerts WHERE .+ status = ANY`).WillReturnRows(alertRows(testAlert(1)))
+		}, func(ctx context.Context, api *testAPI) error {
+			csv, err := api.admin.ExportAlertsCSV(ctx, nil)
+			if err != nil {
+				return err
+			}
+			alerts, err := services.ReadAlertsCSV(bytes.NewReader(csv))
+			if err != nil {
+				return err
+			}
+			return ok(len(alerts) == 1 && alerts[0].Symbol == "BTCUSDT", "ExportAlertsCSV() = %s", csv)
+		}},
+		{"BacktestAlert", nil, func(ctx context.Context, api *testAPI) error {
+			result, err := api.admin.BacktestAlert(ctx, &models.BacktestRequest{
+				Symbol: "BTCUSDT", Interval: "1h", Indicator: "RSI", Direction: "UP", Value: 70,
+				StartTime: testTime.Add(-3 * time.Hour), EndTime: testTime,
+			})
+			if err != nil {
+				return err
+			}
+			return ok(result.Symbol == "BTCUSDT" && result.Klines == 3, "BacktestAlert() = %+v", result)
+		}},
+		{"GetAlert", func(mock sqlmock.Sqlmock) {
+			expectAlert(mock, testAlert(1))
+			expectAlert(mock, testAlert(1))
+		}, func(ctx context.Context, api *testAPI) error {
+			alert, err := api.admin.GetAlert(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(alert.ID == 1 && alert.Channels[0] == "email" && *alert.ContactID == 3, "GetAlert() = %+v", alert)
+		}},
+		{"UpdateAlert", func(mock sqlmock.Sqlmock) {
+			expectChangeAlert(mock, testAlert(1))
+			expectAlert(mock, testAlert(1))
+			expectNewAlert(mock)
+			updated := testAlert(1)
+			updated.Value = 75
+			mock.ExpectQuery(sqlPattern(`UPDATE alerts SET value = $2`)).WithArgs(1, 75.0, "UP", "RSI", "ada@example.com", "BTCUSDT",
+				sqlmock.AnyArg(), 3, "normal", true, 0, sqlmock.AnyArg()).WillReturnRows(alertRows(updated))
+		}, func(ctx context.Context, api *testAPI) error {
+			value := 75.0
+			alert, err := api.admin.UpdateAlert(ctx, 1, &models.AlertUpdate{Value: &value})
+			if err != nil {
+				return err
+			}
+			return ok(alert.Value == 75, "UpdateAlert() = %+v", alert)
+		}},
+		{"DeleteAlert", func(mock sqlmock.Sqlmock) {
+			expectChangeAlert(mock, testAlert(1))
+			mock.ExpectExec(sqlPattern(`DELETE FROM alerts WHERE id = $1`)).WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.DeleteAlert(ctx, 1)
+		}},
+		{"PauseAlert", func(mock sqlmock.Sqlmock) {
+			expectChangeAlert(mock, testAlert(1))
+			paused := testAlert(1)
+			paused.Status = "paused"
+			mock.ExpectQuery(sqlPattern(`UPDATE alerts SET status = 'paused'`)).WillReturnRows(alertRows(paused))
+		}, func(ctx context.Context, api *testAPI) error {
+			alert, err := api.admin.PauseAlert(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(alert.Status == "paused", "PauseAlert() = %+v", alert)
+		}},
+		{"ResumeAlert", func(mock sqlmock.Sqlmock) {
+			paused := testAlert(1)
+			paused.Status = "paused"
+			expectChangeAlert(mock, paused)
+			mock.ExpectQuery(sqlPattern(`UPDATE alerts SET status = 'active'`)).WillReturnRows(alertRows(testAlert(1)))
+		}, func(ctx context.Context, api *testAPI) error {
+			alert, err := api.admin.ResumeAlert(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(alert.Status == "active", "ResumeAlert() = %+v", alert)
+		}},
+		{"GetDeliveries", func(mock sqlmock.Sqlmock) {
+			expectAlert(mock, testAlert(1))
+			mock.ExpectQuery(sqlPattern(`FROM notification_outbox WHERE alert_id = $1`)).WithArgs(1).
+				WillReturnRows(deliveryRow(5, "delivered"))
+		}, func(ctx context.Context, api *testAPI) error {
+			deliveries, err := api.admin.GetDeliveries(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(len(deliveries) == 1 && deliveries[0].ID == 5 && deliveries[0].DedupeKey != "", "GetDeliveries() = %v", deliveries)
+		}},
+		{"RetryDelivery", func(mock sqlmock.Sqlmock) {
+			expectChangeAlert(mock, testAlert(1))
+			mock.ExpectBegin()
+			mock.ExpectExec(sqlPattern(`UPDATE notification_outbox SET status = 'pending'`)).WithArgs(5, 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(sqlPattern(`UPDATE alerts SET status = 'triggered'`)).WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.RetryDelivery(ctx, 1, 5)
+		}},
+		{"PreviewNotification", func(mock sqlmock.Sqlmock) {
+			expectAlert(mock, testAlert(1))
+			expectAlert(mock, testAlert(1))
+		}, func(ctx context.Context, api *testAPI) error {
+			msg, err := api.admin.PreviewNotification(ctx, 1, "email", "{{.Symbol}} crossed {{.Value}}")
+			if err != nil {
+				return err
+			}
+			return ok(msg.Subject == "BTCUSDT crossed 70.00" && msg.Text != "", "PreviewNotification() = %+v", msg)
+		}},
+		{"PreviewChart", func(mock sqlmock.Sqlmock) {
+			expectAlert(mock, testAlert(1))
+			expectAlert(mock, testAlert(1))
+		}, func(ctx context.Context, api *testAPI) error {
+			chart, err := api.admin.PreviewChart(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(bytes.HasPrefix(chart, []byte("\x89PNG")), "PreviewChart() is not a PNG")
+		}},
+		{"ListChannels", nil, func(ctx context.Context, api *testAPI) error {
+			channels, err := api.admin.ListChannels(ctx)
+			if err != nil {
+				return err
+			}
+			return ok(reflect.DeepEqual(channels, []string{"email", "webhook"}), "ListChannels() = %v", channels)
+		}},
+
+		{"CreateAPIKey", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`INSERT INTO users (id)`)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(sqlPattern(`INSERT INTO api_keys`)).WithArgs(1, "ci", sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "created_at", "last_used_at"}).
+					AddRow(4, 1, "ci", "pak_abcdef", testTime, nil))
+		}, func(ctx context.Context, api *testAPI) error {
+			key, secret, err := api.admin.CreateAPIKey(ctx, 1, "ci")
+			if err != nil {
+				return err
+			}
+			return ok(key.ID == 4 && key.Name == "ci" && strings.HasPrefix(secret, "pak_"), "CreateAPIKey() = %+v, %q", key, secret)
+		}},
+		{"GetAPIKeys", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`FROM api_keys WHERE user_id = $1`)).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "created_at", "last_used_at"}).
+					AddRow(4, 1, "ci", "pak_abcdef", testTime, testTime))
+		}, func(ctx context.Context, api *testAPI) error {
+			keys, err := api.admin.GetAPIKeys(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(len(keys) == 1 && keys[0].LastUsedAt != nil, "GetAPIKeys() = %v", keys)
+		}},
+		{"DeleteAPIKey", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`DELETE FROM api_keys WHERE id = $1 AND user_id = $2`)).WithArgs(4, 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.DeleteAPIKey(ctx, 1, 4)
+		}},
+		{"GetUserChannels", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`FROM user_channels WHERE user_id = $1`)).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "channel", "enabled"}).AddRow(1, "email", true))
+		}, func(ctx context.Context, api *testAPI) error {
+			channels, err := api.admin.GetUserChannels(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(len(channels) == 1 && channels[0].Channel == "email" && channels[0].Enabled, "GetUserChannels() = %v", channels)
+		}},
+		{"SetUserChannel", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`INSERT INTO user_channels`)).WithArgs(1, "webhook", false).WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			uc, err := api.admin.SetUserChannel(ctx, 1, "webhook", false)
+			if err != nil {
+				return err
+			}
+			return ok(uc.UserID == 1 && uc.Channel == "webhook" && !uc.Enabled, "SetUserChannel() = %+v", uc)
+		}},
+		{"DeleteUserChannel", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`DELETE FROM user_channels`)).WithArgs(1, "webhook").WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.DeleteUserChannel(ctx, 1, "webhook")
+		}},
+		{"CreateContact", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`INSERT INTO users (id)`)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(sqlPattern(`INSERT INTO contacts`)).WithArgs(1, "sms", "+15550100", sqlmock.AnyArg()).
+				WillReturnRows(contactRow(6, "sms", "+15550100"))
+		}, func(ctx context.Context, api *testAPI) error {
+			contact, err := api.admin.CreateContact(ctx, 1, "sms", " +15550100 ")
+			if err != nil {
+				return err
+			}
+			return ok(contact.ID == 6 && contact.Verified, "CreateContact() = %+v", contact)
+		}},
+		{"GetContacts", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`FROM contacts WHERE user_id = $1 ORDER BY id`)).WithArgs(1).
+				WillReturnRows(contactRow(6, "telegram", "12345"))
+		}, func(ctx context.Context, api *testAPI) error {
+			contacts, err := api.admin.GetContacts(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(len(contacts) == 1 && contacts[0].Address == "12345", "GetContacts() = %v", contacts)
+		}},
+		{"DeleteContact", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`DELETE FROM contacts WHERE id = $1 AND user_id = $2`)).WithArgs(6, 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.DeleteContact(ctx, 1, 6)
+		}},
+		{"ResendVerification", func(mock sqlmock.Sqlmock) {
+			// Sending needs an SMTP server, so only the not found response
+			// is checked
+			mock.ExpectQuery(sqlPattern(`UPDATE contacts SET verification_token = $1`)).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 6, 1).WillReturnRows(sqlmock.NewRows([]string{"address"}))
+		}, func(ctx context.Context, api *testAPI) error {
+			err := api.admin.ResendVerification(ctx, 1, 6)
+			var apiErr *client.APIError
+			return ok(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && apiErr.Code == "not_found",
+				"ResendVerification() = %v, want a not_found error", err)
+		}},
+		{"VerifyContact", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`UPDATE contacts SET verified_at = CURRENT_TIMESTAMP`)).WithArgs("token", sqlmock.AnyArg()).
+				WillReturnRows(contactRow(3, "email", "ada@example.com"))
+		}, func(ctx context.Context, api *testAPI) error {
+			contact, err := client.New(api.server.URL, "").VerifyContact(ctx, "token")
+			if err != nil {
+				return err
+			}
+			return ok(contact.ID == 3 && contact.Verified, "VerifyContact() = %+v", contact)
+		}},
+		{"CreateTelegramLink", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`INSERT INTO users (id)`)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(sqlPattern(`INSERT INTO telegram_link_codes`)).WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"expires_at"}).AddRow(testTime))
+		}, func(ctx context.Context, api *testAPI) error {
+			link, err := api.admin.CreateTelegramLink(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(link.Code != "" && link.Command == "/link "+link.Code && link.ExpiresAt.Equal(testTime), "CreateTelegramLink() = %+v", link)
+		}},
+		{"GetSuppressed", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`FROM notification_outbox WHERE user_id = $1 AND status = 'suppressed'`)).WithArgs(1, 10).
+				WillReturnRows(deliveryRow(7, services.DeliverySuppressed))
+		}, func(ctx context.Context, api *testAPI) error {
+			deliveries, err := api.admin.GetSuppressed(ctx, 1, 10)
+			if err != nil {
+				return err
+			}
+			return ok(len(deliveries) == 1 && deliveries[0].ID == 7, "GetSuppressed() = %v", deliveries)
+		}},
+		{"GetPreferences", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`SELECT time_zone, digest_mode`)).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"time_zone", "digest_mode", "digest_interval", "digest_hour", "quiet_start", "quiet_end"}).
+					AddRow("Europe/Berlin", services.DigestDaily, 0, 8, "22:00", "07:00"))
+		}, func(ctx context.Context, api *testAPI) error {
+			prefs, err := api.admin.GetPreferences(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(prefs.UserID == 1 && prefs.TimeZone == "Europe/Berlin" && prefs.QuietEnd == "07:00", "GetPreferences() = %+v", prefs)
+		}},
+		{"SetPreferences", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`INSERT INTO users (id, time_zone`)).
+				WithArgs(1, "Europe/Berlin", services.DigestDaily, 0, 8, "", "").WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			prefs, err := api.admin.SetPreferences(ctx, 1, &models.Preferences{TimeZone: "Europe/Berlin", DigestMode: services.DigestDaily, DigestHour: 8})
+			if err != nil {
+				return err
+			}
+			return ok(prefs.UserID == 1 && prefs.DigestHour == 8, "SetPreferences() = %+v", prefs)
+		}},
+		{"GetSubject", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`SELECT subject_template FROM users WHERE id = $1`)).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"subject_template"}).AddRow(nil))
+		}, func(ctx context.Context, api *testAPI) error {
+			subject, err := api.admin.GetSubject(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(subject == services.DefaultSubject, "GetSubject() = %q", subject)
+		}},
+		{"SetSubject", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`INSERT INTO users (id, subject_template)`)).WithArgs(1, "{{.Symbol}} alert").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.SetSubject(ctx, 1, "{{.Symbol}} alert")
+		}},
+		{"DeleteSubject", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`INSERT INTO users (id, subject_template)`)).WithArgs(1, nil).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.DeleteSubject(ctx, 1)
+		}},
+		{"CreateWebhook", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`INSERT INTO webhooks`)).WithArgs(1, nil, "https://203.0.113.7/hook", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(8, testTime))
+		}, func(ctx context.Context, api *testAPI) error {
+			hook, err := api.admin.CreateWebhook(ctx, 1, &models.Webhook{URL: "https://203.0.113.7/hook"})
+			if err != nil {
+				return err
+			}
+			return ok(hook.ID == 8 && strings.HasPrefix(hook.Secret, "whsec_"), "CreateWebhook() = %+v", hook)
+		}},
+		{"CreateWebhook private address", nil, func(ctx context.Context, api *testAPI) error {
+			_, err := api.admin.CreateWebhook(ctx, 1, &models.Webhook{URL: "http://169.254.169.254/latest/meta-data"})
+			var apiErr *client.APIError
+			return ok(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest,
+				"CreateWebhook() = %v, want a 400 error", err)
+		}},
+		{"GetWebhooks", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`FROM webhooks WHERE user_id = $1`)).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "alert_id", "url", "created_at"}).
+					AddRow(8, 1, nil, "https://203.0.113.7/hook", testTime))
+		}, func(ctx context.Context, api *testAPI) error {
+			hooks, err := api.admin.GetWebhooks(ctx, 1)
+			if err != nil {
+				return err
+			}
+			return ok(len(hooks) == 1 && hooks[0].URL == "https://203.0.113.7/hook" && hooks[0].Secret == "", "GetWebhooks() = %v", hooks)
+		}},
+		{"DeleteWebhook", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`DELETE FROM webhooks WHERE id = $1 AND user_id = $2`)).WithArgs(8, 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.DeleteWebhook(ctx, 1, 8)
+		}},
+
+		{"CreateTeam", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(sqlPattern(`INSERT INTO users (id)`)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectBegin()
+			mock.ExpectQuery(sqlPattern(`INSERT INTO teams (name)`)).WithArgs("Desk").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(2, testTime))
+			mock.ExpectExec(sqlPattern(`INSERT INTO team_members`)).WithArgs(2, 1, services.RoleOwner).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}, func(ctx context.Context, api *testAPI) error {
+			team, err := api.admin.CreateTeam(ctx, "Desk", 1)
+			if err != nil {
+				return err
+			}
+			return ok(team.ID == 2 && team.Role == services.RoleOwner, "CreateTeam() = %+v", team)
+		}},
+		{"ListTeams", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(sqlPattern(`SELECT t.id, t.name`)).WithArgs(true, 0).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "role", "created_at"}).AddRow(2, "Desk", "", testTime))
+		}, func(ctx context.Context, api *testAPI) error {
+			teams, err := api.admin.ListTeams(ctx)
+			if err != nil {
+				return err
+			}
+			return ok(len(teams) == 1 && teams[0].Name == "Desk", "ListTeams() = %v", teams)
+		}},
+		{"GetTeam", func(mock sqlmock.Sqlmock) {
+			expectRole(mock)
+			expectRole(mock)
+			mock.ExpectQuery(sqlPattern(`SELECT name, created_at FROM teams WHERE id = $1`)).WithArgs(2).
+				WillReturnRows(sqlmock.NewRows([]string{"name", "created_at"}).AddRow("Desk", testTime))
+			mock.ExpectQuery(sqlPattern(`FROM team_members WHERE team_id = $1 ORDER BY user_id`)).WithArgs(2).
+				WillReturnRows(sqlmock.NewRows([]string{"team_id", "user_id", "role", "created_at"}).AddRow(2, 1, services.RoleOwner, testTime))
+		}, func(ctx context.Context, api *testAPI) error {
+			team, err := api.admin.GetTeam(ctx, 2)
+			if err != nil {
+				return err
+			}
+			return ok(team.Name == "Desk" && len(team.Members) == 1 && team.Members[0].UserID == 1, "GetTeam() = %+v", team)
+		}},
+		{"DeleteTeam", func(mock sqlmock.Sqlmock) {
+			expectRole(mock)
+			mock.ExpectExec(sqlPattern(`DELETE FROM teams WHERE id = $1`)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.DeleteTeam(ctx, 2)
+		}},
+		{"SetTeamMember", func(mock sqlmock.Sqlmock) {
+			expectRole(mock)
+			mock.ExpectExec(sqlPattern(`INSERT INTO users (id)`)).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectBegin()
+			mock.ExpectExec(sqlPattern(`SELECT 1 FROM teams WHERE id = $1 FOR UPDATE`)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(sqlPattern(`INSERT INTO team_members`)).WithArgs(2, 5, services.RoleEditor).
+				WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(testTime))
+			expectOwners(mock)
+			mock.ExpectCommit()
+		}, func(ctx context.Context, api *testAPI) error {
+			member, err := api.admin.SetTeamMember(ctx, 2, 5, services.RoleEditor)
+			if err != nil {
+				return err
+			}
+			return ok(member.TeamID == 2 && member.UserID == 5 && member.Role == services.RoleEditor, "SetTeamMember() = %+v", member)
+		}},
+		{"RemoveTeamMember", func(mock sqlmock.Sqlmock) {
+			expectRole(mock)
+			mock.ExpectBegin()
+			mock.ExpectExec(sqlPattern(`SELECT 1 FROM teams WHERE id = $1 FOR UPDATE`)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(sqlPattern(`DELETE FROM team_members`)).WithArgs(2, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(sqlPattern(`DELETE FROM team_routes`)).WithArgs(2, 5).WillReturnResult(sqlmock.NewResult(0, 0))
+			expectOwners(mock)
+			mock.ExpectCommit()
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.RemoveTeamMember(ctx, 2, 5)
+		}},
+		{"GetTeamRoutes", func(mock sqlmock.Sqlmock) {
+			expectRole(mock)
+			mock.ExpectQuery(sqlPattern(`FROM team_routes r JOIN contacts c ON c.id = r.contact_id WHERE r.team_id = $1`)).WithArgs(2).
+				WillReturnRows(routeRow(9))
+		}, func(ctx context.Context, api *testAPI) error {
+			routes, err := api.admin.GetTeamRoutes(ctx, 2)
+			if err != nil {
+				return err
+			}
+			return ok(len(routes) == 1 && routes[0].ContactID == 6 && routes[0].Verified, "GetTeamRoutes() = %v", routes)
+		}},
+		{"AddTeamRoute", func(mock sqlmock.Sqlmock) {
+			expectRole(mock)
+			mock.ExpectQuery(sqlPattern(`SELECT c.user_id FROM contacts c`)).WithArgs(6, 2).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+			mock.ExpectQuery(sqlPattern(`INSERT INTO team_routes`)).WithArgs(2, 6).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+			mock.ExpectQuery(sqlPattern(`WHERE r.id = $1`)).WithArgs(9).WillReturnRows(routeRow(9))
+		}, func(ctx context.Context, api *testAPI) error {
+			route, err := api.admin.AddTeamRoute(ctx, 2, 6)
+			if err != nil {
+				return err
+			}
+			return ok(route.ID == 9 && route.Address == "12345", "AddTeamRoute() = %+v", route)
+		}},
+		{"DeleteTeamRoute", func(mock sqlmock.Sqlmock) {
+			expectRole(mock)
+			mock.ExpectExec(sqlPattern(`DELETE FROM team_routes WHERE id = $1 AND team_id = $2`)).WithArgs(9, 2).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}, func(ctx context.Context, api *testAPI) error {
+			return api.admin.DeleteTeamRoute(ctx, 2, 9)
+		}},
+
+		{"ListSymbols", nil, func(ctx context.Context, api *testAPI) error {
+			symbols, err := api.admin.ListSymbols(ctx)
+			if err != nil {
+				return err
+			}
+			return ok(len(symbols) == 1 && symbols[0].Symbol == "BTCUSDT" && symbols[0].Klines == 60 && symbols[0].Price != nil,
+				"ListSymbols() = %v", symbols)
+		}},
+		{"GetPrice", nil, func(ctx context.Context, api *testAPI) error {
+			price, err := api.admin.GetPrice(ctx, "btcusdt")
+			if err != nil {
+				return err
+			}
+			return ok(price.Symbol == "BTCUSDT" && price.Price > 0, "GetPrice() = %+v", price)
+		}},
+		{"GetKlines", nil, func(ctx context.Context, api *testAPI) error {
+			klines, err := api.admin.GetKlines(ctx, "BTCUSDT", "1h", 2)
+			if err != nil {
+				return err
+			}
+			return ok(klines.Interval == "1h" && len(klines.Klines) == 2 && klines.Klines[1].Close == 60400, "GetKlines() = %+v", klines)
+		}},
+		{"GetIndicators", nil, func(ctx context.Context, api *testAPI) error {
+			indicators, err := api.admin.GetIndicators(ctx, "BTCUSDT", "", "RSI", "7")
+			if err != nil {
+				return err
+			}
+			return ok(len(indicators.Indicators) == 1 && indicators.Indicators[0].Ready && indicators.Indicators[0].Params[0] == 7,
+				"GetIndicators() = %+v", indicators)
+		}},
+	}
+}
+
+// rawCalls call the operations the client does not cover.
+func rawCalls() []apiCall {
+	return []apiCall{
+		{"getOpenAPI", nil, func(ctx context.Context, api *testAPI) error {
+			var spec struct {
+				OpenAPI string                 `json:"openapi"`
+				Paths   map[string]interface{} `json:"paths"`
+			}
+			if err := getJSON(api.server.URL+"/openapi.json", &spec); err != nil {
+				return err
+			}
+			return ok(spec.OpenAPI == "3.0.3" && spec.Paths["/alerts/{id}"] != nil, "unexpected specification %+v", spec)
+		}},
+		{"slackInteraction", nil, func(ctx context.Context, api *testAPI) error {
+			body := url.Values{"payload": {`{"type":"block_actions","actions":[]}`}}.Encode()
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(testSlackSecret))
+			fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+
+			req, _ := http.NewRequest(http.MethodPost, api.server.URL+"/integrations/slack/interactions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+			req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			return ok(resp.StatusCode == http.StatusOK, "Slack interaction responded %s", resp.Status)
+		}},
+		{"discordInteraction", nil, func(ctx context.Context, api *testAPI) error {
+			body := `{"type":1}`
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			signature := ed25519.Sign(api.discordKey, []byte(timestamp+body))
+
+			req, _ := http.NewRequest(http.MethodPost, api.server.URL+"/integrations/discord/interactions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Signature-Timestamp", timestamp)
+			req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(signature))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			var pong struct {
+				Type int `json:"type"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&pong); err != nil {
+				return err
+			}
+			return ok(resp.StatusCode == http.StatusOK && pong.Type == 1, "Discord ping got %s %+v", resp.Status, pong)
+		}},
+	}
+}
+
+func getJSON(url string, out interface{}) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+func createContact(contactService *services.ContactService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		req := new(models.Contact)
+		if err := c.Bind(req); err != nil {
+			return bindError(c, err, "Invalid contact data")
+		}
+
+		contact, err := contactService.CreateContact(userID, req.Channel, req.Address)
+		if errors.Is(err, services.ErrInvalidContact) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error creating contact: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to create contact")
+		}
+
+		return c.JSON(http.StatusCreated, contact)
+	}
+}
+
+func getContacts(contactService *services.ContactService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		contacts, err := contactService.GetContacts(userID)
+		if err != nil {
+			log.Printf("Error fetching contacts: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch contacts")
+		}
+		if contacts == nil {
+			contacts = []*models.Contact{}
+		}
+
+		return c.JSON(http.StatusOK, contacts)
+	}
+}
+
+func deleteContact(contactService *services.ContactService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		id, err := strconv.Atoi(c.Param("contactId"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid contact ID")
+		}
+
+		if err := contactService.DeleteContact(userID, id); err != nil {
+			log.Printf("Error deleting contact: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to delete contact")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func resendVerification(contactService *services.ContactService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		id, err := strconv.Atoi(c.Param("contactId"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid contact ID")
+		}
+
+		err = contactService.SendVerification(userID, id)
+		if errors.Is(err, services.ErrContactNotFound) {
+			return errorJSON(c, http.StatusNotFound, "No unverified email contact with this ID")
+		}
+		if err != nil {
+			log.Printf("Error sending verification: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to send verification")
+		}
+
+		return c.NoContent(http.StatusAccepted)
+	}
+}
+
+func verifyContact(contactService *services.ContactService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		contact, err := contactService.VerifyContact(c.QueryParam("token"))
+		if errors.Is(err, services.ErrInvalidToken) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error verifying contact: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to verify contact")
+		}
+
+		return c.JSON(http.StatusOK, contact)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+// errorCodes are the machine readable codes of error responses by status
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusUnprocessableEntity:   "unprocessable",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "upstream_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// codeValidationFailed is the code of responses with field errors
+const codeValidationFailed = "validation_failed"
+
+// apiError is the body of every error response:
+// {"error": {"code": ..., "message": ..., "details": [...]}}
+type apiError struct {
+	Code    string                `json:"code"`
+	Message string                `json:"message"`
+	Details []services.FieldError `json:"details,omitempty"`
+}
+
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "invalid_request"
+}
+
+// errorJSON writes an error response with the status's code.
+func errorJSON(c echo.Context, status int, message string) error {
+	return c.JSON(status, map[string]apiError{"error": {Code: errorCode(status), Message: message}})
+}
+
+// validationJSON writes the field errors of a request.
+func validationJSON(c echo.Context, verr *services.ValidationError) error {
+	return c.JSON(http.StatusBadRequest, map[string]apiError{"error": {
+		Code:    codeValidationFailed,
+		Message: "The request has invalid fields",
+		Details: verr.Fields,
+	}})
+}
+
+// bindError reports a request body that could not be decoded, naming the
+// field if a value had the wrong type.
+func bindError(c echo.Context, err error, message string) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		verr := &services.ValidationError{}
+		field := listIndex.ReplaceAllString(typeErr.Field, "[$1]")
+		verr.Add(field, "must be a %s", jsonType(typeErr.Type.Kind().String()))
+		return validationJSON(c, verr)
+	}
+	return errorJSON(c, http.StatusBadRequest, message)
+}
+
+// listIndex matches the list indexes of decoding error fields, e.g. the
+// ".0" of "alerts.0.value", which are named like field errors: "alerts[0].value"
+var listIndex = regexp.MustCompile(`\.(\d+)\b`)
+
+// jsonType names Go kinds as JSON types
+func jsonType(kind string) string {
+	switch kind {
+	case "int", "int64", "float64", "uint", "uint64":
+		return "number"
+	case "slice", "array":
+		return "list"
+	case "struct", "map":
+		return "object"
+	case "bool":
+		return "boolean"
+	default:
+		return kind
+	}
+}
+
+// handleError writes the errors handlers return, and echo's own such as
+// unknown routes, in the error envelope.
+func handleError(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	message := "Internal server error"
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		status = he.Code
+		message = fmt.Sprint(he.Message)
+	} else {
+		log.Printf("Error handling %s %s: %v", c.Request().Method, c.Request().URL.Path, err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = errorJSON(c, status, message)
+	}
+	if err != nil {
+		log.Printf("Error writing error response: %v", err)
+	}
+}
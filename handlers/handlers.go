@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -11,31 +13,122 @@ import (
 	"price-alert-system/services"
 )
 
-func RegisterRoutes(e *echo.Echo, alertService *services.AlertService) {
-	e.POST("/alerts", createAlert(alertService))
-	e.GET("/alerts/:id", getAlert(alertService))
+// Services are the services the routes are served by.
+type Services struct {
+	Alerts       *services.AlertService
+	Backtest     *services.BacktestService
+	Dispatcher   *services.Dispatcher
+	Webhooks     *services.WebhookNotifier
+	Outbox       *services.Outbox
+	Contacts     *services.ContactService
+	Renderer     *services.Renderer
+	Preferences  *services.PreferenceService
+	Hub          *services.Hub
+	Auth         *services.Authenticator
+	Teams        *services.TeamService
+	TelegramBot  *services.TelegramBot
+	Interactions *services.Interactions
+	Idempotency  *services.IdempotencyStore
+	MarketData   *services.MarketDataService
+}
+
+func RegisterRoutes(e *echo.Echo, s *Services) {
+	e.HTTPErrorHandler = handleError
+
+	// Contact verification and message actions are authenticated by their
+	// own tokens and signatures
+	e.Use(authenticate(s.Auth, "/openapi.json", "/contacts/verify", "/integrations/slack/interactions", "/integrations/discord/interactions"))
+	e.GET("/openapi.json", getOpenAPI())
+	e.GET("/contacts/verify", verifyContact(s.Contacts))
+	e.POST("/integrations/slack/interactions", slackInteraction(s.Interactions))
+	e.POST("/integrations/discord/interactions", discordInteraction(s.Interactions))
+
+	canView := requireAlert(s.Alerts, false)
+	canChange := requireAlert(s.Alerts, true)
+
+	e.GET("/alerts", listAlerts(s.Alerts))
+	e.POST("/alerts", createAlert(s.Alerts), idempotent(s.Idempotency))
+	e.POST("/alerts/bulk", bulkCreateAlerts(s.Alerts), idempotent(s.Idempotency))
+	e.GET("/alerts/export", exportAlerts(s.Alerts))
+	e.POST("/alerts/backtest", backtestAlert(s.Backtest))
+	e.GET("/alerts/:id", getAlert(s.Alerts), canView)
+	e.PATCH("/alerts/:id", updateAlert(s.Alerts), canChange)
+	e.DELETE("/alerts/:id", deleteAlert(s.Alerts), canChange)
+	e.POST("/alerts/:id/pause", changeAlertState(s.Alerts, s.Alerts.PauseAlert, "pause"), canChange)
+	e.POST("/alerts/:id/resume", changeAlertState(s.Alerts, s.Alerts.ResumeAlert, "resume"), canChange)
+	e.GET("/alerts/:id/deliveries", getDeliveries(s.Outbox), canView)
+	e.POST("/alerts/:id/deliveries/:deliveryId/retry", retryDelivery(s.Outbox), canChange)
+	e.GET("/alerts/:id/preview", previewNotification(s.Alerts, s.Dispatcher, s.Renderer), canView)
+	e.GET("/alerts/:id/chart", previewChart(s.Alerts), canView)
+
+	e.GET("/stream", streamEvents(s.Hub))
+	e.GET("/ws", websocketEvents(s.Hub))
+
+	e.GET("/channels", listChannels(s.Dispatcher))
+
+	e.GET("/symbols", listSymbols(s.MarketData))
+	e.GET("/symbols/:symbol/price", getPrice(s.MarketData))
+	e.GET("/symbols/:symbol/klines", getKlines(s.MarketData))
+	e.GET("/symbols/:symbol/indicators", getIndicators(s.MarketData))
+
+	member := requireTeam(s.Teams, services.RoleViewer)
+	owner := requireTeam(s.Teams, services.RoleOwner)
+
+	e.POST("/teams", createTeam(s.Teams))
+	e.GET("/teams", listTeams(s.Teams))
+	e.GET("/teams/:id", getTeam(s.Teams), member)
+	e.DELETE("/teams/:id", deleteTeam(s.Teams), owner)
+	e.PUT("/teams/:id/members/:userId", setTeamMember(s.Teams), owner)
+	e.DELETE("/teams/:id/members/:userId", removeTeamMember(s.Teams), member)
+	e.GET("/teams/:id/routes", getTeamRoutes(s.Teams), member)
+	e.POST("/teams/:id/routes", addTeamRoute(s.Teams), owner)
+	e.DELETE("/teams/:id/routes/:routeId", deleteTeamRoute(s.Teams), owner)
+
+	users := e.Group("/users/:id", requireUser)
+
+	users.POST("/api-keys", createAPIKey(s.Auth))
+	users.GET("/api-keys", getAPIKeys(s.Auth))
+	users.DELETE("/api-keys/:keyId", deleteAPIKey(s.Auth))
+
+	users.GET("/channels", getUserChannels(s.Dispatcher))
+	users.PUT("/channels/:channel", setUserChannel(s.Dispatcher))
+	users.DELETE("/channels/:channel", deleteUserChannel(s.Dispatcher))
+
+	users.POST("/contacts", createContact(s.Contacts))
+	users.GET("/contacts", getContacts(s.Contacts))
+	users.DELETE("/contacts/:contactId", deleteContact(s.Contacts))
+	users.POST("/contacts/:contactId/verification", resendVerification(s.Contacts))
+
+	users.POST("/telegram/link", createTelegramLink(s.TelegramBot))
+
+	users.GET("/suppressed", getSuppressed(s.Outbox))
+	users.GET("/preferences", getPreferences(s.Preferences))
+	users.PUT("/preferences", setPreferences(s.Preferences))
+
+	users.GET("/subject", getSubject(s.Renderer))
+	users.PUT("/subject", setSubject(s.Renderer))
+	users.DELETE("/subject", deleteSubject(s.Renderer))
+
+	users.POST("/webhooks", createWebhook(s.Webhooks, s.Alerts))
+	users.GET("/webhooks", getWebhooks(s.Webhooks))
+	users.DELETE("/webhooks/:webhookId", deleteWebhook(s.Webhooks))
 }
 
 func createAlert(alertService *services.AlertService) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		reqAlert := new(models.AlertRequest)
 		if err := c.Bind(reqAlert); err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid alert data"})
+			return bindError(c, err, "Invalid alert data")
 		}
 
-		log.Println(reqAlert)
-
-		alert := &models.Alert{
-			UserID:    reqAlert.UserID,
-			Value:     reqAlert.Value,
-			Direction: reqAlert.Direction,
-			Indicator: reqAlert.Indicator,
-			Email:     reqAlert.Email,
-			Status:    "pending",
-		}
-		err := alertService.CreateAlert(alert)
+		userID, err := actingUser(c, reqAlert.UserID)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create alert"})
+			return err
+		}
+
+		alert := alertFromRequest(userID, reqAlert)
+		if err := alertService.CreateAlert(principal(c), alert); err != nil {
+			return alertError(c, err, "Failed to create alert")
 		}
 
 		return c.JSON(http.StatusCreated, alert)
@@ -46,14 +139,108 @@ func getAlert(alertService *services.AlertService) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid alert ID"})
+			return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
 		}
 
-		alert, err := alertService.GetAlert(id)
+		alert, err := alertService.GetAlert(principal(c), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errorJSON(c, http.StatusNotFound, "Alert not found")
+		}
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch alert"})
+			log.Printf("Error fetching alert %d: %v", id, err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch alert")
 		}
 
 		return c.JSON(http.StatusOK, alert)
 	}
 }
+
+func backtestAlert(backtestService *services.BacktestService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(models.BacktestRequest)
+		if err := c.Bind(req); err != nil {
+			return bindError(c, err, "Invalid backtest data")
+		}
+
+		result, err := backtestService.Backtest(req)
+		if errors.Is(err, services.ErrInvalidBacktest) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error running backtest: %v", err)
+			return errorJSON(c, http.StatusBadGateway, "Failed to run backtest")
+		}
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func getDeliveries(outbox *services.Outbox) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
+		}
+
+		deliveries, err := outbox.GetDeliveries(id)
+		if err != nil {
+			log.Printf("Error fetching deliveries: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch deliveries")
+		}
+		if deliveries == nil {
+			deliveries = []*models.Delivery{}
+		}
+
+		return c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+func getSuppressed(outbox *services.Outbox) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		limit := 100
+		if param := c.QueryParam("limit"); param != "" {
+			if limit, err = strconv.Atoi(param); err != nil || limit < 1 || limit > 1000 {
+				return errorJSON(c, http.StatusBadRequest, "Invalid limit")
+			}
+		}
+
+		deliveries, err := outbox.GetSuppressed(userID, limit)
+		if err != nil {
+			log.Printf("Error fetching suppressed deliveries: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch suppressed notifications")
+		}
+		if deliveries == nil {
+			deliveries = []*models.Delivery{}
+		}
+
+		return c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+func retryDelivery(outbox *services.Outbox) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
+		}
+		deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid delivery ID")
+		}
+
+		ok, err := outbox.RetryDelivery(id, deliveryID)
+		if err != nil {
+			log.Printf("Error retrying delivery: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to retry delivery")
+		}
+		if !ok {
+			return errorJSON(c, http.StatusNotFound, "No dead-lettered delivery with this ID")
+		}
+
+		return c.NoContent(http.StatusAccepted)
+	}
+}
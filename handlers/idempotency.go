@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotentReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = maxBulkBody
+)
+
+// idempotent lets clients retry requests safely by passing an
+// Idempotency-Key header: the first request with a key runs, and retries
+// with the same key and body get its response again without running.
+// Reusing a key for a different request is a conflict. Server errors are
+// not stored, so a retry after one runs again.
+func idempotent(idem *services.IdempotencyStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(headerIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+			if !validIdempotencyKey(key) {
+				return errorJSON(c, http.StatusBadRequest,
+					fmt.Sprintf("%s must be 1 to %d printable ASCII characters", headerIdempotencyKey, maxIdempotencyKeyLength))
+			}
+
+			req := c.Request()
+			body, err := io.ReadAll(http.MaxBytesReader(c.Response(), req.Body, maxIdempotentRequestBytes))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return errorJSON(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("The body must be at most %d bytes", maxIdempotentRequestBytes))
+			}
+			if err != nil {
+				return errorJSON(c, http.StatusBadRequest, "Failed to read the request body")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			scope := idempotencyScope(principal(c))
+			fingerprint := requestFingerprint(req, body)
+			stored, err := idem.Begin(scope, key, fingerprint)
+			switch {
+			case errors.Is(err, services.ErrIdempotencyMismatch):
+				return errorJSON(c, http.StatusConflict, "The Idempotency-Key was already used for a different request")
+			case errors.Is(err, services.ErrIdempotencyInProgress):
+				return errorJSON(c, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+			case err != nil:
+				log.Printf("Error claiming idempotency key: %v", err)
+				return errorJSON(c, http.StatusInternalServerError, "Failed to check the Idempotency-Key")
+			case stored != nil:
+				c.Response().Header().Set(headerIdempotentReplayed, "true")
+				return c.Blob(stored.Status, stored.ContentType, stored.Body)
+			}
+
+			res := c.Response()
+			capture := &capturingWriter{ResponseWriter: res.Writer}
+			res.Writer = capture
+			if err := next(c); err != nil {
+				// Write errors now so their response is stored too
+				c.Error(err)
+			}
+			res.Writer = capture.ResponseWriter
+
+			if res.Status >= http.StatusInternalServerError {
+				if err := idem.Release(scope, key); err != nil {
+					log.Printf("Error releasing idempotency key: %v", err)
+				}
+				return nil
+			}
+			err = idem.Complete(scope, key, &services.StoredResponse{
+				Status:      res.Status,
+				ContentType: res.Header().Get(echo.HeaderContentType),
+				Body:        capture.body.Bytes(),
+			})
+			if err != nil {
+				log.Printf("Error storing idempotent response: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
+// validIdempotencyKey reports whether a key is 1 to maxIdempotencyKeyLength
+// printable ASCII characters
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyScope separates the keys of different callers
+func idempotencyScope(p *services.Principal) string {
+	if p.Admin {
+		return "admin"
+	}
+	return "user:" + strconv.Itoa(p.UserID)
+}
+
+// requestFingerprint identifies a request by its route, content type and body
+func requestFingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n%s\n", req.Method, req.URL.Path, req.Header.Get(echo.HeaderContentType))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// capturingWriter keeps a copy of the response body
+type capturingWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
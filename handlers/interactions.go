@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+// maxInteractionSize bounds interaction request bodies
+const maxInteractionSize = 1 << 20
+
+// slackInteraction handles the buttons of Slack alert messages. The
+// signature covers the raw body, so it is read before parsing the form.
+func slackInteraction(interactions *services.Interactions) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxInteractionSize))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid request body")
+		}
+		header := c.Request().Header
+		if err := interactions.VerifySlack(header.Get("X-Slack-Request-Timestamp"), header.Get("X-Slack-Signature"), body); err != nil {
+			return errorJSON(c, http.StatusUnauthorized, err.Error())
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid request body")
+		}
+		if err := interactions.HandleSlack([]byte(form.Get("payload"))); err != nil {
+			log.Printf("Error handling Slack interaction: %v", err)
+			return errorJSON(c, http.StatusBadRequest, "Invalid interaction payload")
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// discordInteraction handles the buttons of Discord alert messages and the
+// pings Discord sends to check the endpoint.
+func discordInteraction(interactions *services.Interactions) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxInteractionSize))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid request body")
+		}
+		header := c.Request().Header
+		if err := interactions.VerifyDiscord(header.Get("X-Signature-Timestamp"), header.Get("X-Signature-Ed25519"), body); err != nil {
+			return errorJSON(c, http.StatusUnauthorized, err.Error())
+		}
+
+		response, err := interactions.HandleDiscord(body)
+		if err != nil {
+			log.Printf("Error handling Discord interaction: %v", err)
+			return errorJSON(c, http.StatusBadRequest, "Invalid interaction")
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+// marketError writes the response for an error of a market data query,
+// logging unexpected errors.
+func marketError(c echo.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrUnknownSymbol):
+		return errorJSON(c, http.StatusNotFound, "Symbol "+c.Param("symbol")+" is not tracked")
+	case errors.Is(err, services.ErrNoMarketData):
+		return errorJSON(c, http.StatusServiceUnavailable, "No trades received for "+c.Param("symbol")+" yet")
+	case errors.Is(err, services.ErrInvalidMarketQuery):
+		return errorJSON(c, http.StatusBadRequest, err.Error())
+	}
+	log.Printf("%s: %v", message, err)
+	return errorJSON(c, http.StatusBadGateway, message)
+}
+
+func listSymbols(marketData *services.MarketDataService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, marketData.Symbols())
+	}
+}
+
+func getPrice(marketData *services.MarketDataService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		price, err := marketData.Price(c.Param("symbol"))
+		if err != nil {
+			return marketError(c, err, "Failed to fetch price")
+		}
+
+		return c.JSON(http.StatusOK, price)
+	}
+}
+
+// getKlines returns the live klines, or with interval the exchange's.
+func getKlines(marketData *services.MarketDataService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		limit := 0
+		if s := c.QueryParam("limit"); s != "" {
+			var err error
+			if limit, err = strconv.Atoi(s); err != nil {
+				return errorJSON(c, http.StatusBadRequest, "limit must be an integer")
+			}
+		}
+
+		klines, err := marketData.Klines(c.Param("symbol"), c.QueryParam("interval"), limit)
+		if err != nil {
+			return marketError(c, err, "Failed to fetch klines")
+		}
+
+		return c.JSON(http.StatusOK, klines)
+	}
+}
+
+// getIndicators returns the live indicators, or with interval those of the
+// exchange's klines.
+func getIndicators(marketData *services.MarketDataService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		indicators, err := marketData.Indicators(c.Param("symbol"), c.QueryParam("interval"), c.QueryParam("name"), c.QueryParam("params"))
+		if err != nil {
+			return marketError(c, err, "Failed to fetch indicators")
+		}
+
+		return c.JSON(http.StatusOK, indicators)
+	}
+}
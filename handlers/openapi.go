@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+// apiVersion is the version of the API in the OpenAPI specification
+const apiVersion = "1.0.0"
+
+// param is a query or header parameter of an operation. Path parameters are
+// taken from the path.
+type param struct {
+	name, in, typ, description string
+}
+
+func query(name, typ, description string) param {
+	return param{name: name, in: "query", typ: typ, description: description}
+}
+
+// operation documents a route in the OpenAPI specification. request and
+// response are values of the types of the JSON bodies, nil for none.
+type operation struct {
+	method, path string
+	id, summary  string
+	params       []param
+	request      interface{}
+	response     interface{}
+	// status defaults to 200 with a response and 204 without
+	status int
+	// requestContent and responseContent replace the JSON content type
+	requestContent  string
+	responseContent string
+	// requestCSV and responseCSV accept or return CSV as well as JSON
+	requestCSV  bool
+	responseCSV bool
+	public      bool
+}
+
+// stringPathParams are the path parameters that are not IDs
+var stringPathParams = map[string]bool{"symbol": true, "channel": true}
+
+var alertFilterParams = []param{
+	query("user_id", "integer", "Only alerts created by this user"),
+	query("team_id", "integer", "Only alerts of this team"),
+	query("symbol", "string", "Only alerts of this symbol"),
+	query("indicator", "string", "Only alerts on this indicator"),
+	query("status", "string", "Comma separated statuses"),
+	query("created_after", "string", "RFC 3339 time or YYYY-MM-DD"),
+	query("created_before", "string", "RFC 3339 time or YYYY-MM-DD"),
+}
+
+var idempotencyKeyParam = param{
+	name:        headerIdempotencyKey,
+	in:          "header",
+	typ:         "string",
+	description: "Retries with the same key return the first response instead of creating the alerts again",
+}
+
+var streamParams = []param{
+	query("user_id", "integer", "User to stream, required with the admin key"),
+	query("symbols", "string", "Comma separated symbols of indicator updates"),
+	query("indicators", "boolean", "Also send indicator updates"),
+	query("access_token", "string", "API key or JWT, for clients that cannot set headers"),
+}
+
+// Bodies of operations that have no model of their own, used by the
+// handlers and the specification alike
+type (
+	alertRequests struct {
+		Alerts []*models.AlertRequest `json:"alerts"`
+	}
+	alertList struct {
+		Alerts []*models.Alert `json:"alerts"`
+	}
+	channelList struct {
+		Channels []string `json:"channels"`
+	}
+	teamRequest struct {
+		Name   string `json:"name"`
+		UserID int    `json:"user_id,omitempty"`
+	}
+	memberRequest struct {
+		Role string `json:"role"`
+	}
+	routeRequest struct {
+		ContactID int `json:"contact_id"`
+	}
+	apiKeyRequest struct {
+		Name string `json:"name"`
+	}
+	newAPIKey struct {
+		*models.APIKey
+		Key string `json:"key"`
+	}
+	slackForm struct {
+		Payload string `json:"payload"`
+	}
+)
+
+// operations documents every route RegisterRoutes registers. The tests fail
+// when they differ, or when a handler binds or returns another body.
+var operations = []operation{
+	{method: http.MethodGet, path: "/openapi.json", id: "getOpenAPI", summary: "This OpenAPI specification",
+		response: map[string]interface{}{}, public: true},
+
+	{method: http.MethodGet, path: "/contacts/verify", id: "verifyContact", summary: "Verify a contact with the token sent to it",
+		params: []param{query("token", "string", "Verification token")}, response: models.Contact{}, public: true},
+	{method: http.MethodPost, path: "/integrations/slack/interactions", id: "slackInteraction", summary: "Handle a Slack message button",
+		request: slackForm{}, requestContent: "application/x-www-form-urlencoded", public: true, status: http.StatusOK},
+	{method: http.MethodPost, path: "/integrations/discord/interactions", id: "discordInteraction", summary: "Handle a Discord message button",
+		request: map[string]interface{}{}, response: map[string]interface{}{}, public: true},
+
+	{method: http.MethodGet, path: "/alerts", id: "listAlerts", summary: "List alerts a page at a time",
+		params: append(append([]param(nil), alertFilterParams...),
+			query("sort", "string", "Field to sort by"),
+			query("order", "string", "asc or desc"),
+			query("cursor", "string", "next_cursor of the previous page"),
+			query("limit", "integer", "Page size")),
+		response: models.AlertPage{}},
+	{method: http.MethodPost, path: "/alerts", id: "createAlert", summary: "Create an alert",
+		params: []param{idempotencyKeyParam}, request: models.AlertRequest{}, response: models.Alert{}, status: http.StatusCreated},
+	{method: http.MethodPost, path: "/alerts/bulk", id: "bulkCreateAlerts", summary: "Create up to 500 alerts, all or none",
+		params: []param{idempotencyKeyParam}, request: alertRequests{}, requestCSV: true, response: alertList{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/alerts/export", id: "exportAlerts", summary: "Export alert definitions, only of open alerts unless status is given",
+		params:   append(append([]param(nil), alertFilterParams...), query("format", "string", "json or csv")),
+		response: alertRequests{}, responseCSV: true},
+	{method: http.MethodPost, path: "/alerts/backtest", id: "backtestAlert", summary: "Evaluate an alert on historical klines",
+		request: models.BacktestRequest{}, response: models.BacktestResult{}},
+	{method: http.MethodGet, path: "/alerts/:id", id: "getAlert", summary: "Get an alert", response: models.Alert{}},
+	{method: http.MethodPatch, path: "/alerts/:id", id: "updateAlert", summary: "Change an alert",
+		request: models.AlertUpdate{}, response: models.Alert{}},
+	{method: http.MethodDelete, path: "/alerts/:id", id: "deleteAlert", summary: "Delete an alert"},
+	{method: http.MethodPost, path: "/alerts/:id/pause", id: "pauseAlert", summary: "Pause an alert", response: models.Alert{}},
+	{method: http.MethodPost, path: "/alerts/:id/resume", id: "resumeAlert", summary: "Resume a paused alert", response: models.Alert{}},
+	{method: http.MethodGet, path: "/alerts/:id/deliveries", id: "getDeliveries", summary: "List the deliveries of an alert",
+		response: []*models.Delivery{}},
+	{method: http.MethodPost, path: "/alerts/:id/deliveries/:deliveryId/retry", id: "retryDelivery", summary: "Retry a dead-lettered delivery",
+		status: http.StatusAccepted},
+	{method: http.MethodGet, path: "/alerts/:id/preview", id: "previewNotification", summary: "Render the notification of an alert",
+		params: []param{
+			query("channel", "string", "Channel to render for, email by default"),
+			query("subject", "string", "Subject template to preview"),
+		},
+		response: services.Message{}},
+	{method: http.MethodGet, path: "/alerts/:id/chart", id: "previewChart", summary: "Render the chart of an alert",
+		responseContent: "image/png", status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/stream", id: "streamEvents", summary: "Stream events as Server-Sent Events",
+		params: streamParams, responseContent: "text/event-stream", status: http.StatusOK},
+	{method: http.MethodGet, path: "/ws", id: "websocketEvents", summary: "Stream events over a WebSocket",
+		params: streamParams, status: http.StatusSwitchingProtocols},
+
+	{method: http.MethodGet, path: "/channels", id: "listChannels", summary: "List the notification channels", response: channelList{}},
+
+	{method: http.MethodGet, path: "/symbols", id: "listSymbols", summary: "List the tracked symbols", response: []*models.SymbolStatus{}},
+	{method: http.MethodGet, path: "/symbols/:symbol/price", id: "getPrice", summary: "Get the latest price of a symbol",
+		response: models.SymbolPrice{}},
+	{method: http.MethodGet, path: "/symbols/:symbol/klines", id: "getKlines", summary: "Get the klines of a symbol",
+		params: []param{
+			query("interval", "string", "Exchange kline interval, live by default"),
+			query("limit", "integer", "Number of klines"),
+		},
+		response: models.SymbolKlines{}},
+	{method: http.MethodGet, path: "/symbols/:symbol/indicators", id: "getIndicators", summary: "Get the indicators of a symbol",
+		params: []param{
+			query("interval", "string", "Exchange kline interval, live by default. With an interval only RSI and MACD are available, calculated from the last 100 closed klines"),
+			query("name", "string", "Only this indicator"),
+			query("params", "string", "Comma separated periods of the named RSI or MACD indicator, each from 1 to 99"),
+		},
+		response: models.SymbolIndicators{}},
+
+	{method: http.MethodPost, path: "/teams", id: "createTeam", summary: "Create a team",
+		request: teamRequest{}, response: models.Team{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/teams", id: "listTeams", summary: "List your teams", response: []*models.Team{}},
+	{method: http.MethodGet, path: "/teams/:id", id: "getTeam", summary: "Get a team with its members", response: models.Team{}},
+	{method: http.MethodDelete, path: "/teams/:id", id: "deleteTeam", summary: "Delete a team and its alerts"},
+	{method: http.MethodPut, path: "/teams/:id/members/:userId", id: "setTeamMember", summary: "Add a member or change their role",
+		request: memberRequest{}, response: models.TeamMember{}},
+	{method: http.MethodDelete, path: "/teams/:id/members/:userId", id: "removeTeamMember", summary: "Remove a member"},
+	{method: http.MethodGet, path: "/teams/:id/routes", id: "getTeamRoutes", summary: "List the contacts of a team's alerts",
+		response: []*models.TeamRoute{}},
+	{method: http.MethodPost, path: "/teams/:id/routes", id: "addTeamRoute", summary: "Deliver a team's alerts to a contact",
+		request: routeRequest{}, response: models.TeamRoute{}, status: http.StatusCreated},
+	{method: http.MethodDelete, path: "/teams/:id/routes/:routeId", id: "deleteTeamRoute", summary: "Remove a contact of a team's alerts"},
+
+	{method: http.MethodPost, path: "/users/:id/api-keys", id: "createAPIKey", summary: "Issue an API key",
+		request: apiKeyRequest{}, response: newAPIKey{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/users/:id/api-keys", id: "getAPIKeys", summary: "List API keys", response: []*models.APIKey{}},
+	{method: http.MethodDelete, path: "/users/:id/api-keys/:keyId", id: "deleteAPIKey", summary: "Revoke an API key"},
+
+	{method: http.MethodGet, path: "/users/:id/channels", id: "getUserChannels", summary: "List a user's channels",
+		response: []*models.UserChannel{}},
+	{method: http.MethodPut, path: "/users/:id/channels/:channel", id: "setUserChannel", summary: "Enable or disable a channel",
+		request: models.UserChannel{}, response: models.UserChannel{}},
+	{method: http.MethodDelete, path: "/users/:id/channels/:channel", id: "deleteUserChannel", summary: "Remove a channel"},
+
+	{method: http.MethodPost, path: "/users/:id/contacts", id: "createContact", summary: "Add a contact",
+		request: models.Contact{}, response: models.Contact{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/users/:id/contacts", id: "getContacts", summary: "List contacts", response: []*models.Contact{}},
+	{method: http.MethodDelete, path: "/users/:id/contacts/:contactId", id: "deleteContact", summary: "Remove a contact"},
+	{method: http.MethodPost, path: "/users/:id/contacts/:contactId/verification", id: "resendVerification",
+		summary: "Send the verification of a contact again", status: http.StatusAccepted},
+
+	{method: http.MethodPost, path: "/users/:id/telegram/link", id: "createTelegramLink", summary: "Issue a Telegram link code",
+		response: models.TelegramLink{}, status: http.StatusCreated},
+
+	{method: http.MethodGet, path: "/users/:id/suppressed", id: "getSuppressed", summary: "List suppressed notifications",
+		params: []param{query("limit", "integer", "Number of notifications")}, response: []*models.Delivery{}},
+	{method: http.MethodGet, path: "/users/:id/preferences", id: "getPreferences", summary: "Get notification preferences",
+		response: models.Preferences{}},
+	{method: http.MethodPut, path: "/users/:id/preferences", id: "setPreferences", summary: "Set notification preferences",
+		request: models.Preferences{}, response: models.Preferences{}},
+
+	{method: http.MethodGet, path: "/users/:id/subject", id: "getSubject", summary: "Get the email subject template",
+		response: subjectRequest{}},
+	{method: http.MethodPut, path: "/users/:id/subject", id: "setSubject", summary: "Set the email subject template",
+		request: subjectRequest{}, response: subjectRequest{}},
+	{method: http.MethodDelete, path: "/users/:id/subject", id: "deleteSubject", summary: "Reset the email subject template"},
+
+	{method: http.MethodPost, path: "/users/:id/webhooks", id: "createWebhook", summary: "Add a signed webhook",
+		request: models.Webhook{}, response: models.Webhook{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/users/:id/webhooks", id: "getWebhooks", summary: "List webhooks", response: []*models.Webhook{}},
+	{method: http.MethodDelete, path: "/users/:id/webhooks/:webhookId", id: "deleteWebhook", summary: "Remove a webhook"},
+}
+
+// getOpenAPI serves the OpenAPI specification, built once.
+func getOpenAPI() echo.HandlerFunc {
+	spec, err := json.Marshal(openAPISpec())
+	return func(c echo.Context) error {
+		if err != nil {
+			log.Printf("Error encoding OpenAPI specification: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to encode the OpenAPI specification")
+		}
+		return c.JSONBlob(http.StatusOK, spec)
+	}
+}
+
+// pathParam matches the parameters of echo paths
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// openAPISpec returns the OpenAPI 3 specification of operations.
+func openAPISpec() map[string]interface{} {
+	b := &schemaBuilder{schemas: make(map[string]interface{})}
+	b.schemas["Error"] = b.schema(reflect.TypeOf(struct {
+		Error apiError `json:"error"`
+	}{}))
+
+	paths := make(map[string]map[string]interface{})
+	for _, op := range operations {
+		path := pathParam.ReplaceAllString(op.path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(op.method)] = b.operation(op)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Price Alert System API",
+			"version": apiVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API key or JWT"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []interface{}{
+			map[string][]string{"bearer": {}},
+			map[string][]string{"apiKey": {}},
+		},
+	}
+}
+
+func (b *schemaBuilder) operation(op operation) map[string]interface{} {
+	var params []interface{}
+	for _, match := range pathParam.FindAllStringSubmatch(op.path, -1) {
+		typ := "integer"
+		if stringPathParams[match[1]] {
+			typ = "string"
+		}
+		params = append(params, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]string{"type": typ},
+		})
+	}
+	for _, p := range op.params {
+		params = append(params, map[string]interface{}{
+			"name": p.name, "in": p.in, "description": p.description, "schema": map[string]string{"type": p.typ},
+		})
+	}
+
+	spec := map[string]interface{}{
+		"operationId": op.id,
+		"summary":     op.summary,
+	}
+	if params != nil {
+		spec["parameters"] = params
+	}
+	if op.public {
+		spec["security"] = []interface{}{}
+	}
+
+	if op.request != nil {
+		contentType := op.requestContent
+		if contentType == "" {
+			contentType = echo.MIMEApplicationJSON
+		}
+		content := map[string]interface{}{
+			contentType: map[string]interface{}{"schema": b.schema(reflect.TypeOf(op.request))},
+		}
+		if op.requestCSV {
+			content["text/csv"] = map[string]interface{}{"schema": map[string]string{"type": "string"}}
+		}
+		spec["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusNoContent
+		if op.response != nil {
+			status = http.StatusOK
+		}
+	}
+	response := map[string]interface{}{"description": http.StatusText(status)}
+	content := make(map[string]interface{})
+	if op.response != nil {
+		content[echo.MIMEApplicationJSON] = map[string]interface{}{"schema": b.schema(reflect.TypeOf(op.response))}
+	}
+	if op.responseContent != "" {
+		content[op.responseContent] = map[string]interface{}{"schema": map[string]string{"type": "string", "format": "binary"}}
+	}
+	if op.responseCSV {
+		content["text/csv"] = map[string]interface{}{"schema": map[string]string{"type": "string"}}
+	}
+	if len(content) > 0 {
+		response["content"] = content
+	}
+	spec["responses"] = map[string]interface{}{
+		fmt.Sprint(status): response,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				echo.MIMEApplicationJSON: map[string]interface{}{"schema": map[string]string{"$ref": "#/components/schemas/Error"}},
+			},
+		},
+	}
+	return spec
+}
+
+// schemaBuilder derives JSON schemas from Go types. Exported named structs
+// become components referenced by name.
+type schemaBuilder struct {
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "" && t.PkgPath() != "" && isExported(t.Name()):
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = nil // Reserved while the fields are derived
+			b.schemas[t.Name()] = b.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return b.object(t)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the schema of a struct's JSON fields, including those of
+// embedded structs
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	b.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (b *schemaBuilder) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if tag == "-" {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			b.addFields(fieldType, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+	}
+}
+
+func isExported(name string) bool {
+	return name[0] >= 'A' && name[0] <= 'Z'
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// checkOpenAPI returns an error naming the routes missing from operations
+// and the operations without a route, so neither changes without the other.
+func checkOpenAPI(routes []*echo.Route) error {
+	registered := make(map[string]bool)
+	for _, r := range routes {
+		if r.Method != echo.RouteNotFound {
+			registered[r.Method+" "+r.Path] = true
+		}
+	}
+	documented := make(map[string]bool)
+	for _, op := range operations {
+		documented[op.method+" "+op.path] = true
+	}
+
+	var problems []string
+	for route := range registered {
+		if !documented[route] {
+			problems = append(problems, route+" is not documented")
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			problems = append(problems, route+" is documented but not registered")
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("the OpenAPI operations do not match the routes: %s", strings.Join(problems, "; "))
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	api := newTestAPI(t, nil)
+	if err := checkOpenAPI(api.echo.Routes()); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]bool)
+	for _, op := range operations {
+		if ids[op.id] {
+			t.Errorf("operation ID %s is used twice", op.id)
+		}
+		ids[op.id] = true
+	}
+	if _, err := json.Marshal(openAPISpec()); err != nil {
+		t.Errorf("error encoding the specification: %v", err)
+	}
+}
+
+// rawJSON are the operations whose handlers read or write their JSON bodies
+// themselves rather than through the binder and serializer.
+var rawJSON = map[string]bool{"getOpenAPI": true, "discordInteraction": true}
+
+// untested are the operations the tests cannot run successfully: streams
+// do not end, and sending a verification needs an SMTP server with STARTTLS.
+var untested = map[string]bool{"streamEvents": true, "websocketEvents": true, "resendVerification": true}
+
+// TestOpenAPIMatchesHandlers runs every operation and checks that the
+// bodies the handlers bind and return, and their statuses, are the
+// documented ones.
+func TestOpenAPIMatchesHandlers(t *testing.T) {
+	rec := newRecorder()
+	runCalls(t, rec, append(clientCalls(), rawCalls()...))
+
+	b := &schemaBuilder{schemas: make(map[string]interface{})}
+	for _, op := range operations {
+		route := op.method + " " + op.path
+		x := rec.routes[route]
+		if x == nil || len(x.statuses) == 0 {
+			if !untested[op.id] {
+				t.Errorf("%s (%s) was not run successfully", route, op.id)
+			}
+			continue
+		}
+
+		status := op.status
+		if status == 0 {
+			status = http.StatusNoContent
+			if op.response != nil {
+				status = http.StatusOK
+			}
+		}
+		for _, s := range x.statuses {
+			if s != status {
+				t.Errorf("%s responded %d, documented %d", route, s, status)
+			}
+		}
+
+		checkBodies(t, b, route+" request", op.request, x.requests, !rawJSON[op.id] && op.requestContent == "")
+		checkBodies(t, b, route+" response", op.response, x.responses, !rawJSON[op.id])
+	}
+}
+
+// checkBodies compares the types a handler bound or returned with the
+// documented one. With required the handler must have used the documented
+// body.
+func checkBodies(t *testing.T, b *schemaBuilder, name string, documented interface{}, got []reflect.Type, required bool) {
+	t.Helper()
+	if documented == nil {
+		for _, typ := range got {
+			t.Errorf("%s is not documented, the handler uses %s", name, typ)
+		}
+		return
+	}
+	if required && len(got) == 0 {
+		t.Errorf("%s is documented as %T, the handler uses none", name, documented)
+	}
+	want := b.schema(reflect.TypeOf(documented))
+	for _, typ := range got {
+		if !schemaAccepts(b, want, b.schema(typ)) {
+			t.Errorf("%s is documented as %T, the handler uses %s", name, documented, typ)
+		}
+	}
+}
+
+// schemaAccepts reports whether every value of the got schema is valid
+// against the documented one. An empty documented schema accepts anything.
+func schemaAccepts(b *schemaBuilder, documented, got map[string]interface{}) bool {
+	if ref, ok := documented["$ref"]; ok && ref == got["$ref"] {
+		return true
+	}
+	documented, got = b.resolve(documented), b.resolve(got)
+	if len(documented) == 0 {
+		return true
+	}
+	if documented["type"] != got["type"] || documented["format"] != got["format"] {
+		return false
+	}
+
+	switch documented["type"] {
+	case "array":
+		return schemaAccepts(b, subschema(documented["items"]), subschema(got["items"]))
+	case "object":
+		want, _ := documented["properties"].(map[string]interface{})
+		have, _ := got["properties"].(map[string]interface{})
+		if len(want) != len(have) {
+			return false
+		}
+		for name, s := range want {
+			if _, ok := have[name]; !ok || !schemaAccepts(b, subschema(s), subschema(have[name])) {
+				return false
+			}
+		}
+		_, wantMap := documented["additionalProperties"]
+		_, haveMap := got["additionalProperties"]
+		if wantMap != haveMap {
+			return false
+		}
+		if wantMap {
+			return schemaAccepts(b, subschema(documented["additionalProperties"]), subschema(got["additionalProperties"]))
+		}
+	}
+	return true
+}
+
+// resolve returns the component a schema refers to, or the schema itself
+func (b *schemaBuilder) resolve(s map[string]interface{}) map[string]interface{} {
+	ref, ok := s["$ref"].(string)
+	if !ok {
+		return s
+	}
+	return subschema(b.schemas[strings.TrimPrefix(ref, "#/components/schemas/")])
+}
+
+func subschema(v interface{}) map[string]interface{} {
+	s, _ := v.(map[string]interface{})
+	return s
+}
+
+// recorder notes what the handlers of each route bind and return, and the
+// statuses of their successful responses.
+type recorder struct {
+	mutex  sync.Mutex
+	routes map[string]*exchange
+}
+
+type exchange struct {
+	requests  []reflect.Type
+	responses []reflect.Type
+	statuses  []int
+}
+
+func newRecorder() *recorder {
+	return &recorder{routes: make(map[string]*exchange)}
+}
+
+func (r *recorder) record(c echo.Context, add func(x *exchange)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	route := c.Request().Method + " " + c.Path()
+	if r.routes[route] == nil {
+		r.routes[route] = &exchange{}
+	}
+	add(r.routes[route])
+}
+
+// install records the bodies and statuses of e's routes.
+func (r *recorder) install(e *echo.Echo) {
+	e.Binder = &recordingBinder{recorder: r}
+	e.JSONSerializer = &recordingSerializer{recorder: r}
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if status := c.Response().Status; err == nil && c.Response().Committed && status < http.StatusMultipleChoices {
+				r.record(c, func(x *exchange) { x.statuses = append(x.statuses, status) })
+			}
+			return err
+		}
+	})
+}
+
+type recordingBinder struct {
+	echo.DefaultBinder
+	recorder *recorder
+}
+
+func (b *recordingBinder) Bind(i interface{}, c echo.Context) error {
+	err := b.DefaultBinder.Bind(i, c)
+	if err == nil {
+		b.recorder.record(c, func(x *exchange) { x.requests = append(x.requests, reflect.TypeOf(i)) })
+	}
+	return err
+}
+
+type recordingSerializer struct {
+	echo.DefaultJSONSerializer
+	recorder *recorder
+}
+
+func (s *recordingSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	if c.Response().Status < http.StatusMultipleChoices {
+		s.recorder.record(c, func(x *exchange) { x.responses = append(x.responses, reflect.TypeOf(i)) })
+	}
+	return s.DefaultJSONSerializer.Serialize(c, i, indent)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+func getPreferences(preferenceService *services.PreferenceService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		prefs, err := preferenceService.GetPreferences(userID)
+		if err != nil {
+			log.Printf("Error fetching preferences: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch preferences")
+		}
+
+		return c.JSON(http.StatusOK, prefs)
+	}
+}
+
+func setPreferences(preferenceService *services.PreferenceService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		prefs := new(models.Preferences)
+		if err := c.Bind(prefs); err != nil {
+			return bindError(c, err, "Invalid preferences")
+		}
+		prefs.UserID = userID
+
+		err = preferenceService.SetPreferences(prefs)
+		if errors.Is(err, services.ErrInvalidPreferences) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error saving preferences: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to save preferences")
+		}
+
+		return c.JSON(http.StatusOK, prefs)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+const (
+	streamHeartbeat = 15 * time.Second
+	wsPongWait      = 60 * time.Second
+	wsWriteWait     = 10 * time.Second
+)
+
+// Stream connections authenticate with an API key or JWT rather than
+// cookies, so cross-origin clients are allowed.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// subscribe subscribes a stream request to the hub for the principal's
+// user, or for admins the user_id passed.
+func subscribe(c echo.Context, hub *services.Hub) (*services.Subscription, error) {
+	var userID int
+	if s := c.QueryParam("user_id"); s != "" {
+		var err error
+		if userID, err = strconv.Atoi(s); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid user_id")
+		}
+	}
+	userID, err := actingUser(c, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	indicators, _ := strconv.ParseBool(c.QueryParam("indicators"))
+	var symbols []string
+	for _, symbol := range strings.Split(c.QueryParam("symbols"), ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return hub.Subscribe(userID, indicators, symbols), nil
+}
+
+// streamEvents sends the user's events as Server-Sent Events.
+func streamEvents(hub *services.Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sub, err := subscribe(c, hub)
+		if err != nil {
+			return err
+		}
+		defer hub.Unsubscribe(sub)
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		res.Header().Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+		res.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			case event, ok := <-sub.C:
+				if !ok {
+					if errors.Is(sub.Err(), services.ErrSlowConsumer) {
+						data, _ := json.Marshal(map[string]apiError{"error": {Code: "slow_consumer", Message: sub.Err().Error()}})
+						fmt.Fprintf(res, "event: error\ndata: %s\n\n", data)
+						res.Flush()
+					}
+					return nil
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Printf("Error encoding stream event: %v", err)
+					continue
+				}
+				if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+					return nil
+				}
+				res.Flush()
+			}
+		}
+	}
+}
+
+// websocketEvents sends the user's events as JSON WebSocket messages.
+func websocketEvents(hub *services.Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sub, err := subscribe(c, hub)
+		if err != nil {
+			return err
+		}
+		defer hub.Unsubscribe(sub)
+
+		conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+		if err != nil {
+			// The upgrader has already written the error response
+			return nil
+		}
+		defer conn.Close()
+
+		// Clients only send control frames; reading processes them and
+		// notices when the connection goes away
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			conn.SetReadLimit(512)
+			conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			})
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(streamHeartbeat)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-closed:
+				return nil
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					return nil
+				}
+			case event, ok := <-sub.C:
+				if !ok {
+					if errors.Is(sub.Err(), services.ErrSlowConsumer) {
+						msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, sub.Err().Error())
+						conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+					}
+					return nil
+				}
+				conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+				if err := conn.WriteJSON(event); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+// roleRanks orders team roles, each allowing what the ones below allow
+var roleRanks = map[string]int{
+	services.RoleViewer: 1,
+	services.RoleEditor: 2,
+	services.RoleOwner:  3,
+}
+
+// teamRoleKey is the context key of the principal's role in the :id team
+const teamRoleKey = "teamRole"
+
+// requireTeam only lets members of the :id team with at least role through.
+// Teams the principal is not a member of are reported as not found.
+func requireTeam(teams *services.TeamService, role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			teamID, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				return errorJSON(c, http.StatusBadRequest, "Invalid team ID")
+			}
+
+			current, err := teams.Role(principal(c), teamID)
+			if errors.Is(err, services.ErrTeamNotFound) {
+				return errorJSON(c, http.StatusNotFound, "Team not found")
+			}
+			if err != nil {
+				log.Printf("Error fetching role in team %d: %v", teamID, err)
+				return errorJSON(c, http.StatusInternalServerError, "Failed to fetch team")
+			}
+			if roleRanks[current] < roleRanks[role] {
+				return errorJSON(c, http.StatusForbidden, "Requires the "+role+" role in the team")
+			}
+			c.Set(teamRoleKey, current)
+			return next(c)
+		}
+	}
+}
+
+// teamError writes the response for an error of changing a team, logging
+// unexpected errors.
+func teamError(c echo.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidTeam):
+		return errorJSON(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrLastOwner):
+		return errorJSON(c, http.StatusConflict, err.Error())
+	}
+	log.Printf("%s: %v", message, err)
+	return errorJSON(c, http.StatusInternalServerError, message)
+}
+
+func createTeam(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(teamRequest)
+		if err := c.Bind(req); err != nil {
+			return bindError(c, err, "Invalid team data")
+		}
+		userID, err := actingUser(c, req.UserID)
+		if err != nil {
+			return err
+		}
+
+		team, err := teams.CreateTeam(userID, req.Name)
+		if err != nil {
+			return teamError(c, err, "Failed to create team")
+		}
+
+		return c.JSON(http.StatusCreated, team)
+	}
+}
+
+func listTeams(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list, err := teams.GetTeams(principal(c))
+		if err != nil {
+			log.Printf("Error fetching teams: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch teams")
+		}
+
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+func getTeam(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		teamID, _ := strconv.Atoi(c.Param("id"))
+
+		team, err := teams.GetTeam(principal(c), teamID)
+		if err != nil {
+			log.Printf("Error fetching team %d: %v", teamID, err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch team")
+		}
+
+		return c.JSON(http.StatusOK, team)
+	}
+}
+
+func deleteTeam(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		teamID, _ := strconv.Atoi(c.Param("id"))
+
+		if err := teams.DeleteTeam(teamID); err != nil {
+			log.Printf("Error deleting team %d: %v", teamID, err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to delete team")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func setTeamMember(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		teamID, _ := strconv.Atoi(c.Param("id"))
+		userID, err := strconv.Atoi(c.Param("userId"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		req := new(memberRequest)
+		if err := c.Bind(req); err != nil {
+			return bindError(c, err, "Invalid member data")
+		}
+
+		member, err := teams.SetMember(teamID, userID, req.Role)
+		if err != nil {
+			return teamError(c, err, "Failed to set team member")
+		}
+
+		return c.JSON(http.StatusOK, member)
+	}
+}
+
+// removeTeamMember removes a member. Owners remove anyone; other members
+// can only leave.
+func removeTeamMember(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		teamID, _ := strconv.Atoi(c.Param("id"))
+		userID, err := strconv.Atoi(c.Param("userId"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		if c.Get(teamRoleKey) != services.RoleOwner && !principal(c).CanActAs(userID) {
+			return errorJSON(c, http.StatusForbidden, "Requires the owner role in the team")
+		}
+
+		if err := teams.RemoveMember(teamID, userID); err != nil {
+			return teamError(c, err, "Failed to remove team member")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func getTeamRoutes(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		teamID, _ := strconv.Atoi(c.Param("id"))
+
+		routes, err := teams.GetRoutes(teamID)
+		if err != nil {
+			log.Printf("Error fetching routes of team %d: %v", teamID, err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch team routes")
+		}
+
+		return c.JSON(http.StatusOK, routes)
+	}
+}
+
+// addTeamRoute delivers the team's alerts to one of the caller's contacts.
+func addTeamRoute(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		teamID, _ := strconv.Atoi(c.Param("id"))
+		req := new(routeRequest)
+		if err := c.Bind(req); err != nil {
+			return bindError(c, err, "Invalid route data")
+		}
+
+		route, err := teams.AddRoute(principal(c), teamID, req.ContactID)
+		if errors.Is(err, services.ErrContactNotFound) {
+			verr := &services.ValidationError{}
+			verr.Add("contact_id", "is not one of your contacts")
+			return validationJSON(c, verr)
+		}
+		if err != nil {
+			log.Printf("Error adding route to team %d: %v", teamID, err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to add team route")
+		}
+
+		return c.JSON(http.StatusCreated, route)
+	}
+}
+
+func deleteTeamRoute(teams *services.TeamService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		teamID, _ := strconv.Atoi(c.Param("id"))
+		id, err := strconv.Atoi(c.Param("routeId"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid route ID")
+		}
+
+		if err := teams.DeleteRoute(teamID, id); err != nil {
+			log.Printf("Error deleting route of team %d: %v", teamID, err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to delete team route")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+// createTelegramLink issues a one-time code the user sends to the bot to
+// link their chat. telegramBot is nil when the bot is not running.
+func createTelegramLink(telegramBot *services.TelegramBot) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if telegramBot == nil {
+			return errorJSON(c, http.StatusServiceUnavailable, "Telegram bot is not enabled")
+		}
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		code, expires, err := telegramBot.CreateLinkCode(userID)
+		if err != nil {
+			log.Printf("Error creating Telegram link code: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to create link code")
+		}
+
+		return c.JSON(http.StatusCreated, &models.TelegramLink{
+			Code:      code,
+			Command:   "/link " + code,
+			Link:      telegramBot.LinkURL(code),
+			ExpiresAt: expires,
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/services"
+)
+
+type subjectRequest struct {
+	Subject string `json:"subject"`
+}
+
+// previewNotification renders what an alert would send on a channel if it
+// triggered now. A subject query parameter previews a subject template
+// before it is saved.
+func previewNotification(alertService *services.AlertService, dispatcher *services.Dispatcher, renderer *services.Renderer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
+		}
+		channel := c.QueryParam("channel")
+		if channel == "" {
+			channel = "email"
+		}
+		if err := dispatcher.ValidateChannels([]string{channel}); err != nil {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+
+		alert, err := alertService.GetAlert(principal(c), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errorJSON(c, http.StatusNotFound, "Alert not found")
+		}
+		if err != nil {
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch alert")
+		}
+
+		n := alertService.PreviewNotification(alert)
+		subject := c.QueryParam("subject")
+		if subject == "" {
+			if subject, err = renderer.GetSubjectTemplate(alert.UserID); err != nil {
+				log.Printf("Error fetching subject template: %v", err)
+				return errorJSON(c, http.StatusInternalServerError, "Failed to render preview")
+			}
+		}
+
+		msg, err := renderer.Preview(channel, subject, n)
+		if errors.Is(err, services.ErrInvalidTemplate) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error rendering preview: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to render preview")
+		}
+
+		return c.JSON(http.StatusOK, msg)
+	}
+}
+
+// previewChart returns the chart a notification of the alert would carry now
+func previewChart(alertService *services.AlertService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid alert ID")
+		}
+
+		alert, err := alertService.GetAlert(principal(c), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errorJSON(c, http.StatusNotFound, "Alert not found")
+		}
+		if err != nil {
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch alert")
+		}
+
+		chart, err := services.RenderChart(alertService.PreviewNotification(alert))
+		if errors.Is(err, services.ErrNoChartData) {
+			return errorJSON(c, http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error rendering chart: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to render chart")
+		}
+
+		return c.Blob(http.StatusOK, "image/png", chart)
+	}
+}
+
+func getSubject(renderer *services.Renderer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		subject, err := renderer.GetSubjectTemplate(userID)
+		if err != nil {
+			log.Printf("Error fetching subject template: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch subject")
+		}
+
+		return c.JSON(http.StatusOK, subjectRequest{Subject: subject})
+	}
+}
+
+func setSubject(renderer *services.Renderer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		req := new(subjectRequest)
+		if err := c.Bind(req); err != nil || req.Subject == "" {
+			return bindError(c, err, "Invalid subject")
+		}
+
+		err = renderer.SetSubjectTemplate(userID, req.Subject)
+		if errors.Is(err, services.ErrInvalidTemplate) {
+			return errorJSON(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("Error saving subject template: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to save subject")
+		}
+
+		return c.JSON(http.StatusOK, req)
+	}
+}
+
+func deleteSubject(renderer *services.Renderer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		if err := renderer.SetSubjectTemplate(userID, ""); err != nil {
+			log.Printf("Error resetting subject template: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to reset subject")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"price-alert-system/models"
+	"price-alert-system/services"
+)
+
+func createWebhook(webhookNotifier *services.WebhookNotifier, alertService *services.AlertService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		hook := new(models.Webhook)
+		if err := c.Bind(hook); err != nil {
+			return bindError(c, err, "Invalid webhook data")
+		}
+		hook.UserID = userID
+
+		if err := services.CheckTargetURL(hook.URL); err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Webhook "+err.Error())
+		}
+
+		if hook.AlertID != nil {
+			// Webhooks may follow the alerts of the user's teams too
+			_, err := alertService.GetAlert(&services.Principal{UserID: userID}, *hook.AlertID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return errorJSON(c, http.StatusBadRequest, "Alert not found for user")
+			}
+			if err != nil {
+				log.Printf("Error fetching alert: %v", err)
+				return errorJSON(c, http.StatusInternalServerError, "Failed to create webhook")
+			}
+		}
+
+		if err := webhookNotifier.CreateWebhook(hook); err != nil {
+			log.Printf("Error creating webhook: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to create webhook")
+		}
+
+		return c.JSON(http.StatusCreated, hook)
+	}
+}
+
+func getWebhooks(webhookNotifier *services.WebhookNotifier) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		hooks, err := webhookNotifier.GetWebhooks(userID)
+		if err != nil {
+			log.Printf("Error fetching webhooks: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to fetch webhooks")
+		}
+		if hooks == nil {
+			hooks = []*models.Webhook{}
+		}
+
+		return c.JSON(http.StatusOK, hooks)
+	}
+}
+
+func deleteWebhook(webhookNotifier *services.WebhookNotifier) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		id, err := strconv.Atoi(c.Param("webhookId"))
+		if err != nil {
+			return errorJSON(c, http.StatusBadRequest, "Invalid webhook ID")
+		}
+
+		if err := webhookNotifier.DeleteWebhook(userID, id); err != nil {
+			log.Printf("Error deleting webhook: %v", err)
+			return errorJSON(c, http.StatusInternalServerError, "Failed to delete webhook")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
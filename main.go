@@ -6,9 +6,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
+	_ "time/tzdata" // User time zones must resolve without a system zoneinfo database
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -16,7 +16,6 @@ import (
 	"price-alert-system/config"
 	"price-alert-system/database"
 	"price-alert-system/handlers"
-	"price-alert-system/models"
 	"price-alert-system/services"
 )
 
@@ -28,6 +27,9 @@ func main() {
 
 	// Initialize configuration
 	cfg := config.NewConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Initialize database
 	db, err := database.NewDatabase(cfg.DatabaseURL)
@@ -36,21 +38,80 @@ func main() {
 	}
 	defer db.Close()
 
-	// Get SMTP configuration from environment variables
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPortStr := os.Getenv("SMTP_PORT")
-	smtpPort, _ := strconv.Atoi(smtpPortStr)
-	smtpUsername := os.Getenv("SMTP_USERNAME")
-	smtpPassword := os.Getenv("SMTP_PASSWORD")
-	fromEmail := os.Getenv("FROM_EMAIL")
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	binanceService, err := services.NewBinanceService(cfg.Binance)
+	if err != nil {
+		log.Fatalf("Failed to initialize Binance service: %v", err)
+	}
+
+	// Initialize notification channels
+	formatter := services.NewPriceFormatter(binanceService)
+	renderer := services.NewRenderer(db, formatter)
+	emailNotifier := services.NewEmailNotifier(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.FromEmail, renderer)
+	contactService := services.NewContactService(db, emailNotifier, cfg.PublicURL)
+	dispatcher := services.NewDispatcher(db, contactService, cfg.Notifications.DefaultChannels)
+	dispatcher.Register(emailNotifier)
+	webhookNotifier := services.NewWebhookNotifier(db)
+	dispatcher.Register(webhookNotifier)
+	buttonSigner := services.NewButtonSigner(cfg.Notifications.InteractionSecret)
+	dispatcher.Register(services.NewSlackNotifier(cfg.Notifications.SlackAPIURL, cfg.Notifications.SlackBotToken, cfg.PublicURL, renderer, buttonSigner))
+	dispatcher.Register(services.NewDiscordNotifier(cfg.PublicURL, renderer, buttonSigner))
+	var telegramNotifier *services.TelegramNotifier
+	if cfg.Notifications.TelegramBotToken != "" {
+		telegramNotifier = services.NewTelegramNotifier(cfg.Notifications.TelegramAPIURL, cfg.Notifications.TelegramBotToken, renderer)
+		dispatcher.Register(telegramNotifier)
+	}
+	if cfg.Notifications.SMSGatewayURL != "" {
+		dispatcher.Register(services.NewSMSNotifier(cfg.Notifications.SMSGatewayURL, cfg.Notifications.SMSGatewayToken, renderer))
+	}
 
 	// Initialize services
-	binanceService := services.NewBinanceService()
 	indicatorService := services.NewIndicatorService()
-	alertService := services.NewAlertService(db, indicatorService, smtpHost, smtpPort, smtpUsername, smtpPassword, fromEmail)
+	preferenceService := services.NewPreferenceService(db)
+	teamService := services.NewTeamService(db, contactService)
+	rateLimiter := services.NewRateLimiter(cfg.RateLimit.UserPerMinute, cfg.RateLimit.UserBurst, cfg.RateLimit.ChannelPerMinute, cfg.RateLimit.ChannelBurst)
+	outbox := services.NewOutbox(db, dispatcher, preferenceService, rateLimiter, cfg.Outbox.MaxAttempts, cfg.Outbox.BaseDelay, cfg.Outbox.MaxDelay)
+	hub := services.NewHub(cfg.Stream.BufferSize)
+	alertService := services.NewAlertService(db, indicatorService, dispatcher, outbox, contactService, hub)
+	backtestService := services.NewBacktestService(binanceService)
+	idempotencyStore := services.NewIdempotencyStore(db, cfg.IdempotencyRetention)
+
+	// Start the futures market data provider if enabled
+	if cfg.Futures.Enabled {
+		futuresService, err := services.NewFuturesService(cfg.Futures)
+		if err != nil {
+			log.Fatalf("Failed to initialize futures service: %v", err)
+		}
+		go futuresService.Start()
+		defer futuresService.Stop()
+		alertService.AddIndicatorSource(futuresService)
+	}
+
+	// Record the raw market data stream if requested
+	if cfg.RecordFile != "" {
+		recorder, err := services.NewRecorder(cfg.RecordFile)
+		if err != nil {
+			log.Fatalf("Failed to open record file: %v", err)
+		}
+		defer recorder.Close()
+		binanceService.SetRecorder(recorder)
+		log.Printf("Recording market data to %s", cfg.RecordFile)
+	}
+
+	marketData := services.NewMarketDataService(indicatorService, alertService, binanceService, cfg.Binance.Symbols)
+
+	// Replay recorded market data instead of the live stream if requested
+	var provider services.TradeProvider = binanceService
+	if len(cfg.ReplayFiles) > 0 {
+		provider = services.NewReplayProvider(cfg.ReplayFiles, cfg.ReplaySpeed)
+		log.Printf("Replaying market data from %v at %gx speed", cfg.ReplayFiles, cfg.ReplaySpeed)
+	}
 
 	// Initialize WebSocket manager
-	wsManager := services.NewWebSocketManager(binanceService, indicatorService, alertService)
+	wsManager := services.NewWebSocketManager(provider, indicatorService, alertService)
 
 	// Start WebSocket connection
 	go wsManager.Start()
@@ -58,14 +119,48 @@ func main() {
 	// Start alert checker
 	go alertService.StartAlertChecker() // Add this line
 
-	// Start notification handler
-	go handleNotifications(alertService.GetNotificationChannel())
+	// Start notification delivery
+	go outbox.Start()
+
+	// Delete expired idempotency keys
+	go idempotencyStore.Start()
+
+	// Answer Telegram chat commands
+	var telegramBot *services.TelegramBot
+	if telegramNotifier != nil && cfg.Notifications.TelegramBot {
+		telegramBot = services.NewTelegramBot(db, telegramNotifier, alertService, contactService, formatter)
+		go telegramBot.Start()
+		defer telegramBot.Stop()
+	}
+
+	authenticator, err := services.NewAuthenticator(db, cfg.Auth.JWTSecret, cfg.Auth.JWKSFile, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience, cfg.Auth.AdminKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
+
+	interactions := services.NewInteractions(alertService, buttonSigner, cfg.Notifications.SlackSigningSecret, cfg.Notifications.DiscordPublicKey, cfg.Notifications.SnoozeDuration)
 
 	// Initialize HTTP server
 	e := echo.New()
 
 	// Register routes
-	handlers.RegisterRoutes(e, alertService)
+	handlers.RegisterRoutes(e, &handlers.Services{
+		Alerts:       alertService,
+		Backtest:     backtestService,
+		Dispatcher:   dispatcher,
+		Webhooks:     webhookNotifier,
+		Outbox:       outbox,
+		Contacts:     contactService,
+		Renderer:     renderer,
+		Preferences:  preferenceService,
+		Hub:          hub,
+		Auth:         authenticator,
+		Teams:        teamService,
+		TelegramBot:  telegramBot,
+		Interactions: interactions,
+		Idempotency:  idempotencyStore,
+		MarketData:   marketData,
+	})
 
 	// Determine port for HTTP service
 	port := os.Getenv("PORT")
@@ -95,12 +190,7 @@ func main() {
 	}
 
 	wsManager.Stop()
+	outbox.Stop()
+	idempotencyStore.Stop()
 	log.Println("Server exiting")
 }
-
-func handleNotifications(notificationChan <-chan models.Alert) {
-	for alert := range notificationChan {
-		log.Printf("Alert triggered: ID=%d, User=%d, Indicator=%s, Direction=%s, Value=%f",
-			alert.ID, alert.UserID, alert.Indicator, alert.Direction, alert.Value)
-	}
-};
\ No newline at end of file
@@ -1,21 +1,150 @@
 package models
 
+import "time"
+
 type AlertRequest struct {
-	UserID    int     `json:"user_id"`
-	Email     string  `json:"email"`
-	Value     float64 `json:"value"`
-	Direction string  `json:"direction"`
-	Indicator string  `json:"indicator"`
+	UserID    int      `json:"user_id,omitempty"`
+	TeamID    *int     `json:"team_id,omitempty"`
+	Email     string   `json:"email"`
+	Symbol    string   `json:"symbol"`
+	Value     float64  `json:"value"`
+	Direction string   `json:"direction"`
+	Indicator string   `json:"indicator"`
+	Channels  []string `json:"channels,omitempty"`
+	ContactID *int     `json:"contact_id,omitempty"`
+	Priority  string   `json:"priority,omitempty"`
+	// Status creates the alert "paused" if set so, and pending if empty,
+	// "pending" or "active"; other statuses are rejected
+	Status string `json:"status,omitempty"`
+}
+
+// AlertUpdate changes the fields of an alert that are set.
+type AlertUpdate struct {
+	Email     *string   `json:"email,omitempty"`
+	Symbol    *string   `json:"symbol,omitempty"`
+	Value     *float64  `json:"value,omitempty"`
+	Direction *string   `json:"direction,omitempty"`
+	Indicator *string   `json:"indicator,omitempty"`
+	Channels  *[]string `json:"channels,omitempty"`
+	ContactID *int      `json:"contact_id,omitempty"`
+	Priority  *string   `json:"priority,omitempty"`
+}
+
+// AlertFilter selects and orders the alerts listed. Zero fields do not
+// filter.
+type AlertFilter struct {
+	UserID        int
+	TeamID        int
+	Symbol        string
+	Indicator     string
+	Statuses      []string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Sort is the field to order by and Order "asc" or "desc"
+	Sort  string
+	Order string
+	// Cursor continues a listing from the page it was returned with
+	Cursor string
+	Limit  int
+}
+
+// AlertPage is one page of a listing.
+type AlertPage struct {
+	Alerts     []*Alert `json:"alerts"`
+	NextCursor string   `json:"next_cursor,omitempty"`
 }
 
 type Alert struct {
-	ID        int     `json:"id"`
-	UserID    int     `json:"user_id"`
-	Email     string  `json:"email"`
-	Value     float64 `json:"value"`
-	Direction string  `json:"direction"`
-	Indicator string  `json:"indicator"`
-	Status    string  `json:"status"`
+	ID     int `json:"id"`
+	UserID int `json:"user_id"`
+	// TeamID is set for alerts shared with a team; UserID is then who
+	// created the alert
+	TeamID    *int     `json:"team_id,omitempty"`
+	Email     string   `json:"email"`
+	Symbol    string   `json:"symbol"`
+	Value     float64  `json:"value"`
+	Direction string   `json:"direction"`
+	Indicator string   `json:"indicator"`
+	Status    string   `json:"status"`
+	Channels  []string `json:"channels,omitempty"`
+	ContactID *int     `json:"contact_id,omitempty"`
+	// Priority is "normal" or "high"; high priority alerts bypass quiet hours
+	Priority string `json:"priority"`
+	// Occurrence counts the times the alert has been armed; notifications are
+	// deduplicated per occurrence
+	Occurrence int `json:"occurrence"`
+	// SnoozedUntil is when a snoozed alert is armed again
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// UserChannel is a notification channel a user receives alerts on. The
+// address comes from the user's contact for the channel.
+type UserChannel struct {
+	UserID  int    `json:"user_id"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Contact is an address of a user on one channel: an email address, a chat
+// ID, a phone number or a chat webhook URL. Email addresses must be verified
+// before alerts are delivered to them.
+type Contact struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Channel    string     `json:"channel"`
+	Address    string     `json:"address"`
+	Verified   bool       `json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Webhook is a URL receiving signed notifications for a user's alerts, or
+// for a single alert when AlertID is set. Secret is only returned on creation.
+type Webhook struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	AlertID   *int      `json:"alert_id,omitempty"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is one notification of a triggered alert on one channel.
+type Delivery struct {
+	ID            int64      `json:"id"`
+	AlertID       int        `json:"alert_id"`
+	Channel       string     `json:"channel"`
+	Target        string     `json:"target"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	MaxAttempts   int        `json:"max_attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	Digest        bool       `json:"digest"`
+	// HeldReason says why delivery was postponed, e.g. "quiet_hours"
+	HeldReason string `json:"held_reason,omitempty"`
+	DedupeKey  string `json:"dedupe_key,omitempty"`
+	// SuppressedReason says why a suppressed delivery was not sent:
+	// "duplicate", "rate_limited_user" or "rate_limited_channel"
+	SuppressedReason string `json:"suppressed_reason,omitempty"`
+}
+
+// Preferences are a user's notification settings. DigestMode is "immediate",
+// "batched" (every DigestInterval minutes) or "daily" (at DigestHour). Quiet
+// hours run from QuietStart to QuietEnd ("HH:MM", may span midnight); both
+// they and DigestHour are in the user's TimeZone.
+type Preferences struct {
+	UserID         int    `json:"user_id"`
+	TimeZone       string `json:"time_zone"`
+	DigestMode     string `json:"digest_mode"`
+	DigestInterval int    `json:"digest_interval_minutes,omitempty"`
+	DigestHour     int    `json:"digest_hour"`
+	QuietStart     string `json:"quiet_start,omitempty"`
+	QuietEnd       string `json:"quiet_end,omitempty"`
 }
 
 type Kline struct {
@@ -45,3 +174,131 @@ type Trade struct {
 	IsBuyerMM bool   `json:"m"`
 	Ignore    bool   `json:"M"`
 }
+
+type BacktestRequest struct {
+	Symbol    string    `json:"symbol"`
+	Interval  string    `json:"interval"`
+	Value     float64   `json:"value"`
+	Direction string    `json:"direction"`
+	Indicator string    `json:"indicator"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+type BacktestTrigger struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Price float64   `json:"price"`
+}
+
+type BacktestResult struct {
+	Symbol    string            `json:"symbol"`
+	Interval  string            `json:"interval"`
+	Indicator string            `json:"indicator"`
+	Direction string            `json:"direction"`
+	Value     float64           `json:"value"`
+	StartTime time.Time         `json:"start_time"`
+	EndTime   time.Time         `json:"end_time"`
+	Klines    int               `json:"klines"`
+	Triggers  []BacktestTrigger `json:"triggers"`
+}
+
+// APIKey authenticates requests of a user. The key itself is only shown
+// when it is created; Prefix identifies it afterwards.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// TelegramLink is a one-time code linking a Telegram chat to a user: sent
+// to the bot as Command, or opened as Link when the bot's name is known.
+type TelegramLink struct {
+	Code      string    `json:"code"`
+	Command   string    `json:"command"`
+	Link      string    `json:"link,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Team shares alerts between its members. Role is the role of the user the
+// team was fetched for.
+type Team struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	Role      string        `json:"role,omitempty"`
+	Members   []*TeamMember `json:"members,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// TeamMember is a user's membership of a team: "owner", "editor" or "viewer".
+type TeamMember struct {
+	TeamID    int       `json:"team_id"`
+	UserID    int       `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TeamRoute delivers the team's alerts to a member's contact.
+type TeamRoute struct {
+	ID        int       `json:"id"`
+	TeamID    int       `json:"team_id"`
+	ContactID int       `json:"contact_id"`
+	Channel   string    `json:"channel"`
+	Address   string    `json:"address"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DataAge tells how current market data is: when it was last updated and
+// how many seconds ago that was.
+type DataAge struct {
+	UpdatedAt  time.Time `json:"updated_at"`
+	AgeSeconds float64   `json:"age_seconds"`
+}
+
+// SymbolStatus is the state of a symbol's live market data. Ready is true
+// once the live indicators have enough klines.
+type SymbolStatus struct {
+	Symbol string   `json:"symbol"`
+	Price  *float64 `json:"price,omitempty"`
+	Klines int      `json:"klines"`
+	Ready  bool     `json:"ready"`
+	*DataAge
+}
+
+// SymbolPrice is the latest traded price of a symbol.
+type SymbolPrice struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+	*DataAge
+}
+
+// SymbolKlines are the klines of a symbol, oldest first. Interval is "live"
+// for the klines the live indicators are calculated from.
+type SymbolKlines struct {
+	Symbol   string  `json:"symbol"`
+	Interval string  `json:"interval"`
+	Klines   []Kline `json:"klines"`
+	*DataAge
+}
+
+// IndicatorValue is the value of an indicator with the given parameters.
+// Value is only meaningful when Ready is true.
+type IndicatorValue struct {
+	Name   string  `json:"name"`
+	Params []int   `json:"params,omitempty"`
+	Value  float64 `json:"value"`
+	Ready  bool    `json:"ready"`
+	*DataAge
+}
+
+// SymbolIndicators are the indicators of a symbol, calculated from the
+// live klines or from the exchange's klines of an interval.
+type SymbolIndicators struct {
+	Symbol     string            `json:"symbol"`
+	Interval   string            `json:"interval"`
+	Indicators []*IndicatorValue `json:"indicators"`
+}
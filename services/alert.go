@@ -2,6 +2,7 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -10,53 +11,325 @@ import (
 
 	"price-alert-system/models"
 
-	"gopkg.in/mail.v2"
+	"github.com/lib/pq"
 )
 
+// DefaultSymbol is used for alerts and backtests that do not name a symbol
+const DefaultSymbol = "BTCUSDT"
+
+// Alert priorities. High priority alerts are delivered during quiet hours.
+const (
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// ErrInvalidAlert is wrapped by errors caused by the alert definition itself.
+var ErrInvalidAlert = errors.New("invalid alert")
+
 type AlertService struct {
 	db               *sql.DB
 	indicatorService *IndicatorService
-	notificationChan chan models.Alert
+	sources          []IndicatorSource
+	hub              *Hub
+	dispatcher       *Dispatcher
+	outbox           *Outbox
+	contacts         *ContactService
 	mutex            sync.Mutex
-	smtpHost         string
-	smtpPort         int
-	smtpUsername     string
-	smtpPassword     string
-	fromEmail        string
 }
 
-func NewAlertService(db *sql.DB, indicatorService *IndicatorService, smtpHost string, smtpPort int, smtpUsername, smtpPassword, fromEmail string) *AlertService {
+func NewAlertService(db *sql.DB, indicatorService *IndicatorService, dispatcher *Dispatcher, outbox *Outbox, contacts *ContactService, hub *Hub) *AlertService {
 	return &AlertService{
 		db:               db,
 		indicatorService: indicatorService,
-		notificationChan: make(chan models.Alert, 100),
-		smtpHost:         smtpHost,
-		smtpPort:         smtpPort,
-		smtpUsername:     smtpUsername,
-		smtpPassword:     smtpPassword,
-		fromEmail:        fromEmail,
+		sources:          []IndicatorSource{indicatorService},
+		hub:              hub,
+		dispatcher:       dispatcher,
+		outbox:           outbox,
+		contacts:         contacts,
 	}
 }
 
-func (s *AlertService) CreateAlert(alert *models.Alert) error {
-	alert.Status = "pending"
-	query := `INSERT INTO alerts (user_id, value, direction, indicator, status, email) 
-			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
-	return s.db.QueryRow(query, alert.UserID, alert.Value, alert.Direction, alert.Indicator, alert.Status, alert.Email).Scan(&alert.ID)
+// alertColumns are the columns scanAlert reads, in order
+const alertColumns = `id, user_id, team_id, value, direction, indicator, status, email, symbol, channels, contact_id, priority, occurrence, snoozed_until, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (s *AlertService) GetAlert(id int) (*models.Alert, error) {
-	query := `SELECT id, user_id, value, direction, indicator, status, email FROM alerts WHERE id = $1`
+func scanAlert(row rowScanner) (*models.Alert, error) {
 	alert := &models.Alert{}
-	err := s.db.QueryRow(query, id).Scan(&alert.ID, &alert.UserID, &alert.Value, &alert.Direction, &alert.Indicator, &alert.Status, &alert.Email)
+	err := row.Scan(&alert.ID, &alert.UserID, &alert.TeamID, &alert.Value, &alert.Direction, &alert.Indicator, &alert.Status,
+		&alert.Email, &alert.Symbol, pq.Array(&alert.Channels), &alert.ContactID, &alert.Priority, &alert.Occurrence, &alert.SnoozedUntil,
+		&alert.CreatedAt, &alert.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return alert, nil
 }
 
+// CreateAlert stores a new alert of the principal, or for admins of the
+// alert's user. An email address given with the alert becomes (or reuses)
+// one of the user's contacts, which must be verified before alert mail is
+// sent to it. Team alerts can be created by the team's owners and editors.
+// Alerts are created pending unless they are created paused; other statuses
+// are rejected.
+func (s *AlertService) CreateAlert(p *Principal, alert *models.Alert) error {
+	if err := s.prepareNewAlert(p, alert); err != nil {
+		return err
+	}
+	return insertAlert(s.db, alert)
+}
+
+// CreateAlerts creates all of the alerts or, if any of them is invalid or
+// cannot be stored, none. Field errors name the alert, e.g.
+// "alerts[3].value". Contacts for the alerts' email addresses are created
+// before the alerts and kept if they fail.
+func (s *AlertService) CreateAlerts(p *Principal, alerts []*models.Alert) error {
+	verr := &ValidationError{Err: ErrInvalidAlert}
+	for i, alert := range alerts {
+		err := s.prepareNewAlert(p, alert)
+		var alertErr *ValidationError
+		if errors.As(err, &alertErr) {
+			for _, f := range alertErr.Fields {
+				verr.Add(fmt.Sprintf("alerts[%d].%s", i, f.Field), "%s", f.Message)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("alert %d: %w", i, err)
+		}
+	}
+	if err := verr.OrNil(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, alert := range alerts {
+		if err := insertAlert(tx, alert); err != nil {
+			return fmt.Errorf("alert %d: %w", i, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// prepareNewAlert checks that the principal can create the alert and
+// prepares it for insertAlert
+func (s *AlertService) prepareNewAlert(p *Principal, alert *models.Alert) error {
+	if !p.Admin {
+		alert.UserID = p.UserID
+	}
+	switch alert.Status {
+	case "", "pending", "active":
+		alert.Status = "pending"
+	case "paused":
+	default:
+		verr := &ValidationError{Err: ErrInvalidAlert}
+		verr.Add("status", "must be pending, active or paused; %s alerts cannot be created", alert.Status)
+		return verr
+	}
+	if alert.TeamID != nil {
+		var allowed bool
+		err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM teams WHERE id = $1 AND ($2 OR id IN
+							 (SELECT team_id FROM team_members WHERE user_id = $3 AND role = ANY($4))))`,
+			*alert.TeamID, p.Admin, p.UserID, pq.Array(writeRoles)).Scan(&allowed)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			verr := &ValidationError{Err: ErrInvalidAlert}
+			verr.Add("team_id", "is not a team you are an owner or editor of")
+			return verr
+		}
+	}
+	return s.prepareAlert(alert)
+}
+
+// queryRower is a database or transaction
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func insertAlert(q queryRower, alert *models.Alert) error {
+	query := `INSERT INTO alerts (user_id, team_id, value, direction, indicator, status, email, symbol, channels, contact_id, priority) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id, created_at, updated_at`
+	err := q.QueryRow(query, alert.UserID, alert.TeamID, alert.Value, alert.Direction, alert.Indicator, alert.Status, alert.Email,
+		alert.Symbol, pq.Array(alert.Channels), alert.ContactID, alert.Priority).Scan(&alert.ID, &alert.CreatedAt, &alert.UpdatedAt)
+	if err == nil {
+		alert.Occurrence = 1
+	}
+	return err
+}
+
+// UpdateAlert changes the fields set in update. A new email address is
+// resolved to a contact like on creation. It returns sql.ErrNoRows if the
+// principal cannot change the alert.
+func (s *AlertService) UpdateAlert(p *Principal, id int, update *models.AlertUpdate) (*models.Alert, error) {
+	alert, err := s.getAlert(p, writeRoles, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Email != nil {
+		alert.Email = *update.Email
+		alert.ContactID = nil
+	}
+	if update.ContactID != nil {
+		alert.ContactID = update.ContactID
+	}
+	if update.Symbol != nil {
+		alert.Symbol = *update.Symbol
+	}
+	if update.Value != nil {
+		alert.Value = *update.Value
+	}
+	if update.Direction != nil {
+		alert.Direction = *update.Direction
+	}
+	if update.Indicator != nil {
+		alert.Indicator = *update.Indicator
+	}
+	if update.Channels != nil {
+		alert.Channels = *update.Channels
+	}
+	if update.Priority != nil {
+		alert.Priority = *update.Priority
+	}
+	if err := s.prepareAlert(alert); err != nil {
+		return nil, err
+	}
+
+	access, args := alertAccess(p, writeRoles, 10)
+	query := `UPDATE alerts SET value = $2, direction = $3, indicator = $4, email = $5, symbol = $6, channels = $7,
+			  contact_id = $8, priority = $9, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND ` + access + ` RETURNING ` + alertColumns
+	args = append([]interface{}{id, alert.Value, alert.Direction, alert.Indicator, alert.Email, alert.Symbol,
+		pq.Array(alert.Channels), alert.ContactID, alert.Priority}, args...)
+	return scanAlert(s.db.QueryRow(query, args...))
+}
+
+// prepareAlert normalizes and checks an alert before it is stored
+func (s *AlertService) prepareAlert(alert *models.Alert) error {
+	if err := s.validateAlert(alert); err != nil {
+		return err
+	}
+
+	if err := s.contacts.EnsureUser(alert.UserID); err != nil {
+		return err
+	}
+	if alert.TeamID != nil && (alert.ContactID != nil || alert.Email != "") {
+		verr := &ValidationError{Err: ErrInvalidAlert}
+		verr.Add("team_id", "team alerts are delivered to the team's routes and cannot have an email or contact_id")
+		return verr
+	}
+	switch {
+	case alert.ContactID != nil:
+		contact, err := s.contacts.GetContact(alert.UserID, *alert.ContactID)
+		if errors.Is(err, ErrContactNotFound) {
+			verr := &ValidationError{Err: ErrInvalidAlert}
+			verr.Add("contact_id", "is not one of the user's contacts")
+			return verr
+		}
+		if err != nil {
+			return err
+		}
+		if contact.Channel == "email" {
+			alert.Email = contact.Address
+		}
+	case alert.Email != "":
+		contact, err := s.contacts.FindOrCreateContact(alert.UserID, "email", alert.Email)
+		if err != nil {
+			return err
+		}
+		alert.ContactID = &contact.ID
+	default:
+		// Without an address of its own the alert must be deliverable to
+		// the user's existing contacts
+		routes, err := s.dispatcher.Routes(alert)
+		if err != nil {
+			return err
+		}
+		for _, route := range routes {
+			if route.Err == nil {
+				return nil
+			}
+		}
+		verr := &ValidationError{Err: ErrInvalidAlert}
+		if alert.TeamID != nil {
+			verr.Add("team_id", "the team has no verified routes, and none of its members a verified contact, on the alert's channels")
+		} else {
+			verr.Add("email", "is required unless contact_id is given or the user has a verified contact on the alert's channels")
+		}
+		return verr
+	}
+	return nil
+}
+
+// DeleteAlert removes an alert with its deliveries and webhooks. It returns
+// sql.ErrNoRows if the principal cannot change such an alert.
+func (s *AlertService) DeleteAlert(p *Principal, id int) error {
+	access, args := alertAccess(p, writeRoles, 2)
+	res, err := s.db.Exec(`DELETE FROM alerts WHERE id = $1 AND `+access, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PauseAlert stops checking an open or snoozed alert until it is resumed.
+// It returns sql.ErrNoRows if the principal cannot change such an alert or
+// it cannot be paused.
+func (s *AlertService) PauseAlert(p *Principal, id int) (*models.Alert, error) {
+	access, args := alertAccess(p, writeRoles, 2)
+	query := `UPDATE alerts SET status = 'paused', snoozed_until = NULL, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND status IN ('pending', 'active', 'snoozed') AND ` + access + `
+			  RETURNING ` + alertColumns
+	return scanAlert(s.db.QueryRow(query, append([]interface{}{id}, args...)...))
+}
+
+// ResumeAlert arms a paused alert again. It returns sql.ErrNoRows if the
+// principal cannot change such an alert or it is not paused.
+func (s *AlertService) ResumeAlert(p *Principal, id int) (*models.Alert, error) {
+	access, args := alertAccess(p, writeRoles, 2)
+	query := `UPDATE alerts SET status = 'active', updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND status = 'paused' AND ` + access + `
+			  RETURNING ` + alertColumns
+	return scanAlert(s.db.QueryRow(query, append([]interface{}{id}, args...)...))
+}
+
+// GetAlert returns an alert the principal can see: their own, their
+// teams', or any for admins. It returns sql.ErrNoRows for other alerts.
+func (s *AlertService) GetAlert(p *Principal, id int) (*models.Alert, error) {
+	return s.getAlert(p, readRoles, id)
+}
+
+// CanChangeAlert reports whether the principal can change an alert they
+// can see, which viewers of its team cannot.
+func (s *AlertService) CanChangeAlert(p *Principal, id int) (bool, error) {
+	access, args := alertAccess(p, writeRoles, 2)
+	var ok bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM alerts WHERE id = $1 AND `+access+`)`, append([]interface{}{id}, args...)...).Scan(&ok)
+	return ok, err
+}
+
+func (s *AlertService) getAlert(p *Principal, roles []string, id int) (*models.Alert, error) {
+	access, args := alertAccess(p, roles, 2)
+	query := `SELECT ` + alertColumns + ` FROM alerts WHERE id = $1 AND ` + access
+	return scanAlert(s.db.QueryRow(query, append([]interface{}{id}, args...)...))
+}
+
 func (s *AlertService) GetPendingAlerts() ([]*models.Alert, error) {
-	query := `SELECT id, user_id, value, direction, indicator, status, email FROM alerts WHERE status = 'pending' OR status = 'active'`
+	query := `SELECT ` + alertColumns + ` FROM alerts WHERE status = 'pending' OR status = 'active'`
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -65,8 +338,7 @@ func (s *AlertService) GetPendingAlerts() ([]*models.Alert, error) {
 
 	var alerts []*models.Alert
 	for rows.Next() {
-		alert := &models.Alert{}
-		err := rows.Scan(&alert.ID, &alert.UserID, &alert.Value, &alert.Direction, &alert.Indicator, &alert.Status, &alert.Email)
+		alert, err := scanAlert(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -75,6 +347,82 @@ func (s *AlertService) GetPendingAlerts() ([]*models.Alert, error) {
 	return alerts, nil
 }
 
+// GetOpenAlerts returns the alerts the principal can see that have not
+// triggered yet
+func (s *AlertService) GetOpenAlerts(p *Principal) ([]*models.Alert, error) {
+	access, args := alertAccess(p, readRoles, 1)
+	query := `SELECT ` + alertColumns + ` FROM alerts WHERE status IN ('pending', 'active') AND ` + access + ` ORDER BY id`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*models.Alert
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// CancelAlert cancels an open, snoozed or paused alert. It returns
+// sql.ErrNoRows if the principal cannot change such an alert.
+func (s *AlertService) CancelAlert(p *Principal, id int) error {
+	access, args := alertAccess(p, writeRoles, 2)
+	query := `UPDATE alerts SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND status IN ('pending', 'active', 'snoozed', 'paused') AND ` + access
+	res, err := s.db.Exec(query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SnoozeAlert pauses an alert for d, after which it is armed again.
+// Snoozing a triggered alert re-arms it as a new occurrence. It returns
+// sql.ErrNoRows if the principal cannot change such an alert or it is
+// cancelled.
+func (s *AlertService) SnoozeAlert(p *Principal, id int, d time.Duration) (*models.Alert, error) {
+	access, args := alertAccess(p, writeRoles, 3)
+	query := `UPDATE alerts SET status = 'snoozed', snoozed_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second',
+			  occurrence = occurrence + CASE WHEN status IN ('triggered', 'completed') THEN 1 ELSE 0 END,
+			  updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND status <> 'cancelled' AND ` + access + `
+			  RETURNING ` + alertColumns
+	return scanAlert(s.db.QueryRow(query, append([]interface{}{id, d.Seconds()}, args...)...))
+}
+
+// RearmAlert makes a triggered, completed or snoozed alert active again. An
+// alert that has triggered starts a new occurrence, so it notifies again. It
+// returns sql.ErrNoRows if the principal cannot change such an alert.
+func (s *AlertService) RearmAlert(p *Principal, id int) (*models.Alert, error) {
+	access, args := alertAccess(p, writeRoles, 2)
+	query := `UPDATE alerts SET status = 'active', snoozed_until = NULL,
+			  occurrence = occurrence + CASE WHEN status IN ('triggered', 'completed') THEN 1 ELSE 0 END,
+			  updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND status IN ('triggered', 'completed', 'snoozed') AND ` + access + `
+			  RETURNING ` + alertColumns
+	return scanAlert(s.db.QueryRow(query, append([]interface{}{id}, args...)...))
+}
+
+// wakeSnoozedAlerts arms the snoozed alerts whose snooze has ended
+func (s *AlertService) wakeSnoozedAlerts() error {
+	_, err := s.db.Exec(`UPDATE alerts SET status = 'active', snoozed_until = NULL, updated_at = CURRENT_TIMESTAMP
+						 WHERE status = 'snoozed' AND snoozed_until <= CURRENT_TIMESTAMP`)
+	return err
+}
+
 func (s *AlertService) UpdateAlertStatus(id int, status string) error {
 	query := `UPDATE alerts SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
 	_, err := s.db.Exec(query, status, id)
@@ -84,21 +432,35 @@ func (s *AlertService) UpdateAlertStatus(id int, status string) error {
 func (s *AlertService) CheckAlerts() {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
+	s.checkAlerts(ticker.C)
+}
+
+// checkAlerts checks the open alerts on every tick until ticks is closed.
+// Each check finishes before the next tick is read.
+func (s *AlertService) checkAlerts(ticks <-chan time.Time) {
+	for range ticks {
+		if err := s.wakeSnoozedAlerts(); err != nil {
+			log.Printf("Error waking snoozed alerts: %v", err)
+		}
 
-	for range ticker.C {
 		alerts, err := s.GetPendingAlerts()
 		if err != nil {
 			log.Printf("Error fetching pending alerts: %v", err)
 			continue
 		}
 
-		rsi, macd := s.indicatorService.GetIndicators()
-
-		log.Printf("RSI: %f, MACD: %f", rsi, macd)
+		for _, symbol := range s.indicatorService.Symbols() {
+			rsi, macd := s.indicatorService.GetIndicators(symbol)
+			log.Printf("%s RSI: %f, MACD: %f", symbol, rsi, macd)
+			s.publishIndicators(symbol)
+		}
 		log.Printf("Pending %d alerts", len(alerts))
 
+		var wg sync.WaitGroup
 		for _, alert := range alerts {
+			wg.Add(1)
 			go func(alert *models.Alert) {
+				defer wg.Done()
 				if alert.Status == "pending" {
 					err := s.UpdateAlertStatus(alert.ID, "active")
 					if err != nil {
@@ -107,75 +469,199 @@ func (s *AlertService) CheckAlerts() {
 					alert.Status = "active"
 				}
 
-				var currentValue float64
-				switch strings.ToUpper(alert.Indicator) {
-				case "RSI":
-					currentValue = rsi
-				case "MACD":
-					currentValue = macd
-				default:
+				source := s.findSource(alert.Indicator)
+				if source == nil {
 					log.Printf("Unknown indicator: %s", alert.Indicator)
+					return
 				}
+				currentValue, ready := source.Indicator(alert.Symbol, alert.Indicator)
 
-				if (strings.ToUpper(alert.Direction) == "UP" && currentValue > alert.Value && currentValue > 0) ||
-					(strings.ToUpper(alert.Direction) == "DOWN" && currentValue < alert.Value && currentValue > 0) {
-					err := s.UpdateAlertStatus(alert.ID, "triggered")
-					if err != nil {
-						log.Printf("Error updating alert status to triggered: %v", err)
+				if alertTriggered(alert, currentValue, ready) {
+					notification := &Notification{
+						Alert:        *alert,
+						CurrentValue: currentValue,
+						TriggeredAt:  time.Now(),
+						Indicators:   s.indicatorSnapshot(alert.Symbol),
 					}
-					alert.Status = "triggered"
-					s.notificationChan <- *alert
+					notification.Price, _ = s.indicatorService.Price(alert.Symbol)
+					notification.Candles = candlesFromKlines(s.indicatorService.Klines(alert.Symbol))
+					notification.Alert.Status = "triggered"
 
-					// Send email notification
-					if err := s.sendEmailNotification(alert, currentValue); err != nil {
-						log.Printf("Error sending email notification: %v", err)
+					triggered, err := s.triggerAlert(notification)
+					if err != nil {
+						log.Printf("Error triggering alert %d: %v", alert.ID, err)
+						return
 					}
+					if triggered {
+						log.Printf("Alert triggered: ID=%d, User=%d, Symbol=%s, Indicator=%s, Direction=%s, Value=%f, Current=%f",
+							alert.ID, alert.UserID, alert.Symbol, alert.Indicator, alert.Direction, alert.Value, currentValue)
+						alert.Status = "triggered"
 
-					// After sending the notification, mark the alert as completed
-					err = s.UpdateAlertStatus(alert.ID, "completed")
-					log.Println("Alert completed:", alert.ID)
-					if err != nil {
-						log.Printf("Error updating alert status to completed: %v", err)
+						event := *notification
+						event.Candles = nil
+						users, err := s.alertUsers(alert)
+						if err != nil {
+							log.Printf("Error fetching members of team %d: %v", *alert.TeamID, err)
+						}
+						for _, userID := range users {
+							s.hub.Publish(Event{Type: EventAlertTriggered, Time: event.TriggeredAt, Data: &event, UserID: userID})
+						}
 					}
 				}
 			}(alert)
 		}
+		wg.Wait()
 	}
 }
 
-func (s *AlertService) sendEmailNotification(alert *models.Alert, currentValue float64) error {
-	// Fetch user email from the database based on alert.UserID
-	var email string 
-	err := s.db.QueryRow("SELECT email FROM alerts WHERE user_id = $1", alert.UserID).Scan(&email)
+// alertUsers returns the users following an alert: the members of its team
+// or its user
+func (s *AlertService) alertUsers(alert *models.Alert) ([]int, error) {
+	if alert.TeamID == nil {
+		return []int{alert.UserID}, nil
+	}
+	return teamMembers(s.db, *alert.TeamID)
+}
+
+// triggerAlert marks the alert triggered and queues its notifications in one
+// transaction. It returns false if the alert was no longer pending or active.
+func (s *AlertService) triggerAlert(n *Notification) (bool, error) {
+	routes, err := s.dispatcher.Routes(&n.Alert)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// With no deliveries to wait for the alert completes right away
+	status := "triggered"
+	if len(routes) == 0 {
+		status = "completed"
+	}
+	res, err := tx.Exec(`UPDATE alerts SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND status IN ('pending', 'active')`,
+		status, n.Alert.ID)
 	if err != nil {
-		return fmt.Errorf("error fetching user email: %v", err)
+		return false, err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return false, err
+	}
+
+	if err := s.outbox.Enqueue(tx, routes, n); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// PreviewNotification builds the notification the alert would send if it
+// triggered now. The target value stands in while the indicator is not ready.
+func (s *AlertService) PreviewNotification(alert *models.Alert) *Notification {
+	currentValue := alert.Value
+	if source := s.findSource(alert.Indicator); source != nil {
+		if value, ok := source.Indicator(alert.Symbol, alert.Indicator); ok {
+			currentValue = value
+		}
+	}
+
+	n := &Notification{
+		Alert:        *alert,
+		CurrentValue: currentValue,
+		TriggeredAt:  time.Now(),
+		Indicators:   s.indicatorSnapshot(alert.Symbol),
+	}
+	n.Price, _ = s.indicatorService.Price(alert.Symbol)
+	n.Candles = candlesFromKlines(s.indicatorService.Klines(alert.Symbol))
+	n.Alert.Status = "triggered"
+	return n
+}
+
+// AddIndicatorSource makes the source's indicators available to alerts
+func (s *AlertService) AddIndicatorSource(source IndicatorSource) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sources = append(s.sources, source)
+}
+
+// findSource returns the source providing the named indicator
+func (s *AlertService) findSource(indicator string) IndicatorSource {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return findIndicatorSource(s.sources, indicator)
+}
+
+// indicatorName returns the canonical name of an indicator given in any case
+func (s *AlertService) indicatorName(indicator string) (string, bool) {
+	for _, name := range s.indicatorNames() {
+		if strings.EqualFold(name, indicator) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// indicatorNames returns the indicators of every source
+func (s *AlertService) indicatorNames() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var names []string
+	for _, source := range s.sources {
+		names = append(names, source.Indicators()...)
+	}
+	return names
+}
+
+func findIndicatorSource(sources []IndicatorSource, indicator string) IndicatorSource {
+	for _, source := range sources {
+		for _, name := range source.Indicators() {
+			if strings.EqualFold(name, indicator) {
+				return source
+			}
+		}
 	}
+	return nil
+}
 
-	m := mail.NewMessage()
-	m.SetHeader("From", s.fromEmail)
-	m.SetHeader("To", email)
-	m.SetHeader("Subject", "Price Alert Triggered")
-	m.SetBody("text/html", fmt.Sprintf(`
-		<h1>Price Alert Triggered</h1>
-		<p>Your alert has been triggered:</p>
-		<ul>
-			<li>Indicator: %s</li>
-			<li>Direction: %s</li>
-			<li>Target Value: %.2f</li>
-			<li>Current Value: %.2f</li>
-		</ul>
-	`, alert.Indicator, alert.Direction, alert.Value, currentValue))
+// indicatorSnapshot returns the ready indicator values of a symbol
+func (s *AlertService) indicatorSnapshot(symbol string) map[string]float64 {
+	s.mutex.Lock()
+	sources := s.sources
+	s.mutex.Unlock()
 
-	d := mail.NewDialer(s.smtpHost, s.smtpPort, s.smtpUsername, s.smtpPassword)
-	d.StartTLSPolicy = mail.MandatoryStartTLS
+	values := make(map[string]float64)
+	for _, source := range sources {
+		for _, name := range source.Indicators() {
+			if value, ok := source.Indicator(symbol, name); ok {
+				values[name] = value
+			}
+		}
+	}
+	return values
+}
 
-	return d.DialAndSend(m)
+// alertTriggered reports whether currentValue satisfies the alert's
+// condition. Values that are not ready never trigger; ready values compare
+// with their sign, so DOWN alerts on MACD or funding fire below negative
+// thresholds.
+func alertTriggered(alert *models.Alert, currentValue float64, ready bool) bool {
+	if !ready {
+		return false
+	}
+	return (strings.ToUpper(alert.Direction) == "UP" && currentValue > alert.Value) ||
+		(strings.ToUpper(alert.Direction) == "DOWN" && currentValue < alert.Value)
 }
 
 func (s *AlertService) StartAlertChecker() {
 	go s.CheckAlerts()
 }
 
-func (s *AlertService) GetNotificationChannel() <-chan models.Alert {
-	return s.notificationChan
+// publishIndicators sends the symbol's ready indicators to stream subscribers
+func (s *AlertService) publishIndicators(symbol string) {
+	update := &IndicatorUpdate{Symbol: symbol, Indicators: s.indicatorSnapshot(symbol)}
+	update.Price, _ = s.indicatorService.Price(symbol)
+	s.hub.Publish(Event{Type: EventIndicators, Data: update, Symbol: symbol})
 }
\ No newline at end of file
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"price-alert-system/models"
+)
+
+func TestCreateAlertRejectsFinishedStatuses(t *testing.T) {
+	s := &AlertService{}
+	for _, status := range []string{"triggered", "completed", "cancelled", "snoozed"} {
+		err := s.CreateAlert(&Principal{Admin: true}, &models.Alert{UserID: 1, Status: status})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != "status" {
+			t.Errorf("CreateAlert() with status %s = %v, want a status field error", status, err)
+		}
+	}
+}
+
+func TestAlertTriggered(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction string
+		target    float64
+		value     float64
+		ready     bool
+		want      bool
+	}{
+		{"UP above", "UP", 70, 71, true, true},
+		{"UP below", "up", 70, 69, true, false},
+		{"DOWN below", "DOWN", 30, 29, true, true},
+		{"DOWN above", "DOWN", 30, 31, true, false},
+		{"not ready", "DOWN", 30, 0, false, false},
+		{"negative MACD below a negative target", "DOWN", -5, -8, true, true},
+		{"negative MACD above a negative target", "DOWN", -5, -2, true, false},
+		{"negative MACD below zero", "DOWN", 0, -0.5, true, true},
+		{"negative MACD crossing up", "UP", -5, -2, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := &models.Alert{Indicator: "MACD", Direction: tt.direction, Value: tt.target}
+			if got := alertTriggered(alert, tt.value, tt.ready); got != tt.want {
+				t.Errorf("alertTriggered(%s %f, %f, %t) = %t, want %t", tt.direction, tt.target, tt.value, tt.ready, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"price-alert-system/models"
+)
+
+// alertCSVColumns are the columns of alert CSV files. Channels are
+// separated by semicolons.
+var alertCSVColumns = []string{"symbol", "indicator", "direction", "value", "email", "channels", "priority", "status", "team_id", "contact_id"}
+
+// exportStatuses are the statuses exported unless the filter asks for
+// others: alerts that have finished would be armed again by an import.
+var exportStatuses = []string{"pending", "active", "snoozed", "paused"}
+
+// ExportAlerts returns the definitions of the alerts matching the filter
+// among those the principal can see, oldest first, only the open ones
+// unless the filter selects statuses. Open alerts can be created again with
+// CreateAlerts; snoozed alerts are exported active.
+func (s *AlertService) ExportAlerts(p *Principal, filter *models.AlertFilter) ([]*models.AlertRequest, error) {
+	if len(filter.Statuses) == 0 {
+		filter.Statuses = exportStatuses
+	}
+	filter.Sort = "id"
+	filter.Order = "asc"
+	filter.Limit = maxPageSize
+	filter.Cursor = ""
+
+	exported := []*models.AlertRequest{}
+	for {
+		page, err := s.ListAlerts(p, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, alert := range page.Alerts {
+			// The address of email contacts carries over to other
+			// environments, their IDs do not
+			contactID := alert.ContactID
+			if alert.Email != "" {
+				contactID = nil
+			}
+			status := alert.Status
+			if status == "snoozed" {
+				status = "active"
+			}
+			exported = append(exported, &models.AlertRequest{
+				TeamID:    alert.TeamID,
+				Email:     alert.Email,
+				Symbol:    alert.Symbol,
+				Value:     alert.Value,
+				Direction: alert.Direction,
+				Indicator: alert.Indicator,
+				Channels:  alert.Channels,
+				ContactID: contactID,
+				Priority:  alert.Priority,
+				Status:    status,
+			})
+		}
+		if page.NextCursor == "" {
+			return exported, nil
+		}
+		filter.Cursor = page.NextCursor
+	}
+}
+
+// WriteAlertsCSV writes alert definitions as CSV with a header row.
+func WriteAlertsCSV(w io.Writer, alerts []*models.AlertRequest) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(alertCSVColumns); err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		record := []string{
+			alert.Symbol,
+			alert.Indicator,
+			alert.Direction,
+			strconv.FormatFloat(alert.Value, 'f', -1, 64),
+			alert.Email,
+			strings.Join(alert.Channels, ";"),
+			alert.Priority,
+			alert.Status,
+			optionalInt(alert.TeamID),
+			optionalInt(alert.ContactID),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func optionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+// ReadAlertsCSV reads alert definitions from CSV with a header row naming
+// any of the alertCSVColumns, in any order. Cells that are not numbers where
+// numbers are expected are reported as field errors of the alert, e.g.
+// "alerts[3].value".
+func ReadAlertsCSV(r io.Reader) ([]*models.AlertRequest, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the CSV file is empty", ErrInvalidAlert)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAlert, err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !containsString(alertCSVColumns, name) {
+			return nil, fmt.Errorf("%w: unknown CSV column %q, expected %s", ErrInvalidAlert, name, strings.Join(alertCSVColumns, ", "))
+		}
+		columns[name] = i
+	}
+	// A cell of a column, empty if the file has no such column
+	cell := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	verr := &ValidationError{Err: ErrInvalidAlert}
+	var alerts []*models.AlertRequest
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAlert, err)
+		}
+
+		i := len(alerts)
+		alert := &models.AlertRequest{
+			Symbol:    cell(record, "symbol"),
+			Indicator: cell(record, "indicator"),
+			Direction: cell(record, "direction"),
+			Email:     cell(record, "email"),
+			Priority:  cell(record, "priority"),
+			Status:    cell(record, "status"),
+		}
+		if s := cell(record, "value"); s != "" {
+			if alert.Value, err = strconv.ParseFloat(s, 64); err != nil {
+				verr.Add(fmt.Sprintf("alerts[%d].value", i), "must be a number")
+			}
+		}
+		for _, channel := range strings.Split(cell(record, "channels"), ";") {
+			if channel = strings.TrimSpace(channel); channel != "" {
+				alert.Channels = append(alert.Channels, channel)
+			}
+		}
+		for _, column := range []struct {
+			name string
+			dest **int
+		}{{"team_id", &alert.TeamID}, {"contact_id", &alert.ContactID}} {
+			s := cell(record, column.name)
+			if s == "" {
+				continue
+			}
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				verr.Add(fmt.Sprintf("alerts[%d].%s", i, column.name), "must be an integer")
+				continue
+			}
+			*column.dest = &id
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := verr.OrNil(); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"price-alert-system/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidQuery is wrapped by errors of malformed listing parameters.
+var ErrInvalidQuery = errors.New("invalid query")
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// timestampLayout formats TIMESTAMP values as Postgres stores them, without
+// a zone
+const timestampLayout = "2006-01-02 15:04:05.999999"
+
+// alertSortColumns are the fields alerts can be sorted by, with the SQL type
+// cursor values are cast to
+var alertSortColumns = map[string]string{
+	"id":         "integer",
+	"created_at": "timestamp",
+	"updated_at": "timestamp",
+	"symbol":     "text",
+	"value":      "double precision",
+}
+
+// alertCursor marks where a page ended: the sort value and ID of its last
+// alert. The sort is part of the cursor so it cannot continue another
+// listing.
+type alertCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func (c *alertCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeAlertCursor(s string) (*alertCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	c := &alertCursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return c, nil
+}
+
+// sortValue returns the alert's value of a sort field as a cursor string
+func sortValue(alert *models.Alert, sort string) string {
+	switch sort {
+	case "id":
+		return strconv.Itoa(alert.ID)
+	case "created_at":
+		return alert.CreatedAt.Format(timestampLayout)
+	case "updated_at":
+		return alert.UpdatedAt.Format(timestampLayout)
+	case "symbol":
+		return alert.Symbol
+	default:
+		return strconv.FormatFloat(alert.Value, 'g', -1, 64)
+	}
+}
+
+// ListAlerts returns a page of the alerts matching the filter among those
+// the principal can see. Pages are keyed on the sort field and ID, so
+// listings stay consistent while alerts are added or removed.
+func (s *AlertService) ListAlerts(p *Principal, filter *models.AlertFilter) (*models.AlertPage, error) {
+	sort := filter.Sort
+	if sort == "" {
+		sort = "created_at"
+	}
+	castType, ok := alertSortColumns[sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, sort)
+	}
+	order := strings.ToLower(filter.Order)
+	if order == "" {
+		order = "desc"
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidQuery)
+	}
+	limit := filter.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 1 || limit > maxPageSize {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxPageSize)
+	}
+
+	access, args := alertAccess(p, readRoles, 1)
+	conditions := []string{access}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.UserID != 0 {
+		where("user_id = $%d", filter.UserID)
+	}
+	if filter.TeamID != 0 {
+		where("team_id = $%d", filter.TeamID)
+	}
+	if filter.Symbol != "" {
+		where("symbol = $%d", strings.ToUpper(filter.Symbol))
+	}
+	if filter.Indicator != "" {
+		where("UPPER(indicator) = $%d", strings.ToUpper(filter.Indicator))
+	}
+	if len(filter.Statuses) > 0 {
+		where("status = ANY($%d)", pq.Array(filter.Statuses))
+	}
+	if filter.CreatedAfter != nil {
+		where("created_at >= $%d::timestamp", filter.CreatedAfter.UTC().Format(timestampLayout))
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at < $%d::timestamp", filter.CreatedBefore.UTC().Format(timestampLayout))
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeAlertCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != sort || cursor.Order != order {
+			return nil, fmt.Errorf("%w: cursor belongs to a listing with another sort", ErrInvalidQuery)
+		}
+		comparison := ">"
+		if order == "desc" {
+			comparison = "<"
+		}
+		args = append(args, cursor.Value, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)", sort, comparison, len(args)-1, castType, len(args)))
+	}
+
+	query := `SELECT ` + alertColumns + ` FROM alerts WHERE ` + strings.Join(conditions, " AND ")
+	// One more than the page tells whether there is a next page
+	query += fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT %d`, sort, order, order, limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &models.AlertPage{Alerts: []*models.Alert{}}
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Alerts = append(page.Alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Alerts) > limit {
+		page.Alerts = page.Alerts[:limit]
+		last := page.Alerts[limit-1]
+		page.NextCursor = (&alertCursor{Sort: sort, Order: order, Value: sortValue(last, sort), ID: last.ID}).encode()
+	}
+	return page, nil
+}
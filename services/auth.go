@@ -0,0 +1,171 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"price-alert-system/models"
+)
+
+// ErrUnauthenticated is returned for requests without valid credentials.
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+// apiKeyPrefix starts every API key so leaked keys are easy to recognize
+const apiKeyPrefix = "pak_"
+
+// Principal is who a request is made by. Admins act on behalf of any user.
+type Principal struct {
+	UserID int
+	Admin  bool
+	// Method is how the request was authenticated: "api_key", "jwt" or
+	// "admin_key"
+	Method string
+}
+
+// CanActAs reports whether the principal may access the user's data.
+func (p *Principal) CanActAs(userID int) bool {
+	return p.Admin || p.UserID == userID
+}
+
+// Authenticator identifies the callers of the API from API keys, which are
+// stored hashed, and from JWTs issued by an identity provider whose subject
+// is the user ID. An admin key configured at startup acts as any user, e.g.
+// to create the first API keys.
+type Authenticator struct {
+	db       *sql.DB
+	jwt      *jwtVerifier
+	adminKey string
+}
+
+// NewAuthenticator accepts HS256 JWTs if jwtSecret is set and RS256 JWTs
+// signed with the keys of the JWKS file if jwksFile is set. Tokens must be
+// issued by issuer and for audience when those are set.
+func NewAuthenticator(db *sql.DB, jwtSecret, jwksFile, issuer, audience, adminKey string) (*Authenticator, error) {
+	verifier := &jwtVerifier{
+		secret:   []byte(jwtSecret),
+		issuer:   issuer,
+		audience: audience,
+	}
+	if jwksFile != "" {
+		keys, err := loadJWKS(jwksFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading JWKS: %v", err)
+		}
+		verifier.keys = keys
+	}
+	return &Authenticator{
+		db:       db,
+		jwt:      verifier,
+		adminKey: adminKey,
+	}, nil
+}
+
+// Authenticate returns the principal of an API key, admin key or JWT.
+func (a *Authenticator) Authenticate(credential string) (*Principal, error) {
+	switch {
+	case credential == "":
+		return nil, ErrUnauthenticated
+	case a.adminKey != "" && hmac.Equal([]byte(credential), []byte(a.adminKey)):
+		return &Principal{Admin: true, Method: "admin_key"}, nil
+	case strings.HasPrefix(credential, apiKeyPrefix):
+		return a.authenticateAPIKey(credential)
+	}
+
+	subject, err := a.jwt.verify(credential)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	userID, err := strconv.Atoi(subject)
+	if err != nil || userID <= 0 {
+		return nil, fmt.Errorf("%w: subject is not a user ID", ErrUnauthenticated)
+	}
+	return &Principal{UserID: userID, Method: "jwt"}, nil
+}
+
+func (a *Authenticator) authenticateAPIKey(key string) (*Principal, error) {
+	var id, userID int
+	err := a.db.QueryRow(`SELECT id, user_id FROM api_keys WHERE key_hash = $1`, hashAPIKey(key)).Scan(&id, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Recording every use would write on every request
+	_, err = a.db.Exec(`UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+						WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')`, id)
+	if err != nil {
+		log.Printf("Error recording use of API key %d: %v", id, err)
+	}
+	return &Principal{UserID: userID, Method: "api_key"}, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, created_at, last_used_at`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CreateAPIKey issues a key for the user. Only its hash is stored, so the
+// key is returned this once.
+func (a *Authenticator) CreateAPIKey(userID int, name string) (*models.APIKey, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	if _, err := a.db.Exec(`INSERT INTO users (id) VALUES ($1) ON CONFLICT (id) DO NOTHING`, userID); err != nil {
+		return nil, "", err
+	}
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash) VALUES ($1, $2, $3, $4) RETURNING ` + apiKeyColumns
+	key, err := scanAPIKey(a.db.QueryRow(query, userID, strings.TrimSpace(name), secret[:len(apiKeyPrefix)+6], hashAPIKey(secret)))
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+func (a *Authenticator) GetAPIKeys(userID int) ([]*models.APIKey, error) {
+	rows, err := a.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes one of the user's keys.
+func (a *Authenticator) DeleteAPIKey(userID, id int) error {
+	_, err := a.db.Exec(`DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	return err
+}
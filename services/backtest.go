@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"price-alert-system/models"
+)
+
+const (
+	backtestMaxKlines = 10000
+	backtestPageSize  = 1000
+	backtestWarmup    = 100 // Klines fetched before the range so indicators are ready at its start
+)
+
+// ErrInvalidBacktest is wrapped by errors caused by the request itself.
+var ErrInvalidBacktest = errors.New("invalid backtest request")
+
+var klineIntervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"3m":  3 * time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// BacktestService replays historical klines through the live indicator and
+// alert evaluation code to show when an alert would have fired.
+type BacktestService struct {
+	binanceService *BinanceService
+}
+
+func NewBacktestService(binanceService *BinanceService) *BacktestService {
+	return &BacktestService{
+		binanceService: binanceService,
+	}
+}
+
+// Backtest evaluates the alert definition on every kline close in the range.
+// Live alerts complete after firing once, so each time the condition becomes
+// true again after having been false counts as a new trigger.
+func (s *BacktestService) Backtest(req *models.BacktestRequest) (*models.BacktestResult, error) {
+	if req.Symbol == "" {
+		req.Symbol = DefaultSymbol
+	}
+	if req.Interval == "" {
+		req.Interval = "1m"
+	}
+	req.Symbol = strings.ToUpper(req.Symbol)
+
+	step, ok := klineIntervals[req.Interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported interval %s", ErrInvalidBacktest, req.Interval)
+	}
+	if findIndicatorSource([]IndicatorSource{NewIndicatorService()}, req.Indicator) == nil {
+		return nil, fmt.Errorf("%w: indicator %s cannot be backtested from klines", ErrInvalidBacktest, req.Indicator)
+	}
+	if dir := strings.ToUpper(req.Direction); dir != "UP" && dir != "DOWN" {
+		return nil, fmt.Errorf("%w: unknown direction %s", ErrInvalidBacktest, req.Direction)
+	}
+	if req.EndTime.IsZero() {
+		req.EndTime = time.Now()
+	}
+	if !req.StartTime.Before(req.EndTime) {
+		return nil, fmt.Errorf("%w: start_time must be before end_time", ErrInvalidBacktest)
+	}
+	if req.EndTime.Sub(req.StartTime)/step > backtestMaxKlines {
+		return nil, fmt.Errorf("%w: range covers more than %d %s klines", ErrInvalidBacktest, backtestMaxKlines, req.Interval)
+	}
+
+	klines, err := s.fetchKlines(req.Symbol, req.Interval, req.StartTime.Add(-backtestWarmup*step), req.EndTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return RunBacktest(req, klines), nil
+}
+
+// RunBacktest evaluates req against klines, which must be in time order.
+// Klines closing before req.StartTime only warm up the indicators.
+func RunBacktest(req *models.BacktestRequest, klines []models.Kline) *models.BacktestResult {
+	result := &models.BacktestResult{
+		Symbol:    req.Symbol,
+		Interval:  req.Interval,
+		Indicator: req.Indicator,
+		Direction: req.Direction,
+		Value:     req.Value,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		Triggers:  []models.BacktestTrigger{},
+	}
+
+	alert := &models.Alert{
+		Value:     req.Value,
+		Direction: req.Direction,
+		Indicator: req.Indicator,
+	}
+	indicatorService := NewIndicatorService()
+	start := req.StartTime.UnixMilli()
+	wasTriggered := false
+
+	for _, kline := range klines {
+		indicatorService.UpdateKlines(req.Symbol, kline)
+		if kline.CloseTime < start {
+			continue
+		}
+		result.Klines++
+
+		currentValue, ready := indicatorService.Indicator(req.Symbol, alert.Indicator)
+		triggered := alertTriggered(alert, currentValue, ready)
+		if triggered && !wasTriggered {
+			result.Triggers = append(result.Triggers, models.BacktestTrigger{
+				Time:  time.UnixMilli(kline.CloseTime).UTC(),
+				Value: currentValue,
+				Price: kline.Close,
+			})
+		}
+		wasTriggered = triggered
+	}
+
+	return result
+}
+
+func (s *BacktestService) fetchKlines(symbol, interval string, from, to time.Time) ([]models.Kline, error) {
+	var klines []models.Kline
+	startTime := from.UnixMilli()
+	endTime := to.UnixMilli()
+
+	for startTime < endTime {
+		page, err := s.binanceService.GetKlines(symbol, interval, backtestPageSize, startTime, endTime)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching klines: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		klines = append(klines, page...)
+		startTime = page[len(page)-1].CloseTime + 1
+		if len(page) < backtestPageSize {
+			break
+		}
+	}
+	return klines, nil
+}
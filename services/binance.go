@@ -1,85 +1,235 @@
 package services
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 
+	"price-alert-system/config"
 	"price-alert-system/models"
 )
 
 type BinanceService struct {
-	baseURL string
-	wsURL   string
+	baseURL    string
+	wsURL      string
+	httpClient *http.Client
+	dialer     *websocket.Dialer
+	recorder   *Recorder
 }
 
-func NewBinanceService() *BinanceService {
+func NewBinanceService(cfg config.ProviderConfig) (*BinanceService, error) {
+	httpClient, dialer, err := newProviderClients(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &BinanceService{
-		baseURL: "https://api.binance.com",
-		wsURL:   "wss://stream.binance.com:443/ws/btcusdt@trade",
-	}
-}
-
-// func (s *BinanceService) GetUIKlines(symbol string, interval string, limit int, startTime, endTime int64, timeZone string) ([]models.Kline, error) {
-// 	url := fmt.Sprintf("%s/api/v3/uiKlines?symbol=%s&interval=%s&limit=%d", s.baseURL, symbol, interval, limit)
-
-// 	if startTime != 0 {
-// 		url += fmt.Sprintf("&startTime=%d", startTime)
-// 	}
-// 	if endTime != 0 {
-// 		url += fmt.Sprintf("&endTime=%d", endTime)
-// 	}
-// 	if timeZone != "" {
-// 		url += fmt.Sprintf("&timeZone=%s", timeZone)
-// 	}
-
-// 	resp, err := http.Get(url)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	defer resp.Body.Close()
-
-// 	var rawKlines [][]interface{}
-// 	if err := json.NewDecoder(resp.Body).Decode(&rawKlines); err != nil {
-// 		return nil, err
-// 	}
-
-// 	klines := make([]models.Kline, len(rawKlines))
-// 	for i, raw := range rawKlines {
-// 		openTime, _ := strconv.ParseInt(raw[0].(string), 10, 64)
-// 		open, _ := strconv.ParseFloat(raw[1].(string), 64)
-// 		high, _ := strconv.ParseFloat(raw[2].(string), 64)
-// 		low, _ := strconv.ParseFloat(raw[3].(string), 64)
-// 		close, _ := strconv.ParseFloat(raw[4].(string), 64)
-// 		volume, _ := strconv.ParseFloat(raw[5].(string), 64)
-// 		closeTime, _ := strconv.ParseInt(raw[6].(string), 10, 64)
-// 		quoteAssetVolume, _ := strconv.ParseFloat(raw[7].(string), 64)
-// 		numberOfTrades, _ := strconv.ParseInt(raw[8].(string), 10, 64)
-// 		takerBuyBaseAssetVolume, _ := strconv.ParseFloat(raw[9].(string), 64)
-// 		takerBuyQuoteAssetVolume, _ := strconv.ParseFloat(raw[10].(string), 64)
-
-// 		klines[i] = models.Kline{
-// 			OpenTime:                 openTime,
-// 			Open:                     open,
-// 			High:                     high,
-// 			Low:                      low,
-// 			Close:                    close,
-// 			Volume:                   volume,
-// 			CloseTime:                closeTime,
-// 			QuoteAssetVolume:         quoteAssetVolume,
-// 			NumberOfTrades:           numberOfTrades,
-// 			TakerBuyBaseAssetVolume:  takerBuyBaseAssetVolume,
-// 			TakerBuyQuoteAssetVolume: takerBuyQuoteAssetVolume,
-// 		}
-// 	}
-
-// 	return klines, nil
-// }
+		baseURL:    cfg.BaseURL,
+		wsURL:      streamURL(cfg),
+		httpClient: httpClient,
+		dialer:     dialer,
+	}, nil
+}
+
+// newProviderClients builds the REST client and stream dialer honouring the
+// provider's proxy and TLS settings.
+func newProviderClients(cfg config.ProviderConfig) (*http.Client, *websocket.Dialer, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+	if cfg.TLS.CAFile != "" {
+		pool, err := cfg.TLS.LoadCAFile()
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConfig
+
+	dialer := *websocket.DefaultDialer
+	dialer.Proxy = proxy
+	dialer.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}, &dialer, nil
+}
+
+// streamURL builds a raw stream URL for a single symbol and a combined
+// stream URL for several.
+func streamURL(cfg config.ProviderConfig) string {
+	name := cfg.StreamType
+	if name == "kline" {
+		name = "kline_" + cfg.KlineInterval
+	}
+
+	streams := make([]string, len(cfg.Symbols))
+	for i, symbol := range cfg.Symbols {
+		streams[i] = strings.ToLower(symbol) + "@" + name
+	}
+
+	if len(streams) == 1 {
+		return cfg.WSURL + "/ws/" + streams[0]
+	}
+	return cfg.WSURL + "/stream?streams=" + strings.Join(streams, "/")
+}
+
+// GetKlines fetches up to limit klines for symbol between startTime and
+// endTime (Unix milliseconds, 0 for unbounded) from the REST API.
+func (s *BinanceService) GetKlines(symbol string, interval string, limit int, startTime, endTime int64) ([]models.Kline, error) {
+	url := fmt.Sprintf("%s/api/v3/klines?symbol=%s&interval=%s&limit=%d", s.baseURL, strings.ToUpper(symbol), interval, limit)
+
+	if startTime != 0 {
+		url += fmt.Sprintf("&startTime=%d", startTime)
+	}
+	if endTime != 0 {
+		url += fmt.Sprintf("&endTime=%d", endTime)
+	}
+
+	resp, err := s.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("binance klines request failed: %s: %s", resp.Status, body)
+	}
+
+	var rawKlines [][]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&rawKlines); err != nil {
+		return nil, err
+	}
+
+	klines := make([]models.Kline, 0, len(rawKlines))
+	for _, raw := range rawKlines {
+		kline, err := parseRawKline(raw)
+		if err != nil {
+			return nil, err
+		}
+		klines = append(klines, kline)
+	}
+
+	return klines, nil
+}
+
+// PricePrecision returns the number of decimals of the symbol's price tick
+// size from the exchange info.
+func (s *BinanceService) PricePrecision(symbol string) (int, error) {
+	url := fmt.Sprintf("%s/api/v3/exchangeInfo?symbol=%s", s.baseURL, strings.ToUpper(symbol))
+
+	resp, err := s.httpClient.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("binance exchange info request failed: %s: %s", resp.Status, body)
+	}
+
+	var info struct {
+		Symbols []struct {
+			Symbol  string `json:"symbol"`
+			Filters []struct {
+				FilterType string `json:"filterType"`
+				TickSize   string `json:"tickSize"`
+			} `json:"filters"`
+		} `json:"symbols"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return 0, err
+	}
+
+	for _, sym := range info.Symbols {
+		for _, filter := range sym.Filters {
+			if filter.FilterType == "PRICE_FILTER" && filter.TickSize != "" {
+				return tickPrecision(filter.TickSize), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no price filter for %s", symbol)
+}
+
+// tickPrecision counts the significant decimals of a tick size such as "0.00010000"
+func tickPrecision(tickSize string) int {
+	dot := strings.IndexByte(tickSize, '.')
+	if dot < 0 {
+		return 0
+	}
+	return len(strings.TrimRight(tickSize[dot+1:], "0"))
+}
+
+// parseRawKline converts one row of the klines REST response, where times
+// and counts are numbers and prices and volumes are strings.
+func parseRawKline(raw []interface{}) (models.Kline, error) {
+	if len(raw) < 11 {
+		return models.Kline{}, fmt.Errorf("unexpected kline row length %d", len(raw))
+	}
+
+	number := func(v interface{}) int64 {
+		f, _ := v.(float64)
+		return int64(f)
+	}
+	decimal := func(v interface{}) float64 {
+		str, _ := v.(string)
+		f, _ := strconv.ParseFloat(str, 64)
+		return f
+	}
+
+	return models.Kline{
+		OpenTime:                 number(raw[0]),
+		Open:                     decimal(raw[1]),
+		High:                     decimal(raw[2]),
+		Low:                      decimal(raw[3]),
+		Close:                    decimal(raw[4]),
+		Volume:                   decimal(raw[5]),
+		CloseTime:                number(raw[6]),
+		QuoteAssetVolume:         decimal(raw[7]),
+		NumberOfTrades:           number(raw[8]),
+		TakerBuyBaseAssetVolume:  decimal(raw[9]),
+		TakerBuyQuoteAssetVolume: decimal(raw[10]),
+	}, nil
+}
+
+// SetRecorder makes the service persist every raw stream message it reads.
+func (s *BinanceService) SetRecorder(recorder *Recorder) {
+	s.recorder = recorder
+}
+
+// Connect opens the trade stream and returns it as a TradeStream.
+func (s *BinanceService) Connect() (TradeStream, error) {
+	conn, err := s.ConnectWebSocket()
+	if err != nil {
+		return nil, err
+	}
+	return &binanceStream{service: s, conn: conn}, nil
+}
 
 func (s *BinanceService) ConnectWebSocket() (*websocket.Conn, error) {
 	u, _ := url.Parse(s.wsURL)
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c, _, err := s.dialer.Dial(u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -92,14 +242,67 @@ func (s *BinanceService) ReadMessage(conn *websocket.Conn) (models.Trade, error)
 		return models.Trade{}, err
 	}
 
-	var trade models.Trade
-	if err := json.Unmarshal(message, &trade); err != nil {
-		return models.Trade{}, err
+	if s.recorder != nil {
+		if err := s.recorder.Record(message); err != nil {
+			log.Printf("Error recording message: %v", err)
+		}
 	}
 
 	// print indent json data
 	// jsonData, _ := json.MarshalIndent(trade.Price, "", "  ")
 	// fmt.Println(string(jsonData))
 
+	return parseTrade(message)
+}
+
+// parseTrade decodes a raw stream message into a trade. Combined stream
+// messages are unwrapped and kline events become a trade at the candle's
+// close price and close time, so updates to an open candle replace each other.
+func parseTrade(message []byte) (models.Trade, error) {
+	var envelope struct {
+		Stream string          `json:"stream"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return models.Trade{}, err
+	}
+	if envelope.Stream != "" && len(envelope.Data) > 0 {
+		message = envelope.Data
+	}
+
+	var trade models.Trade
+	if err := json.Unmarshal(message, &trade); err != nil {
+		return models.Trade{}, err
+	}
+
+	if trade.EventType == "kline" {
+		var event struct {
+			Kline struct {
+				CloseTime int64  `json:"T"`
+				Close     string `json:"c"`
+				Volume    string `json:"v"`
+			} `json:"k"`
+		}
+		if err := json.Unmarshal(message, &event); err != nil {
+			return models.Trade{}, err
+		}
+		trade.Price = event.Kline.Close
+		trade.Quantity = event.Kline.Volume
+		trade.TradeTime = event.Kline.CloseTime
+	}
+
 	return trade, nil
 }
+
+type binanceStream struct {
+	service *BinanceService
+	conn    *websocket.Conn
+}
+
+func (b *binanceStream) ReadTrade() (models.Trade, error) {
+	return b.service.ReadMessage(b.conn)
+}
+
+func (b *binanceStream) Close() error {
+	return b.conn.Close()
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"price-alert-system/models"
+)
+
+// ErrNoChartData is returned when a notification has too few candles to chart.
+var ErrNoChartData = errors.New("not enough candles to chart")
+
+const (
+	chartFilename = "chart.png"
+	chartWidth    = 800
+	chartHeight   = 480
+	chartCandles  = 60 // Candles shown; older buffered candles only warm up indicators
+	minCandles    = 2
+
+	chartMarginLeft  = 10
+	chartMarginRight = 80 // Room for the value axis labels
+	chartMarginTop   = 30 // Room for the title
+	chartPanelGap    = 14
+	chartMarginBelow = 10
+	chartGridLines   = 5
+)
+
+var (
+	chartBackground = color.RGBA{255, 255, 255, 255}
+	chartGrid       = color.RGBA{232, 232, 232, 255}
+	chartText       = color.RGBA{60, 60, 60, 255}
+	chartUp         = color.RGBA{38, 166, 154, 255}
+	chartDown       = color.RGBA{239, 83, 80, 255}
+	chartIndicator  = color.RGBA{41, 98, 255, 255}
+	chartThreshold  = color.RGBA{255, 152, 0, 255}
+	chartTrigger    = color.RGBA{156, 39, 176, 255}
+)
+
+// Candle is the compact OHLC form of a kline carried by notifications.
+type Candle struct {
+	Time  int64   `json:"t"`
+	Open  float64 `json:"o"`
+	High  float64 `json:"h"`
+	Low   float64 `json:"l"`
+	Close float64 `json:"c"`
+}
+
+func candlesFromKlines(klines []models.Kline) []Candle {
+	candles := make([]Candle, len(klines))
+	for i, k := range klines {
+		candles[i] = Candle{Time: k.OpenTime, Open: k.Open, High: k.High, Low: k.Low, Close: k.Close}
+	}
+	return candles
+}
+
+// chartAvailable reports whether RenderChart can chart n
+func chartAvailable(n *Notification) bool {
+	return len(n.Candles) >= minCandles
+}
+
+// RenderChart draws a PNG of the notification's recent candles. Below them a
+// panel shows the alert's indicator with its threshold line; the trigger
+// point is marked on the last candle. Indicators quoted in price are drawn
+// on the candles instead.
+func RenderChart(n *Notification) ([]byte, error) {
+	if !chartAvailable(n) {
+		return nil, ErrNoChartData
+	}
+	alert := n.Alert
+	indicator := strings.ToUpper(alert.Indicator)
+
+	values := indicatorHistory(indicator, n.Candles)
+	candles := n.Candles
+	if len(candles) > chartCandles {
+		values = values[len(candles)-chartCandles:]
+		candles = candles[len(candles)-chartCandles:]
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	condition := "ABOVE"
+	if strings.ToUpper(alert.Direction) == "DOWN" {
+		condition = "BELOW"
+	}
+	title := fmt.Sprintf("%s %s %s %s", alert.Symbol, indicator, condition, strconv.FormatFloat(alert.Value, 'f', -1, 64))
+	drawText(img, chartMarginLeft, 8, strings.ToUpper(title), chartText)
+
+	right := chartWidth - chartMarginRight
+	bottom := chartHeight - chartMarginBelow
+	slot := float64(right-chartMarginLeft) / float64(len(candles))
+	xOf := func(i int) int {
+		return chartMarginLeft + int((float64(i)+0.5)*slot)
+	}
+	triggerX := xOf(len(candles) - 1)
+
+	onPrice := priceIndicators[indicator]
+	priceBottom := bottom
+	if !onPrice {
+		priceBottom = chartMarginTop + (bottom-chartMarginTop)*60/100
+	}
+
+	// Candles
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, c := range candles {
+		low, high = math.Min(low, c.Low), math.Max(high, c.High)
+	}
+	if onPrice {
+		low, high = math.Min(low, math.Min(alert.Value, n.CurrentValue)), math.Max(high, math.Max(alert.Value, n.CurrentValue))
+	}
+	price := newChartPanel(image.Rect(chartMarginLeft, chartMarginTop, right, priceBottom), low, high)
+	price.drawGrid(img)
+	bodyWidth := max(int(slot*0.6), 1)
+	for i, c := range candles {
+		x := xOf(i)
+		col := chartUp
+		if c.Close < c.Open {
+			col = chartDown
+		}
+		vline(img, x, price.y(c.High), price.y(c.Low), col)
+		top, bot := price.y(math.Max(c.Open, c.Close)), price.y(math.Min(c.Open, c.Close))
+		fillRect(img, image.Rect(x-bodyWidth/2, top, x-bodyWidth/2+bodyWidth, bot+1), col)
+	}
+
+	// Indicator panel with the threshold and trigger point
+	panel := price
+	if !onPrice {
+		low, high = math.Min(alert.Value, n.CurrentValue), math.Max(alert.Value, n.CurrentValue)
+		for _, v := range values {
+			if !math.IsNaN(v) {
+				low, high = math.Min(low, v), math.Max(high, v)
+			}
+		}
+		panel = newChartPanel(image.Rect(chartMarginLeft, priceBottom+chartPanelGap, right, bottom), low, high)
+		panel.drawGrid(img)
+		drawText(img, chartMarginLeft+4, panel.rect.Min.Y+4, indicator, chartIndicator)
+
+		prevX, prevY, prev := 0, 0, false
+		for i, v := range values {
+			if math.IsNaN(v) {
+				prev = false
+				continue
+			}
+			x, y := xOf(i), panel.y(v)
+			if prev {
+				line(img, prevX, prevY, x, y, chartIndicator)
+			}
+			prevX, prevY, prev = x, y, true
+		}
+	}
+
+	thresholdY := panel.y(alert.Value)
+	for x := panel.rect.Min.X; x < panel.rect.Max.X; x += 8 {
+		hline(img, x, min(x+4, panel.rect.Max.X), thresholdY, chartThreshold)
+	}
+	for y := chartMarginTop; y < bottom; y += 6 {
+		vline(img, triggerX, y, min(y+2, bottom), chartTrigger)
+	}
+	fillCircle(img, triggerX, panel.y(n.CurrentValue), 5, chartTrigger)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// indicatorHistory calculates the indicator at every candle from the closes
+// up to it. Values that cannot be calculated from candles are NaN.
+func indicatorHistory(indicator string, candles []Candle) []float64 {
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+
+	values := make([]float64, len(candles))
+	for i := range values {
+		values[i] = math.NaN()
+		switch {
+		case indicator == "RSI" && i >= 14:
+			values[i] = calculateRSI(closes[:i+1], 14)
+		case indicator == "MACD" && i >= 25:
+			values[i] = ema(closes[:i+1], 12) - ema(closes[:i+1], 26)
+		}
+	}
+	return values
+}
+
+// chartPanel maps values to rows of its rectangle
+type chartPanel struct {
+	rect      image.Rectangle
+	low, high float64
+}
+
+func newChartPanel(rect image.Rectangle, low, high float64) *chartPanel {
+	pad := (high - low) * 0.08
+	if pad == 0 {
+		pad = math.Max(math.Abs(high)*0.01, 1e-8)
+	}
+	return &chartPanel{rect: rect, low: low - pad, high: high + pad}
+}
+
+func (p *chartPanel) y(v float64) int {
+	frac := (p.high - v) / (p.high - p.low)
+	return p.rect.Min.Y + int(frac*float64(p.rect.Dy()-1))
+}
+
+// drawGrid draws horizontal grid lines labelled on the right
+func (p *chartPanel) drawGrid(img *image.RGBA) {
+	step := (p.high - p.low) / chartGridLines
+	decimals := min(max(1-int(math.Floor(math.Log10(step))), 0), 8)
+	for i := 0; i <= chartGridLines; i++ {
+		v := p.low + step*float64(i)
+		y := p.y(v)
+		hline(img, p.rect.Min.X, p.rect.Max.X, y, chartGrid)
+		drawText(img, p.rect.Max.X+6, y-glyphHeight*textScale/2, strconv.FormatFloat(v, 'f', decimals, 64), chartText)
+	}
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(img, r, &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func hline(img *image.RGBA, x0, x1, y int, c color.RGBA) {
+	for x := x0; x < x1; x++ {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+func vline(img *image.RGBA, x, y0, y1 int, c color.RGBA) {
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+	for y := y0; y <= y1; y++ {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+// line draws a two pixel wide line with Bresenham's algorithm
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		img.SetRGBA(x0, y0+1, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			x0 += sx
+		} else {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func fillCircle(img *image.RGBA, cx, cy, r int, c color.RGBA) {
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r {
+				img.SetRGBA(cx+x, cy+y, c)
+			}
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+	textScale   = 2
+)
+
+// glyphs is a 3x5 pixel font; each row is three bits, the highest leftmost
+var glyphs = map[rune][glyphHeight]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7}, '.': {0, 0, 0, 0, 2}, '-': {0, 0, 7, 0, 0},
+	'_': {0, 0, 0, 0, 7}, '%': {5, 1, 2, 4, 5}, ' ': {0, 0, 0, 0, 0},
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2}, 'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7},
+	'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4},
+	'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5},
+	'Y': {5, 5, 2, 2, 2}, 'Z': {7, 1, 2, 4, 7},
+}
+
+// drawText writes s with its top left corner at x, y. Runes without a glyph
+// are skipped.
+func drawText(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range s {
+		glyph, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<(glyphWidth-1-col)) != 0 {
+					fillRect(img, image.Rect(x+col*textScale, y+row*textScale, x+(col+1)*textScale, y+(row+1)*textScale), c)
+				}
+			}
+		}
+		x += (glyphWidth + 1) * textScale
+	}
+}
+
+// notificationChart renders the chart of n, or returns nil if it has none
+func notificationChart(n *Notification) []byte {
+	if !chartAvailable(n) {
+		return nil
+	}
+	chart, err := RenderChart(n)
+	if err != nil {
+		log.Printf("Error rendering chart for alert %d: %v", n.Alert.ID, err)
+		return nil
+	}
+	return chart
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"price-alert-system/models"
+)
+
+var (
+	ErrContactNotFound = errors.New("contact not found")
+	ErrInvalidContact  = errors.New("invalid contact")
+	ErrInvalidToken    = errors.New("invalid or expired verification token")
+)
+
+const verificationTokenTTL = 48 * time.Hour
+
+// ContactService manages users and their contact addresses. Email contacts
+// are verified through a confirmation link; addresses on other channels are
+// trusted as given, except Telegram chats, which are only added by linking
+// them with the bot.
+type ContactService struct {
+	db            *sql.DB
+	emailNotifier *EmailNotifier
+	publicURL     string
+}
+
+func NewContactService(db *sql.DB, emailNotifier *EmailNotifier, publicURL string) *ContactService {
+	return &ContactService{
+		db:            db,
+		emailNotifier: emailNotifier,
+		publicURL:     strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+// EnsureUser creates the user record on first use.
+func (s *ContactService) EnsureUser(userID int) error {
+	_, err := s.db.Exec(`INSERT INTO users (id) VALUES ($1) ON CONFLICT (id) DO NOTHING`, userID)
+	return err
+}
+
+const contactColumns = `id, user_id, channel, address, verified_at, created_at`
+
+func scanContact(row rowScanner) (*models.Contact, error) {
+	contact := &models.Contact{}
+	err := row.Scan(&contact.ID, &contact.UserID, &contact.Channel, &contact.Address, &contact.VerifiedAt, &contact.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	contact.Verified = contact.VerifiedAt != nil
+	return contact, nil
+}
+
+func (s *ContactService) GetContact(userID, id int) (*models.Contact, error) {
+	query := `SELECT ` + contactColumns + ` FROM contacts WHERE id = $1 AND user_id = $2`
+	contact, err := scanContact(s.db.QueryRow(query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrContactNotFound
+	}
+	return contact, err
+}
+
+func (s *ContactService) GetContacts(userID int) ([]*models.Contact, error) {
+	query := `SELECT ` + contactColumns + ` FROM contacts WHERE user_id = $1 ORDER BY id`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []*models.Contact
+	for rows.Next() {
+		contact, err := scanContact(rows)
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+// FindOrCreateContact returns the user's contact for the address, creating
+// it (and starting verification for email) if it does not exist yet.
+func (s *ContactService) FindOrCreateContact(userID int, channel, address string) (*models.Contact, error) {
+	address, err := normalizeAddress(channel, address)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + contactColumns + ` FROM contacts WHERE user_id = $1 AND channel = $2 AND address = $3`
+	contact, err := scanContact(s.db.QueryRow(query, userID, channel, address))
+	if err == nil {
+		return contact, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return s.CreateContact(userID, channel, address)
+}
+
+// CreateContact adds a contact. Email contacts start unverified and are sent
+// a confirmation link. Telegram chats are rejected, see LinkTelegramChat.
+func (s *ContactService) CreateContact(userID int, channel, address string) (*models.Contact, error) {
+	address, err := normalizeAddress(channel, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.EnsureUser(userID); err != nil {
+		return nil, err
+	}
+
+	var verifiedAt *time.Time
+	if channel != "email" {
+		now := time.Now()
+		verifiedAt = &now
+	}
+
+	query := `INSERT INTO contacts (user_id, channel, address, verified_at) VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (user_id, channel, address) DO UPDATE SET address = EXCLUDED.address
+			  RETURNING ` + contactColumns
+	contact, err := scanContact(s.db.QueryRow(query, userID, channel, address, verifiedAt))
+	if err != nil {
+		return nil, err
+	}
+
+	if !contact.Verified {
+		if err := s.SendVerification(userID, contact.ID); err != nil {
+			log.Printf("Error sending verification for contact %d: %v", contact.ID, err)
+		}
+	}
+	return contact, nil
+}
+
+func (s *ContactService) DeleteContact(userID, id int) error {
+	_, err := s.db.Exec(`DELETE FROM contacts WHERE id = $1 AND user_id = $2`, id, userID)
+	return err
+}
+
+// SendVerification issues a new verification token for an unverified email
+// contact and mails the confirmation link.
+func (s *ContactService) SendVerification(userID, id int) error {
+	token := randomHex(32)
+	query := `UPDATE contacts SET verification_token = $1, token_expires_at = $2
+			  WHERE id = $3 AND user_id = $4 AND channel = 'email' AND verified_at IS NULL
+			  RETURNING address`
+	var address string
+	err := s.db.QueryRow(query, token, time.Now().Add(verificationTokenTTL), id, userID).Scan(&address)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrContactNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/contacts/verify?token=%s", s.publicURL, url.QueryEscape(token))
+	return s.emailNotifier.SendVerification(address, link)
+}
+
+// VerifyContact marks the contact holding token as verified.
+func (s *ContactService) VerifyContact(token string) (*models.Contact, error) {
+	query := `UPDATE contacts SET verified_at = CURRENT_TIMESTAMP, verification_token = NULL, token_expires_at = NULL
+			  WHERE verification_token = $1 AND token_expires_at > $2
+			  RETURNING ` + contactColumns
+	contact, err := scanContact(s.db.QueryRow(query, token, time.Now()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	return contact, err
+}
+
+// LinkTelegramChat makes a chat the user's verified telegram contact. It is
+// called once the chat has redeemed a link code, so it is the only way a chat
+// is added and may manage the user's alerts. A chat belongs to one account,
+// so its links to other users are removed.
+func (s *ContactService) LinkTelegramChat(userID int, chatID string) (*models.Contact, error) {
+	if err := s.EnsureUser(userID); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM contacts WHERE channel = 'telegram' AND address = $1 AND user_id <> $2`, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO contacts (user_id, channel, address, verified_at, linked_at)
+			  VALUES ($1, 'telegram', $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			  ON CONFLICT (user_id, channel, address) DO UPDATE SET verified_at = CURRENT_TIMESTAMP, linked_at = CURRENT_TIMESTAMP
+			  RETURNING ` + contactColumns
+	return scanContact(s.db.QueryRow(query, userID, chatID))
+}
+
+// LinkedTelegramContact returns the contact of a chat linked with the bot.
+// Chat IDs given as contacts before linking was required are not linked.
+func (s *ContactService) LinkedTelegramContact(chatID string) (*models.Contact, error) {
+	query := `SELECT ` + contactColumns + ` FROM contacts
+			  WHERE channel = 'telegram' AND address = $1 AND verified_at IS NOT NULL AND linked_at IS NOT NULL
+			  ORDER BY linked_at DESC LIMIT 1`
+	contact, err := scanContact(s.db.QueryRow(query, chatID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrContactNotFound
+	}
+	return contact, err
+}
+
+// ContactForChannel resolves where an alert is delivered on a channel: the
+// alert's own contact if it is on that channel, otherwise the user's first
+// verified contact on it.
+func (s *ContactService) ContactForChannel(alert *models.Alert, channel string) (*models.Contact, error) {
+	if alert.ContactID != nil {
+		contact, err := s.GetContact(alert.UserID, *alert.ContactID)
+		if err != nil && !errors.Is(err, ErrContactNotFound) {
+			return nil, err
+		}
+		if contact != nil && contact.Channel == channel {
+			return contact, nil
+		}
+	}
+
+	query := `SELECT ` + contactColumns + ` FROM contacts WHERE user_id = $1 AND channel = $2
+			  ORDER BY verified_at IS NULL, id LIMIT 1`
+	contact, err := scanContact(s.db.QueryRow(query, alert.UserID, channel))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrContactNotFound
+	}
+	return contact, err
+}
+
+func normalizeAddress(channel, address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if channel == "" || address == "" {
+		return "", fmt.Errorf("%w: channel and address are required", ErrInvalidContact)
+	}
+	if channel == "telegram" {
+		return "", fmt.Errorf("%w: telegram chats are added by linking them with the bot", ErrInvalidContact)
+	}
+	if channel == "email" {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidContact, err)
+		}
+		return strings.ToLower(parsed.Address), nil
+	}
+	// Slack and Discord webhook URLs are posted to by the server
+	if channel == "discord" || (channel == "slack" && strings.HasPrefix(address, "https://")) {
+		if err := CheckTargetURL(address); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidContact, err)
+		}
+	}
+	return address, nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// DiscordNotifier posts alerts to a Discord channel webhook URL as embeds
+// with action buttons. Discord only shows the snooze, re-arm and cancel
+// buttons on messages of webhooks owned by the application whose
+// interaction endpoint handles them.
+type DiscordNotifier struct {
+	publicURL string
+	renderer  *Renderer
+	signer    *ButtonSigner
+}
+
+func NewDiscordNotifier(publicURL string, renderer *Renderer, signer *ButtonSigner) *DiscordNotifier {
+	return &DiscordNotifier{
+		publicURL: publicURL,
+		renderer:  renderer,
+		signer:    signer,
+	}
+}
+
+func (d *DiscordNotifier) Channel() string {
+	return "discord"
+}
+
+func (d *DiscordNotifier) Notify(webhookURL string, n *Notification) error {
+	msg, err := d.renderer.Render(d.Channel(), n)
+	if err != nil {
+		return err
+	}
+	webhookURL, err = withComponents(webhookURL)
+	if err != nil {
+		return err
+	}
+
+	chart := notificationChart(n)
+	payload := discordMessage(msg, d.renderer.templateData(n), alertURL(d.publicURL, n.Alert.ID), chart != nil, d.signer.buttonValue(n))
+	if chart == nil {
+		return postJSON(targetClient, webhookURL, payload, nil)
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postMultipart(targetClient, webhookURL, map[string]string{"payload_json": string(payloadJSON)},
+		attachment{Field: "files[0]", Filename: chartFilename, Data: chart}, nil)
+}
+
+// NotifyDigest posts several notifications as one message.
+func (d *DiscordNotifier) NotifyDigest(webhookURL string, ns []*Notification) error {
+	msg, err := d.renderer.RenderDigest(d.Channel(), ns)
+	if err != nil {
+		return err
+	}
+	return postJSON(targetClient, webhookURL, map[string]string{"content": msg.Text}, nil)
+}
+
+// withComponents asks Discord to keep the buttons of webhook messages
+func withComponents(webhookURL string) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("with_components", "true")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sync"
+	"time"
+
+	"gopkg.in/mail.v2"
+)
+
+// smtpIdleTimeout is how long an unused SMTP connection is kept open
+const smtpIdleTimeout = 30 * time.Second
+
+// EmailNotifier delivers notifications over SMTP. The connection is reused
+// for consecutive messages and closed once idle.
+type EmailNotifier struct {
+	smtpHost     string
+	smtpPort     int
+	smtpUsername string
+	smtpPassword string
+	fromEmail    string
+	renderer     *Renderer
+
+	mutex  sync.Mutex
+	sender mail.SendCloser
+	idle   *time.Timer
+}
+
+func NewEmailNotifier(smtpHost string, smtpPort int, smtpUsername, smtpPassword, fromEmail string, renderer *Renderer) *EmailNotifier {
+	return &EmailNotifier{
+		smtpHost:     smtpHost,
+		smtpPort:     smtpPort,
+		smtpUsername: smtpUsername,
+		smtpPassword: smtpPassword,
+		fromEmail:    fromEmail,
+		renderer:     renderer,
+	}
+}
+
+func (e *EmailNotifier) Channel() string {
+	return "email"
+}
+
+// Notify sends the rendered notification with a plain text body and an HTML
+// alternative.
+func (e *EmailNotifier) Notify(email string, n *Notification) error {
+	msg, err := e.renderer.Render(e.Channel(), n)
+	if err != nil {
+		return err
+	}
+
+	m := mail.NewMessage()
+	m.SetHeader("From", e.fromEmail)
+	m.SetHeader("To", email)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Text)
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+	}
+	// The HTML part refers to the chart by its file name as content ID
+	if chart := notificationChart(n); chart != nil {
+		m.Embed(chartFilename, mail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(chart)
+			return err
+		}))
+	}
+
+	return e.send(m)
+}
+
+// NotifyDigest sends several notifications as one email.
+func (e *EmailNotifier) NotifyDigest(email string, ns []*Notification) error {
+	msg, err := e.renderer.RenderDigest(e.Channel(), ns)
+	if err != nil {
+		return err
+	}
+
+	m := mail.NewMessage()
+	m.SetHeader("From", e.fromEmail)
+	m.SetHeader("To", email)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Text)
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+	}
+
+	return e.send(m)
+}
+
+// SendVerification mails the link confirming an address.
+func (e *EmailNotifier) SendVerification(email, link string) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", e.fromEmail)
+	m.SetHeader("To", email)
+	m.SetHeader("Subject", "Confirm your email address for price alerts")
+	m.SetBody("text/plain", fmt.Sprintf("Open this link to receive price alerts at %s:\n\n%s\n\nIf you did not request this, ignore this email.", email, link))
+	m.AddAlternative("text/html", fmt.Sprintf(`
+		<p>Confirm that you want to receive price alerts at %s:</p>
+		<p><a href="%s">Confirm email address</a></p>
+		<p>If you did not request this, ignore this email.</p>
+	`, html.EscapeString(email), html.EscapeString(link)))
+
+	return e.send(m)
+}
+
+// send delivers m over the kept connection, dialing one if there is none. A
+// kept connection the server has dropped is replaced once.
+func (e *EmailNotifier) send(m *mail.Message) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	reused := e.sender != nil
+	if !reused {
+		if err := e.dial(); err != nil {
+			return err
+		}
+	}
+	err := mail.Send(e.sender, m)
+	if err != nil && reused {
+		e.sender.Close()
+		if err := e.dial(); err != nil {
+			return err
+		}
+		err = mail.Send(e.sender, m)
+	}
+	if err != nil {
+		e.sender.Close()
+		e.sender = nil
+		return err
+	}
+
+	if e.idle != nil {
+		e.idle.Stop()
+	}
+	e.idle = time.AfterFunc(smtpIdleTimeout, e.closeIdle)
+	return nil
+}
+
+func (e *EmailNotifier) dial() error {
+	d := mail.NewDialer(e.smtpHost, e.smtpPort, e.smtpUsername, e.smtpPassword)
+	d.StartTLSPolicy = mail.MandatoryStartTLS
+
+	sender, err := d.Dial()
+	if err != nil {
+		e.sender = nil
+		return err
+	}
+	e.sender = sender
+	return nil
+}
+
+func (e *EmailNotifier) closeIdle() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.sender != nil {
+		e.sender.Close()
+		e.sender = nil
+	}
+}
@@ -0,0 +1,11 @@
+package services
+
+import "time"
+
+// CheckAlertsOnce runs a single pass of the alert checker.
+func (s *AlertService) CheckAlertsOnce() {
+	ticks := make(chan time.Time, 1)
+	ticks <- time.Now()
+	close(ticks)
+	s.checkAlerts(ticks)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// precisionRetry is how long a failed precision lookup is not repeated
+const precisionRetry = 10 * time.Minute
+
+// priceIndicators are quoted in the symbol's price and use its precision
+var priceIndicators = map[string]bool{
+	"MARK_PRICE":  true,
+	"INDEX_PRICE": true,
+}
+
+// PrecisionSource looks up how many decimals a symbol's prices are quoted with.
+type PrecisionSource interface {
+	PricePrecision(symbol string) (int, error)
+}
+
+type cachedPrecision struct {
+	decimals  int
+	ok        bool
+	fetchedAt time.Time
+}
+
+// PriceFormatter formats prices with the precision of their symbol. Symbols
+// whose precision is unknown get enough decimals for four significant digits.
+type PriceFormatter struct {
+	source PrecisionSource
+	mutex  sync.Mutex
+	cache  map[string]cachedPrecision
+}
+
+// NewPriceFormatter creates a formatter; source may be nil.
+func NewPriceFormatter(source PrecisionSource) *PriceFormatter {
+	return &PriceFormatter{
+		source: source,
+		cache:  make(map[string]cachedPrecision),
+	}
+}
+
+// FormatPrice formats a price of the symbol.
+func (f *PriceFormatter) FormatPrice(symbol string, price float64) string {
+	decimals, ok := f.precision(strings.ToUpper(symbol))
+	if !ok {
+		decimals = significantDecimals(price)
+	}
+	return strconv.FormatFloat(price, 'f', decimals, 64)
+}
+
+// FormatIndicator formats an indicator value. Price indicators use the
+// symbol's precision, MACD keeps four significant digits and everything else
+// (oscillators, percentages, contracts) gets two decimals.
+func (f *PriceFormatter) FormatIndicator(symbol, indicator string, value float64) string {
+	indicator = strings.ToUpper(indicator)
+	switch {
+	case priceIndicators[indicator]:
+		return f.FormatPrice(symbol, value)
+	case indicator == "MACD":
+		return strconv.FormatFloat(value, 'f', significantDecimals(value), 64)
+	default:
+		return strconv.FormatFloat(value, 'f', 2, 64)
+	}
+}
+
+func (f *PriceFormatter) precision(symbol string) (int, bool) {
+	if f.source == nil {
+		return 0, false
+	}
+
+	f.mutex.Lock()
+	cached, found := f.cache[symbol]
+	f.mutex.Unlock()
+	if found && (cached.ok || time.Since(cached.fetchedAt) < precisionRetry) {
+		return cached.decimals, cached.ok
+	}
+
+	decimals, err := f.source.PricePrecision(symbol)
+	if err != nil {
+		log.Printf("Error fetching price precision of %s: %v", symbol, err)
+	}
+	cached = cachedPrecision{decimals: decimals, ok: err == nil, fetchedAt: time.Now()}
+
+	f.mutex.Lock()
+	f.cache[symbol] = cached
+	f.mutex.Unlock()
+	return cached.decimals, cached.ok
+}
+
+// significantDecimals returns the decimals showing four significant digits of
+// v, at least two and at most eight.
+func significantDecimals(v float64) int {
+	v = math.Abs(v)
+	if v == 0 || v >= 100 {
+		return 2
+	}
+	decimals := 3 - int(math.Floor(math.Log10(v)))
+	return min(max(decimals, 2), 8)
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"price-alert-system/config"
+)
+
+// Indicators provided by the FuturesService. Rates and divergences are percentages.
+const (
+	IndicatorFundingRate         = "FUNDING_RATE"
+	IndicatorMarkPrice           = "MARK_PRICE"
+	IndicatorIndexPrice          = "INDEX_PRICE"
+	IndicatorMarkIndexDivergence = "MARK_INDEX_DIVERGENCE"
+	IndicatorOpenInterest        = "OPEN_INTEREST"
+	IndicatorOpenInterestChange  = "OPEN_INTEREST_CHANGE"
+)
+
+// FuturesService consumes the USDⓈ-M futures mark price stream, which carries
+// the mark price, index price and funding rate, and polls open interest.
+type FuturesService struct {
+	baseURL      string
+	wsURL        string
+	symbols      []string
+	httpClient   *http.Client
+	dialer       *websocket.Dialer
+	pollInterval time.Duration
+	oiWindow     time.Duration
+	mutex        sync.RWMutex
+	state        map[string]*futuresState
+	conn         *websocket.Conn
+	done         chan struct{}
+}
+
+type futuresState struct {
+	markPrice    float64
+	indexPrice   float64
+	fundingRate  float64
+	markReady    bool
+	markTime     time.Time
+	openInterest []openInterestSample
+}
+
+type openInterestSample struct {
+	time  time.Time
+	value float64
+}
+
+type markPriceEvent struct {
+	EventType   string `json:"e"`
+	Symbol      string `json:"s"`
+	MarkPrice   string `json:"p"`
+	IndexPrice  string `json:"i"`
+	FundingRate string `json:"r"`
+}
+
+func NewFuturesService(cfg config.FuturesConfig) (*FuturesService, error) {
+	httpClient, dialer, err := newProviderClients(cfg.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make([]string, len(cfg.Provider.Symbols))
+	for i, symbol := range cfg.Provider.Symbols {
+		streams[i] = strings.ToLower(symbol) + "@" + cfg.Provider.StreamType
+	}
+
+	return &FuturesService{
+		baseURL:      cfg.Provider.BaseURL,
+		wsURL:        cfg.Provider.WSURL + "/stream?streams=" + strings.Join(streams, "/"),
+		symbols:      cfg.Provider.Symbols,
+		httpClient:   httpClient,
+		dialer:       dialer,
+		pollInterval: cfg.OpenInterestPollInterval,
+		oiWindow:     cfg.OpenInterestWindow,
+		state:        make(map[string]*futuresState),
+		done:         make(chan struct{}),
+	}, nil
+}
+
+func (s *FuturesService) Start() {
+	go s.pollOpenInterest()
+
+	for {
+		if err := s.readMarkPrices(); err != nil {
+			log.Printf("Futures stream error: %v", err)
+		}
+
+		select {
+		case <-s.done:
+			return
+		default:
+			log.Println("Futures stream closed. Reconnecting...")
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
+
+func (s *FuturesService) Stop() {
+	close(s.done)
+	s.mutex.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mutex.Unlock()
+}
+
+func (s *FuturesService) readMarkPrices() error {
+	conn, _, err := s.dialer.Dial(s.wsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s.mutex.Lock()
+	s.conn = conn
+	s.mutex.Unlock()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var envelope struct {
+			Data markPriceEvent `json:"data"`
+		}
+		if err := json.Unmarshal(message, &envelope); err != nil {
+			log.Printf("Error decoding futures message: %v", err)
+			continue
+		}
+		s.updateMarkPrice(envelope.Data)
+	}
+}
+
+func (s *FuturesService) updateMarkPrice(event markPriceEvent) {
+	if event.EventType != "markPriceUpdate" {
+		return
+	}
+	markPrice, err1 := strconv.ParseFloat(event.MarkPrice, 64)
+	indexPrice, err2 := strconv.ParseFloat(event.IndexPrice, 64)
+	fundingRate, err3 := strconv.ParseFloat(event.FundingRate, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		log.Printf("Error parsing mark price update for %s", event.Symbol)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state := s.symbolState(event.Symbol)
+	state.markPrice = markPrice
+	state.indexPrice = indexPrice
+	state.fundingRate = fundingRate
+	state.markReady = true
+	state.markTime = time.Now()
+}
+
+func (s *FuturesService) pollOpenInterest() {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, symbol := range s.symbols {
+			value, err := s.GetOpenInterest(symbol)
+			if err != nil {
+				log.Printf("Error fetching open interest for %s: %v", symbol, err)
+				continue
+			}
+			s.addOpenInterest(symbol, value, time.Now())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// GetOpenInterest fetches the current open interest of symbol in contracts.
+func (s *FuturesService) GetOpenInterest(symbol string) (float64, error) {
+	resp, err := s.httpClient.Get(fmt.Sprintf("%s/fapi/v1/openInterest?symbol=%s", s.baseURL, strings.ToUpper(symbol)))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("binance open interest request failed: %s: %s", resp.Status, body)
+	}
+
+	var result struct {
+		OpenInterest string `json:"openInterest"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(result.OpenInterest, 64)
+}
+
+func (s *FuturesService) addOpenInterest(symbol string, value float64, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.symbolState(symbol)
+	state.openInterest = append(state.openInterest, openInterestSample{time: now, value: value})
+
+	// Keep one sample older than the window as the baseline for the change
+	cutoff := now.Add(-s.oiWindow)
+	for len(state.openInterest) > 1 && !state.openInterest[1].time.After(cutoff) {
+		state.openInterest = state.openInterest[1:]
+	}
+}
+
+// symbolState must be called with the mutex held
+func (s *FuturesService) symbolState(symbol string) *futuresState {
+	symbol = strings.ToUpper(symbol)
+	state, ok := s.state[symbol]
+	if !ok {
+		state = &futuresState{}
+		s.state[symbol] = state
+	}
+	return state
+}
+
+func (s *FuturesService) Indicators() []string {
+	return []string{
+		IndicatorFundingRate,
+		IndicatorMarkPrice,
+		IndicatorIndexPrice,
+		IndicatorMarkIndexDivergence,
+		IndicatorOpenInterest,
+		IndicatorOpenInterestChange,
+	}
+}
+
+func (s *FuturesService) Indicator(symbol, name string) (float64, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	state, ok := s.state[strings.ToUpper(symbol)]
+	if !ok {
+		return 0, false
+	}
+
+	switch strings.ToUpper(name) {
+	case IndicatorFundingRate:
+		return state.fundingRate * 100, state.markReady
+	case IndicatorMarkPrice:
+		return state.markPrice, state.markReady
+	case IndicatorIndexPrice:
+		return state.indexPrice, state.markReady
+	case IndicatorMarkIndexDivergence:
+		if !state.markReady || state.indexPrice == 0 {
+			return 0, false
+		}
+		return (state.markPrice - state.indexPrice) / state.indexPrice * 100, true
+	case IndicatorOpenInterest:
+		if len(state.openInterest) == 0 {
+			return 0, false
+		}
+		return state.openInterest[len(state.openInterest)-1].value, true
+	case IndicatorOpenInterestChange:
+		n := len(state.openInterest)
+		if n < 2 {
+			return 0, false
+		}
+		oldest, latest := state.openInterest[0], state.openInterest[n-1]
+		// Only report once the samples span the whole window
+		if latest.time.Sub(oldest.time) < s.oiWindow || oldest.value == 0 {
+			return 0, false
+		}
+		return (latest.value - oldest.value) / oldest.value * 100, true
+	default:
+		return 0, false
+	}
+}
+
+// IndicatorUpdated returns when the named indicator of the symbol was last
+// received: the mark price stream or the latest open interest poll.
+func (s *FuturesService) IndicatorUpdated(symbol, name string) (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	state, ok := s.state[strings.ToUpper(symbol)]
+	if !ok {
+		return time.Time{}, false
+	}
+	switch strings.ToUpper(name) {
+	case IndicatorOpenInterest, IndicatorOpenInterestChange:
+		if len(state.openInterest) == 0 {
+			return time.Time{}, false
+		}
+		return state.openInterest[len(state.openInterest)-1].time, true
+	default:
+		return state.markTime, state.markReady
+	}
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+
+	"price-alert-system/config"
+)
+
+func TestFuturesStreamType(t *testing.T) {
+	for _, streamType := range []string{"markPrice", "markPrice@1s"} {
+		s, err := NewFuturesService(config.FuturesConfig{Provider: config.ProviderConfig{
+			WSURL:      "wss://fstream.binance.com",
+			StreamType: streamType,
+			Symbols:    []string{"BTCUSDT", "ETHUSDT"},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "wss://fstream.binance.com/stream?streams=btcusdt@" + streamType + "/ethusdt@" + streamType
+		if s.wsURL != want {
+			t.Errorf("stream URL = %s, want %s", s.wsURL, want)
+		}
+	}
+}
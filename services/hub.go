@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published on the hub
+const (
+	EventAlertTriggered = "alert.triggered"
+	EventIndicators     = "indicators"
+)
+
+// ErrSlowConsumer ends subscriptions that stopped keeping up with events.
+var ErrSlowConsumer = errors.New("subscriber too slow, events dropped")
+
+// Event is a message for stream subscribers. Events with a UserID go to that
+// user's subscriptions only; indicator events go to every subscription that
+// asked for indicators of the symbol.
+type Event struct {
+	Type   string      `json:"type"`
+	Time   time.Time   `json:"time"`
+	Data   interface{} `json:"data"`
+	UserID int         `json:"-"`
+	Symbol string      `json:"-"`
+}
+
+// IndicatorUpdate is the data of indicator events.
+type IndicatorUpdate struct {
+	Symbol     string             `json:"symbol"`
+	Price      float64            `json:"price,omitempty"`
+	Indicators map[string]float64 `json:"indicators"`
+}
+
+// Subscription receives events on C until it is closed, either by
+// Unsubscribe or by the hub when the subscriber falls behind.
+type Subscription struct {
+	C <-chan Event
+
+	ch         chan Event
+	userID     int
+	indicators bool
+	symbols    map[string]bool // Empty for all symbols
+	dropped    int
+	err        error
+}
+
+// Err returns why the hub closed the subscription, or nil.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+func (s *Subscription) wants(e Event) bool {
+	if e.Type == EventIndicators {
+		return s.indicators && (len(s.symbols) == 0 || s.symbols[e.Symbol])
+	}
+	return e.UserID == s.userID
+}
+
+// Hub fans events out to subscribers without ever blocking the publisher.
+// Each subscription has its own buffer; events that do not fit are dropped
+// for that subscriber, and a subscriber that misses maxDropped events in a
+// row is disconnected.
+type Hub struct {
+	mutex      sync.Mutex
+	subs       map[*Subscription]struct{}
+	bufferSize int
+	maxDropped int
+}
+
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		subs:       make(map[*Subscription]struct{}),
+		bufferSize: bufferSize,
+		maxDropped: bufferSize,
+	}
+}
+
+// Subscribe registers a subscription to the user's events and, if
+// indicators is set, to indicator updates of the symbols (all if empty).
+func (h *Hub) Subscribe(userID int, indicators bool, symbols []string) *Subscription {
+	ch := make(chan Event, h.bufferSize)
+	sub := &Subscription{
+		C:          ch,
+		ch:         ch,
+		userID:     userID,
+		indicators: indicators,
+		symbols:    make(map[string]bool),
+	}
+	for _, symbol := range symbols {
+		sub.symbols[strings.ToUpper(symbol)] = true
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes the subscription and closes its channel.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.remove(sub, nil)
+}
+
+func (h *Hub) remove(sub *Subscription, err error) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	sub.err = err
+	close(sub.ch)
+}
+
+// Publish hands e to every interested subscription without blocking.
+func (h *Hub) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for sub := range h.subs {
+		if !sub.wants(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+			if sub.dropped >= h.maxDropped {
+				h.remove(sub, ErrSlowConsumer)
+			}
+		}
+	}
+}
+
+// Subscribers returns the number of open subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.subs)
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrIdempotencyMismatch is returned when a key is reused for a
+	// different request.
+	ErrIdempotencyMismatch = errors.New("idempotency key was used for a different request")
+	// ErrIdempotencyInProgress is returned while the first request with a
+	// key has not finished.
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is in progress")
+)
+
+const (
+	// idempotencyPruneInterval is how often expired keys are deleted
+	idempotencyPruneInterval = time.Hour
+	// idempotencyClaimTimeout is how long a claimed key without a response
+	// blocks retries, in case the server stopped before completing it
+	idempotencyClaimTimeout = 5 * time.Minute
+)
+
+// StoredResponse is the response of the first request with an idempotency
+// key, returned again for its retries.
+type StoredResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore remembers the responses of requests with an idempotency
+// key so retries return the original result instead of running again. Keys
+// are scoped to the caller and kept for the retention window.
+type IdempotencyStore struct {
+	db        *sql.DB
+	retention time.Duration
+	done      chan struct{}
+}
+
+func NewIdempotencyStore(db *sql.DB, retention time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		db:        db,
+		retention: retention,
+		done:      make(chan struct{}),
+	}
+}
+
+// Begin claims a key for a request with the given fingerprint. It returns
+// nil if the caller should run the request and then Complete or Release
+// the key, and the stored response if the request already ran. Reusing a
+// key for another fingerprint fails with ErrIdempotencyMismatch, and for a
+// request still running with ErrIdempotencyInProgress.
+func (s *IdempotencyStore) Begin(scope, key, fingerprint string) (*StoredResponse, error) {
+	// Expired and abandoned keys are free to be claimed again
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2
+						AND (expires_at <= CURRENT_TIMESTAMP OR (status IS NULL AND created_at <= CURRENT_TIMESTAMP - $3 * INTERVAL '1 second'))`,
+		scope, key, idempotencyClaimTimeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.db.Exec(`INSERT INTO idempotency_keys (scope, key, fingerprint, expires_at)
+						  VALUES ($1, $2, $3, CURRENT_TIMESTAMP + $4 * INTERVAL '1 second')
+						  ON CONFLICT (scope, key) DO NOTHING`, scope, key, fingerprint, s.retention.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 1 {
+		return nil, err
+	}
+
+	var stored StoredResponse
+	var storedFingerprint string
+	var status sql.NullInt64
+	err = s.db.QueryRow(`SELECT fingerprint, status, content_type, body FROM idempotency_keys WHERE scope = $1 AND key = $2`,
+		scope, key).Scan(&storedFingerprint, &status, &stored.ContentType, &stored.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the insert and the select; the retry may run
+		return s.Begin(scope, key, fingerprint)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case storedFingerprint != fingerprint:
+		return nil, ErrIdempotencyMismatch
+	case !status.Valid:
+		return nil, ErrIdempotencyInProgress
+	}
+	stored.Status = int(status.Int64)
+	return &stored, nil
+}
+
+// Complete stores the response of a request claimed with Begin.
+func (s *IdempotencyStore) Complete(scope, key string, response *StoredResponse) error {
+	_, err := s.db.Exec(`UPDATE idempotency_keys SET status = $3, content_type = $4, body = $5 WHERE scope = $1 AND key = $2`,
+		scope, key, response.Status, response.ContentType, response.Body)
+	return err
+}
+
+// Release frees a key claimed with Begin without storing a response, so the
+// request can be retried, e.g. after a server error.
+func (s *IdempotencyStore) Release(scope, key string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status IS NULL`, scope, key)
+	return err
+}
+
+// Start deletes expired keys periodically until Stop is called.
+func (s *IdempotencyStore) Start() {
+	ticker := time.NewTicker(idempotencyPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP`); err != nil {
+			log.Printf("Error deleting expired idempotency keys: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *IdempotencyStore) Stop() {
+	close(s.done)
+}
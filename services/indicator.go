@@ -2,65 +2,218 @@ package services
 
 import (
 	"price-alert-system/models"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+// IndicatorSource resolves the current value of named indicators per symbol.
+// Indicator returns false while the value is not available yet.
+type IndicatorSource interface {
+	Indicators() []string
+	Indicator(symbol, name string) (float64, bool)
+}
+
+// indicatorClock is implemented by sources that know when the indicators
+// of a symbol were last updated.
+type indicatorClock interface {
+	IndicatorUpdated(symbol, name string) (time.Time, bool)
+}
+
+const (
+	// maxSeriesKlines is the number of klines kept per symbol
+	maxSeriesKlines = 100
+	// minIndicatorKlines is the number of klines needed before indicators
+	// are ready
+	minIndicatorKlines = 26
+)
+
+// Parameters of the calculated indicators: the RSI period and the MACD
+// fast, slow and signal periods
+var (
+	rsiParams  = []int{14}
+	macdParams = []int{12, 26, 9}
+)
+
 type IndicatorService struct {
 	mutex        sync.RWMutex
-	klines       []models.Kline
-	rsi          float64
-	macd         float64
-	lastCalc     int64
+	series       map[string]*indicatorSeries
 	calcInterval int64
 }
 
+// indicatorSeries holds the klines and indicators of one symbol
+type indicatorSeries struct {
+	klines   []models.Kline
+	rsi      float64
+	macd     float64
+	ready    bool
+	lastCalc int64 // close time (ms) of the kline last calculated at
+}
+
 func NewIndicatorService() *IndicatorService {
 	return &IndicatorService{
-		calcInterval: 60, // Calculate indicators every 60 seconds
-		lastCalc:     time.Now().Unix(),
+		series:       make(map[string]*indicatorSeries),
+		calcInterval: 60 * 1000, // Calculate indicators every 60 seconds of kline time (ms)
 	}
 }
 
-func (s *IndicatorService) UpdateKlines(kline models.Kline) {
+func (s *IndicatorService) UpdateKlines(symbol string, kline models.Kline) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	// Update the last kline if it's within the same minute, otherwise append
-	if len(s.klines) > 0 && s.klines[len(s.klines)-1].CloseTime/60 == kline.CloseTime/60 {
-		s.klines[len(s.klines)-1] = kline
+	symbol = strings.ToUpper(symbol)
+	series, ok := s.series[symbol]
+	if !ok {
+		series = &indicatorSeries{}
+		s.series[symbol] = series
+	}
+
+	// Update the last kline if it opened within the same minute, otherwise append
+	if len(series.klines) > 0 && series.klines[len(series.klines)-1].OpenTime/60000 == kline.OpenTime/60000 {
+		series.klines[len(series.klines)-1] = kline
 	} else {
-		s.klines = append(s.klines, kline)
-		if len(s.klines) > 100 {
-			s.klines = s.klines[1:]
+		series.klines = append(series.klines, kline)
+		if len(series.klines) > maxSeriesKlines {
+			series.klines = series.klines[1:]
 		}
 	}
 
 	// Only calculate indicators if the calc interval has passed
-	if kline.CloseTime-s.lastCalc >= s.calcInterval {
-		s.calculateIndicators()
-		s.lastCalc = kline.CloseTime
+	if kline.CloseTime-series.lastCalc >= s.calcInterval {
+		series.calculateIndicators()
+		series.lastCalc = kline.CloseTime
 	}
 }
 
-func (s *IndicatorService) calculateIndicators() {
-	if len(s.klines) < 26 {
+func (s *indicatorSeries) calculateIndicators() {
+	if len(s.klines) < minIndicatorKlines {
 		return // Ensure there are enough klines to calculate indicators
 	}
 
-	closes := make([]float64, len(s.klines))
-	for i, k := range s.klines {
+	closes := klineCloses(s.klines)
+	s.rsi, _ = calculateIndicator("RSI", rsiParams, closes)
+	s.macd, _ = calculateIndicator("MACD", macdParams, closes)
+	s.ready = true
+}
+
+func klineCloses(klines []models.Kline) []float64 {
+	closes := make([]float64, len(klines))
+	for i, k := range klines {
 		closes[i] = k.Close
 	}
+	return closes
+}
+
+// calculateIndicator calculates RSI or MACD with params from closes. It
+// returns false if there are too few closes, like the live indicators do.
+func calculateIndicator(name string, params []int, closes []float64) (float64, bool) {
+	switch name {
+	case "RSI":
+		if len(closes) < minIndicatorKlines || len(closes) < params[0]+1 {
+			return 0, false
+		}
+		return calculateRSI(closes, params[0]), true
+	case "MACD":
+		if len(closes) < minIndicatorKlines || len(closes) < params[1] {
+			return 0, false
+		}
+		macd, _, _ := calculateMACD(closes, params[0], params[1], params[2])
+		return macd, true
+	}
+	return 0, false
+}
+
+func (s *IndicatorService) GetIndicators(symbol string) (float64, float64) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	series, ok := s.series[strings.ToUpper(symbol)]
+	if !ok {
+		return 0, 0
+	}
+	return series.rsi, series.macd
+}
+
+func (s *IndicatorService) Indicators() []string {
+	return []string{"RSI", "MACD"}
+}
+
+func (s *IndicatorService) Indicator(symbol, name string) (float64, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	series, ok := s.series[strings.ToUpper(symbol)]
+	if !ok || !series.ready {
+		return 0, false
+	}
+	switch strings.ToUpper(name) {
+	case "RSI":
+		return series.rsi, true
+	case "MACD":
+		return series.macd, true
+	default:
+		return 0, false
+	}
+}
 
-	s.rsi = calculateRSI(closes, 14)
-	s.macd, _, _ = calculateMACD(closes, 12, 26, 9)
+// Klines returns a copy of the symbol's buffered klines, oldest first
+func (s *IndicatorService) Klines(symbol string) []models.Kline {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	series, ok := s.series[strings.ToUpper(symbol)]
+	if !ok {
+		return nil
+	}
+	return append([]models.Kline(nil), series.klines...)
 }
 
-func (s *IndicatorService) GetIndicators() (float64, float64) {
+// Price returns the latest close of the symbol
+func (s *IndicatorService) Price(symbol string) (float64, bool) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	return s.rsi, s.macd
+
+	series, ok := s.series[strings.ToUpper(symbol)]
+	if !ok || len(series.klines) == 0 {
+		return 0, false
+	}
+	return series.klines[len(series.klines)-1].Close, true
+}
+
+// IndicatorUpdated returns the time of the last kline the symbol's
+// indicators were calculated from
+func (s *IndicatorService) IndicatorUpdated(symbol, name string) (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	series, ok := s.series[strings.ToUpper(symbol)]
+	if !ok || len(series.klines) == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(series.klines[len(series.klines)-1].CloseTime), true
+}
+
+// Ready reports whether the symbol has enough klines for its indicators
+func (s *IndicatorService) Ready(symbol string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	series, ok := s.series[strings.ToUpper(symbol)]
+	return ok && series.ready
+}
+
+// Symbols returns the symbols klines have been received for
+func (s *IndicatorService) Symbols() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	symbols := make([]string, 0, len(s.series))
+	for symbol := range s.series {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
 }
 
 // Calculate RSI for a set of prices
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"price-alert-system/models"
+)
+
+func tradeKline(at time.Time, price float64) models.Kline {
+	ms := at.UnixMilli()
+	return models.Kline{OpenTime: ms, Open: price, High: price, Low: price, Close: price, CloseTime: ms}
+}
+
+func TestIndicatorServiceBucketsKlinesByMinute(t *testing.T) {
+	s := NewIndicatorService()
+	start := time.Date(2024, 5, 1, 13, 45, 0, 0, time.UTC)
+
+	// Trades within a minute update its kline; the next minute starts a new one
+	s.UpdateKlines("BTCUSDT", tradeKline(start, 100))
+	s.UpdateKlines("BTCUSDT", tradeKline(start.Add(20*time.Second), 101))
+	s.UpdateKlines("BTCUSDT", tradeKline(start.Add(59*time.Second), 102))
+	s.UpdateKlines("BTCUSDT", tradeKline(start.Add(61*time.Second), 103))
+
+	klines := s.Klines("BTCUSDT")
+	if len(klines) != 2 {
+		t.Fatalf("got %d klines, want 2: %+v", len(klines), klines)
+	}
+	if klines[0].Close != 102 || klines[1].Close != 103 {
+		t.Errorf("closes = %v, %v, want 102, 103", klines[0].Close, klines[1].Close)
+	}
+}
+
+func TestIndicatorServiceCalculatesEveryMinute(t *testing.T) {
+	s := NewIndicatorService()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var at time.Time
+	for i := 0; i < minIndicatorKlines+5; i++ {
+		at = start.Add(time.Duration(i) * time.Minute)
+		s.UpdateKlines("BTCUSDT", tradeKline(at, 100+float64(i%4)))
+	}
+	if !s.Ready("BTCUSDT") {
+		t.Fatal("indicators are not ready after a kline a minute")
+	}
+	rsi, _ := s.Indicator("BTCUSDT", "RSI")
+
+	// A jump within the minute is only picked up a minute after the last calculation
+	s.UpdateKlines("BTCUSDT", tradeKline(at.Add(30*time.Second), 200))
+	if got, _ := s.Indicator("BTCUSDT", "RSI"); got != rsi {
+		t.Errorf("RSI recalculated after 30s: %v, want %v", got, rsi)
+	}
+	s.UpdateKlines("BTCUSDT", tradeKline(at.Add(time.Minute), 200))
+	if got, _ := s.Indicator("BTCUSDT", "RSI"); got == rsi {
+		t.Errorf("RSI not recalculated after a minute: %v", got)
+	}
+}
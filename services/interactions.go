@@ -0,0 +1,430 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions offered by the buttons of Slack and Discord notifications
+const (
+	ActionSnooze = "snooze"
+	ActionRearm  = "rearm"
+	ActionCancel = "cancel"
+)
+
+// actionPrefix marks the button IDs of alert actions: "alert_<action>"
+const actionPrefix = "alert_"
+
+// slackSignatureTolerance bounds the age of signed Slack requests
+const slackSignatureTolerance = 5 * time.Minute
+
+// buttonMACLength is the number of HMAC bytes kept in button values, which
+// Discord limits to 100 characters with the action
+const buttonMACLength = 16
+
+var (
+	ErrInvalidSignature = errors.New("invalid interaction signature")
+	ErrUnknownAction    = errors.New("unknown action")
+	ErrStaleAction      = errors.New("action of an earlier occurrence")
+)
+
+// interactionPrincipal acts on the alerts of message buttons. Button values
+// are signed with the ButtonSigner when the notification is sent, so a
+// request may only change the alert and occurrence its message was about.
+var interactionPrincipal = &Principal{Admin: true, Method: "interaction"}
+
+// ButtonSigner signs the alert, action and occurrence of message buttons.
+// The platform signatures only prove that a request came from Slack or
+// Discord; anyone can post a message with buttons naming any alert.
+type ButtonSigner struct {
+	key []byte
+}
+
+// NewButtonSigner returns a signer with the INTERACTION_SECRET. Without a
+// secret the buttons are still sent but every action is rejected.
+func NewButtonSigner(secret string) *ButtonSigner {
+	return &ButtonSigner{key: []byte(secret)}
+}
+
+// value returns the signed button value of an action on an alert
+// occurrence: "<alert ID>.<occurrence>.<MAC>"
+func (s *ButtonSigner) value(action string, alertID, occurrence int) string {
+	return fmt.Sprintf("%d.%d.%s", alertID, occurrence, s.mac(action, alertID, occurrence))
+}
+
+func (s *ButtonSigner) mac(action string, alertID, occurrence int) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s:%d:%d", action, alertID, occurrence)
+	return hex.EncodeToString(mac.Sum(nil)[:buttonMACLength])
+}
+
+// verify returns the alert ID and occurrence of a button value signed for
+// action.
+func (s *ButtonSigner) verify(action, value string) (alertID, occurrence int, err error) {
+	parts := strings.Split(value, ".")
+	if len(s.key) == 0 || len(parts) != 3 {
+		return 0, 0, ErrInvalidSignature
+	}
+	alertID, idErr := strconv.Atoi(parts[0])
+	occurrence, occErr := strconv.Atoi(parts[1])
+	if idErr != nil || occErr != nil || !hmac.Equal([]byte(parts[2]), []byte(s.mac(action, alertID, occurrence))) {
+		return 0, 0, ErrInvalidSignature
+	}
+	return alertID, occurrence, nil
+}
+
+// Interactions runs the alert actions of message buttons. Slack and Discord
+// call the interaction endpoints with requests signed with the app's Slack
+// signing secret and Discord public key.
+type Interactions struct {
+	alerts           *AlertService
+	signer           *ButtonSigner
+	slackSecret      []byte
+	discordPublicKey ed25519.PublicKey
+	snooze           time.Duration
+}
+
+// NewInteractions takes the Discord public key hex encoded, as the developer
+// portal shows it. A platform without its secret rejects every request.
+func NewInteractions(alerts *AlertService, signer *ButtonSigner, slackSigningSecret, discordPublicKey string, snooze time.Duration) *Interactions {
+	key, _ := hex.DecodeString(discordPublicKey)
+	i := &Interactions{
+		alerts:      alerts,
+		signer:      signer,
+		slackSecret: []byte(slackSigningSecret),
+		snooze:      snooze,
+	}
+	if len(key) == ed25519.PublicKeySize {
+		i.discordPublicKey = key
+	}
+	return i
+}
+
+// Apply runs an action on an occurrence of an alert and returns the reply
+// for the user. It returns ErrStaleAction if the alert has moved on to
+// another occurrence.
+func (i *Interactions) Apply(alertID, occurrence int, action string) (string, error) {
+	alert, err := i.alerts.GetAlert(interactionPrincipal, alertID)
+	if err != nil {
+		return "", err
+	}
+	if alert.Occurrence != occurrence {
+		return "", ErrStaleAction
+	}
+
+	switch action {
+	case ActionSnooze:
+		alert, err := i.alerts.SnoozeAlert(interactionPrincipal, alertID, i.snooze)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Alert #%d snoozed until %s.", alertID, alert.SnoozedUntil.UTC().Format(time.RFC1123)), nil
+	case ActionRearm:
+		if _, err := i.alerts.RearmAlert(interactionPrincipal, alertID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Alert #%d re-armed.", alertID), nil
+	case ActionCancel:
+		if err := i.alerts.CancelAlert(interactionPrincipal, alertID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Alert #%d cancelled.", alertID), nil
+	default:
+		return "", ErrUnknownAction
+	}
+}
+
+// apply runs the action of a button ID and signed value and always returns
+// a reply
+func (i *Interactions) apply(actionID, value string) string {
+	action := strings.TrimPrefix(actionID, actionPrefix)
+	if !strings.HasPrefix(actionID, actionPrefix) {
+		return "Unknown action."
+	}
+	alertID, occurrence, err := i.signer.verify(action, value)
+	if err != nil {
+		log.Printf("Rejected %s action with an invalid button signature", action)
+		return "Unknown action."
+	}
+
+	reply, err := i.Apply(alertID, occurrence, action)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Sprintf("Alert #%d can no longer be changed.", alertID)
+	case errors.Is(err, ErrStaleAction):
+		return fmt.Sprintf("Alert #%d has been re-armed since this message, use its latest message.", alertID)
+	case errors.Is(err, ErrUnknownAction):
+		return "Unknown action."
+	case err != nil:
+		log.Printf("Error applying %s to alert %d: %v", action, alertID, err)
+		return "Something went wrong, please try again."
+	}
+	log.Printf("Alert %d: %s from a message action", alertID, action)
+	return reply
+}
+
+// VerifySlack checks the v0 signature of a Slack request: an HMAC-SHA256 of
+// "v0:<timestamp>:<body>" with the signing secret.
+func (i *Interactions) VerifySlack(timestamp, signature string, body []byte) error {
+	if len(i.slackSecret) == 0 {
+		return ErrInvalidSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || math.Abs(time.Since(time.Unix(ts, 0)).Seconds()) > slackSignatureTolerance.Seconds() {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, i.slackSecret)
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// HandleSlack runs the button actions of a verified Slack interaction
+// payload. Slack ignores the response body of block actions, so the replies
+// are posted to the payload's response URL.
+func (i *Interactions) HandleSlack(payload []byte) error {
+	var interaction struct {
+		Type        string `json:"type"`
+		ResponseURL string `json:"response_url"`
+		Actions     []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal(payload, &interaction); err != nil {
+		return err
+	}
+	if interaction.Type != "block_actions" {
+		return nil
+	}
+
+	for _, action := range interaction.Actions {
+		// Link buttons have no value and need no action
+		if action.Value == "" {
+			continue
+		}
+		reply := i.apply(action.ActionID, action.Value)
+		if interaction.ResponseURL == "" {
+			continue
+		}
+		go func(text string) {
+			err := postJSON(notifierClient, interaction.ResponseURL, map[string]interface{}{
+				"response_type":    "ephemeral",
+				"replace_original": false,
+				"text":             text,
+			}, nil)
+			if err != nil {
+				log.Printf("Error replying to Slack interaction: %v", err)
+			}
+		}(reply)
+	}
+	return nil
+}
+
+// VerifyDiscord checks the Ed25519 signature of "<timestamp><body>".
+func (i *Interactions) VerifyDiscord(timestamp, signature string, body []byte) error {
+	sig, err := hex.DecodeString(signature)
+	if i.discordPublicKey == nil || err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(i.discordPublicKey, append([]byte(timestamp), body...), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Discord interaction and response types
+const (
+	discordPing             = 1
+	discordMessageComponent = 3
+	discordPong             = 1
+	discordChannelMessage   = 4
+	discordEphemeral        = 1 << 6
+)
+
+// HandleDiscord answers a verified Discord interaction. Button actions are
+// answered with a message only the clicking user sees.
+func (i *Interactions) HandleDiscord(body []byte) (interface{}, error) {
+	var interaction struct {
+		Type int `json:"type"`
+		Data struct {
+			CustomID string `json:"custom_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		return nil, err
+	}
+
+	switch interaction.Type {
+	case discordPing:
+		return map[string]int{"type": discordPong}, nil
+	case discordMessageComponent:
+		parts := strings.SplitN(interaction.Data.CustomID, ":", 2)
+		value := ""
+		if len(parts) == 2 {
+			value = parts[1]
+		}
+		return map[string]interface{}{
+			"type": discordChannelMessage,
+			"data": map[string]interface{}{
+				"content": i.apply(parts[0], value),
+				"flags":   discordEphemeral,
+			},
+		}, nil
+	default:
+		return nil, ErrUnknownAction
+	}
+}
+
+// buttonValue returns the signed button values of a notification
+func (s *ButtonSigner) buttonValue(n *Notification) func(action string) string {
+	return func(action string) string {
+		return s.value(action, n.Alert.ID, n.Alert.Occurrence)
+	}
+}
+
+// alertURL is where the alert can be looked up
+func alertURL(publicURL string, alertID int) string {
+	return fmt.Sprintf("%s/alerts/%d", strings.TrimSuffix(publicURL, "/"), alertID)
+}
+
+// slackHeaderLimit is the longest header block text Slack accepts
+const slackHeaderLimit = 150
+
+// slackBlocks lays out a notification as Block Kit blocks with the alert's
+// details and action buttons. value returns the signed value of an action.
+func slackBlocks(msg *Message, data *TemplateData, link string, value func(action string) string) []interface{} {
+	fields := []interface{}{
+		map[string]string{"type": "mrkdwn", "text": "*Symbol*\n" + data.Symbol},
+		map[string]string{"type": "mrkdwn", "text": "*Indicator*\n" + data.Indicator},
+		map[string]string{"type": "mrkdwn", "text": "*Threshold*\n" + data.Condition + " " + data.Value},
+		map[string]string{"type": "mrkdwn", "text": "*Current value*\n" + data.CurrentValue},
+	}
+	if data.Price != "" {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": "*Price*\n" + data.Price})
+	}
+
+	button := func(action, text, style string) map[string]interface{} {
+		b := map[string]interface{}{
+			"type":      "button",
+			"action_id": actionPrefix + action,
+			"value":     value(action),
+			"text":      map[string]string{"type": "plain_text", "text": text},
+		}
+		if style != "" {
+			b["style"] = style
+		}
+		return b
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"type": "header",
+			"text": map[string]string{"type": "plain_text", "text": truncate(msg.Subject, slackHeaderLimit)},
+		},
+		map[string]interface{}{"type": "section", "fields": fields},
+		map[string]interface{}{
+			"type": "context",
+			"elements": []interface{}{
+				map[string]string{"type": "mrkdwn", "text": fmt.Sprintf("Alert #%d, triggered %s", data.AlertID, data.TriggeredAt)},
+			},
+		},
+		map[string]interface{}{
+			"type": "actions",
+			"elements": []interface{}{
+				button(ActionSnooze, "Snooze", ""),
+				button(ActionRearm, "Re-arm", "primary"),
+				button(ActionCancel, "Cancel", "danger"),
+				map[string]interface{}{
+					"type":      "button",
+					"action_id": "alert_link",
+					"url":       link,
+					"text":      map[string]string{"type": "plain_text", "text": "View alert"},
+				},
+			},
+		},
+	}
+}
+
+// Discord component types and button styles
+const (
+	discordActionRow      = 1
+	discordButton         = 2
+	discordStylePrimary   = 1
+	discordStyleSecondary = 2
+	discordStyleDanger    = 4
+	discordStyleLink      = 5
+)
+
+// discordMessage lays out a notification as an embed with the alert's
+// details and a row of action buttons. chart is set if the chart is
+// attached to the message, and value returns the signed value of an action.
+func discordMessage(msg *Message, data *TemplateData, link string, chart bool, value func(action string) string) map[string]interface{} {
+	fields := []map[string]interface{}{
+		{"name": "Symbol", "value": data.Symbol, "inline": true},
+		{"name": "Indicator", "value": data.Indicator, "inline": true},
+		{"name": "Threshold", "value": data.Condition + " " + data.Value, "inline": true},
+		{"name": "Current value", "value": data.CurrentValue, "inline": true},
+	}
+	if data.Price != "" {
+		fields = append(fields, map[string]interface{}{"name": "Price", "value": data.Price, "inline": true})
+	}
+	embed := map[string]interface{}{
+		"title":  msg.Subject,
+		"url":    link,
+		"fields": fields,
+		"footer": map[string]string{"text": fmt.Sprintf("Alert #%d, triggered %s", data.AlertID, data.TriggeredAt)},
+	}
+	if chart {
+		embed["image"] = map[string]string{"url": "attachment://" + chartFilename}
+	}
+
+	button := func(action, label string, style int) map[string]interface{} {
+		return map[string]interface{}{
+			"type":      discordButton,
+			"style":     style,
+			"label":     label,
+			"custom_id": actionPrefix + action + ":" + value(action),
+		}
+	}
+
+	return map[string]interface{}{
+		"embeds": []interface{}{embed},
+		"components": []interface{}{
+			map[string]interface{}{
+				"type": discordActionRow,
+				"components": []interface{}{
+					button(ActionSnooze, "Snooze", discordStyleSecondary),
+					button(ActionRearm, "Re-arm", discordStylePrimary),
+					button(ActionCancel, "Cancel", discordStyleDanger),
+					map[string]interface{}{"type": discordButton, "style": discordStyleLink, "label": "View alert", "url": link},
+				},
+			},
+		},
+	}
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
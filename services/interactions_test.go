@@ -0,0 +1,34 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestButtonSignerVerify(t *testing.T) {
+	signer := NewButtonSigner(strings.Repeat("s", 32))
+	value := signer.value(ActionCancel, 42, 3)
+
+	alertID, occurrence, err := signer.verify(ActionCancel, value)
+	if err != nil || alertID != 42 || occurrence != 3 {
+		t.Fatalf("verify(%q) = %d, %d, %v; want 42, 3, nil", value, alertID, occurrence, err)
+	}
+
+	mac := value[strings.LastIndex(value, ".")+1:]
+	rejected := map[string]struct{ action, value string }{
+		"other action":     {ActionRearm, value},
+		"other alert":      {ActionCancel, "43.3." + mac},
+		"other occurrence": {ActionCancel, "42.2." + mac},
+		"unsigned":         {ActionCancel, "42"},
+		"other secret":     {ActionCancel, NewButtonSigner(strings.Repeat("x", 32)).value(ActionCancel, 42, 3)},
+	}
+	for name, tc := range rejected {
+		if _, _, err := signer.verify(tc.action, tc.value); err != ErrInvalidSignature {
+			t.Errorf("%s: verify(%q, %q) = %v, want ErrInvalidSignature", name, tc.action, tc.value, err)
+		}
+	}
+
+	if _, _, err := NewButtonSigner("").verify(ActionCancel, NewButtonSigner("").value(ActionCancel, 42, 3)); err != ErrInvalidSignature {
+		t.Errorf("verify without a secret = %v, want ErrInvalidSignature", err)
+	}
+}
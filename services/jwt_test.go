@@ -0,0 +1,182 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "an HS256 secret of at least 32 characters"
+
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTVerify(t *testing.T) {
+	key, other := testRSAKey(t), testRSAKey(t)
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &jwtVerifier{
+		secret:   []byte(testJWTSecret),
+		keys:     map[string]*rsa.PublicKey{"k1": &key.PublicKey},
+		issuer:   "https://id.example.com",
+		audience: "alerts",
+	}
+
+	now := time.Now()
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "7", "iss": "https://id.example.com", "aud": "alerts", "exp": now.Add(time.Hour).Unix()}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+			} else {
+				c[name] = value
+			}
+		}
+		return c
+	}
+	hs256 := func(changes jwt.MapClaims) string {
+		return signToken(t, jwt.SigningMethodHS256, "", claims(changes), []byte(testJWTSecret))
+	}
+	rs256 := signToken(t, jwt.SigningMethodRS256, "k1", claims(nil), key)
+	parts := strings.Split(rs256, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"HS256", hs256(nil), true},
+		{"RS256", rs256, true},
+		{"RS256 without kid", signToken(t, jwt.SigningMethodRS256, "", claims(nil), key), true},
+		{"audience list", hs256(jwt.MapClaims{"aud": []string{"billing", "alerts"}}), true},
+		{"expired within leeway", hs256(jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()}), true},
+
+		{"alg none", signToken(t, jwt.SigningMethodNone, "", claims(nil), jwt.UnsafeAllowNoneSignatureType), false},
+		{"HS256 signed with the RSA public key", signToken(t, jwt.SigningMethodHS256, "k1", claims(nil), publicDER), false},
+		{"RS512", signToken(t, jwt.SigningMethodRS512, "k1", claims(nil), key), false},
+		{"other secret", signToken(t, jwt.SigningMethodHS256, "", claims(nil), []byte("another secret of at least 32 characters")), false},
+		{"other RSA key", signToken(t, jwt.SigningMethodRS256, "k1", claims(nil), other), false},
+		{"unknown kid", signToken(t, jwt.SigningMethodRS256, "k2", claims(nil), key), false},
+
+		{"expired", hs256(jwt.MapClaims{"exp": now.Add(-2 * time.Minute).Unix()}), false},
+		{"no exp", hs256(jwt.MapClaims{"exp": nil}), false},
+		{"not valid yet", hs256(jwt.MapClaims{"nbf": now.Add(2 * time.Minute).Unix()}), false},
+		{"other issuer", hs256(jwt.MapClaims{"iss": "https://evil.example.com"}), false},
+		{"no issuer", hs256(jwt.MapClaims{"iss": nil}), false},
+		{"other audience", hs256(jwt.MapClaims{"aud": "billing"}), false},
+
+		{"two segments", parts[0] + "." + parts[1], false},
+		{"four segments", rs256 + ".e30", false},
+		{"header not base64", "!!!." + parts[1] + "." + parts[2], false},
+		{"header not JSON", base64.RawURLEncoding.EncodeToString([]byte("alg")) + "." + parts[1] + "." + parts[2], false},
+		{"claims not JSON", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte("sub")) + "." + parts[2], false},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := v.verify(tt.token)
+			if tt.valid && (err != nil || subject != "7") {
+				t.Errorf("verify() = %q, %v, want subject 7", subject, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("verify() accepted the token with subject %q", subject)
+			}
+		})
+	}
+}
+
+func TestJWTVerifyAlgorithmsNeedKeys(t *testing.T) {
+	key := testRSAKey(t)
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"sub": "7", "exp": time.Now().Add(time.Hour).Unix()}
+
+	// With only RSA keys, HS256 tokens are refused whatever they are signed with
+	rsaOnly := &jwtVerifier{keys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}}
+	token := signToken(t, jwt.SigningMethodHS256, "k1", claims, publicDER)
+	if _, err := rsaOnly.verify(token); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("verify() of an HS256 token signed with the public key = %v, want ErrTokenSignatureInvalid", err)
+	}
+
+	// With only a secret, RS256 tokens are refused
+	secretOnly := &jwtVerifier{secret: []byte(testJWTSecret)}
+	if _, err := secretOnly.verify(signToken(t, jwt.SigningMethodRS256, "k1", claims, key)); err == nil {
+		t.Error("verify() accepted an RS256 token without RSA keys")
+	}
+
+	if _, err := (&jwtVerifier{}).verify(signToken(t, jwt.SigningMethodHS256, "", claims, []byte(testJWTSecret))); err == nil {
+		t.Error("verify() accepted a token without any key configured")
+	}
+}
+
+func TestAuthenticateJWKS(t *testing.T) {
+	key := testRSAKey(t)
+	jwk := map[string]string{
+		"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+	encryption := map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": jwk["n"], "e": jwk["e"]}
+	data, err := json.Marshal(map[string]interface{}{"keys": []interface{}{jwk, encryption}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewAuthenticator(nil, "", path, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	p, err := auth.Authenticate(signToken(t, jwt.SigningMethodRS256, "k1", jwt.MapClaims{"sub": "7", "exp": exp}, key))
+	if err != nil || p.UserID != 7 || p.Method != "jwt" {
+		t.Errorf("Authenticate() = %+v, %v, want user 7", p, err)
+	}
+	// Keys for other uses are not loaded
+	_, err = auth.Authenticate(signToken(t, jwt.SigningMethodRS256, "enc", jwt.MapClaims{"sub": "7", "exp": exp}, key))
+	if !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate() with an encryption key = %v, want ErrUnauthenticated", err)
+	}
+	_, err = auth.Authenticate(signToken(t, jwt.SigningMethodRS256, "k1", jwt.MapClaims{"sub": "admin", "exp": exp}, key))
+	if !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate() with a non-numeric subject = %v, want ErrUnauthenticated", err)
+	}
+}
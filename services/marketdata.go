@@ -0,0 +1,305 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"price-alert-system/models"
+)
+
+var (
+	ErrUnknownSymbol = errors.New("symbol is not tracked")
+	// ErrNoMarketData is returned for tracked symbols no trade has been
+	// received for yet.
+	ErrNoMarketData = errors.New("no market data received yet")
+	// ErrInvalidMarketQuery is wrapped by errors caused by the query itself.
+	ErrInvalidMarketQuery = errors.New("invalid market data query")
+)
+
+const (
+	// liveInterval names the klines of the trade stream, as opposed to the
+	// exchange's klines of an interval
+	liveInterval    = "live"
+	maxMarketKlines = 1000
+	// maxIndicatorPeriod is the longest period params may set. Indicators
+	// are calculated from at most maxSeriesKlines klines, live or fetched
+	// for an interval, which longer periods would not fit in.
+	maxIndicatorPeriod = maxSeriesKlines - 1
+)
+
+// MarketDataService shows the market data alerts are evaluated on: the live
+// klines, prices and indicators, and for comparison the same indicators
+// calculated from the exchange's klines of an interval.
+type MarketDataService struct {
+	indicators *IndicatorService
+	alerts     *AlertService
+	binance    *BinanceService
+	symbols    []string
+}
+
+// NewMarketDataService tracks the configured symbols and any other symbol
+// trades are received for.
+func NewMarketDataService(indicators *IndicatorService, alerts *AlertService, binance *BinanceService, symbols []string) *MarketDataService {
+	return &MarketDataService{
+		indicators: indicators,
+		alerts:     alerts,
+		binance:    binance,
+		symbols:    symbols,
+	}
+}
+
+// Symbols returns the state of every tracked symbol's live data.
+func (s *MarketDataService) Symbols() []*models.SymbolStatus {
+	seen := make(map[string]bool)
+	var symbols []string
+	for _, symbol := range append(append([]string(nil), s.symbols...), s.indicators.Symbols()...) {
+		symbol = strings.ToUpper(symbol)
+		if !seen[symbol] {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+
+	statuses := make([]*models.SymbolStatus, 0, len(symbols))
+	for _, symbol := range symbols {
+		status := &models.SymbolStatus{
+			Symbol: symbol,
+			Klines: len(s.indicators.Klines(symbol)),
+			Ready:  s.indicators.Ready(symbol),
+		}
+		if price, ok := s.indicators.Price(symbol); ok {
+			status.Price = &price
+		}
+		if updated, ok := s.indicators.IndicatorUpdated(symbol, ""); ok {
+			status.DataAge = dataAge(updated)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Price returns the symbol's latest traded price.
+func (s *MarketDataService) Price(symbol string) (*models.SymbolPrice, error) {
+	symbol, err := s.trackedSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	price, ok := s.indicators.Price(symbol)
+	if !ok {
+		return nil, ErrNoMarketData
+	}
+	result := &models.SymbolPrice{Symbol: symbol, Price: price}
+	if updated, ok := s.indicators.IndicatorUpdated(symbol, ""); ok {
+		result.DataAge = dataAge(updated)
+	}
+	return result, nil
+}
+
+// Klines returns the symbol's last limit klines: the live ones if interval
+// is empty or "live", otherwise the exchange's closed klines of interval.
+func (s *MarketDataService) Klines(symbol, interval string, limit int) (*models.SymbolKlines, error) {
+	symbol, err := s.trackedSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		limit = maxSeriesKlines
+	}
+	if limit < 1 || limit > maxMarketKlines {
+		return nil, fmt.Errorf("%w: limit must be 1 to %d", ErrInvalidMarketQuery, maxMarketKlines)
+	}
+
+	result := &models.SymbolKlines{Symbol: symbol, Interval: liveInterval}
+	if interval == "" || interval == liveInterval {
+		result.Klines = s.indicators.Klines(symbol)
+	} else {
+		result.Interval = interval
+		if result.Klines, err = s.exchangeKlines(symbol, interval, limit); err != nil {
+			return nil, err
+		}
+	}
+	if len(result.Klines) > limit {
+		result.Klines = result.Klines[len(result.Klines)-limit:]
+	}
+	if result.Klines == nil {
+		result.Klines = []models.Kline{}
+	}
+	if n := len(result.Klines); n > 0 {
+		result.DataAge = dataAge(time.UnixMilli(result.Klines[n-1].CloseTime))
+	}
+	return result, nil
+}
+
+// Indicators returns the symbol's indicators, or only the named one. With
+// an empty or "live" interval these are the values alerts are evaluated
+// on; otherwise RSI and MACD are calculated the same way from the
+// exchange's klines of interval. params overrides the parameters of the
+// named indicator, e.g. "7" for RSI or "5,35,5" for MACD.
+func (s *MarketDataService) Indicators(symbol, interval, name, params string) (*models.SymbolIndicators, error) {
+	symbol, err := s.trackedSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	live := interval == "" || interval == liveInterval
+
+	names := s.alerts.indicatorNames()
+	if !live {
+		names = s.indicators.Indicators()
+	}
+	if name != "" {
+		canonical, ok := s.alerts.indicatorName(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown indicator %s, expected one of %s", ErrInvalidMarketQuery, name, strings.Join(s.alerts.indicatorNames(), ", "))
+		}
+		if !containsString(names, canonical) {
+			return nil, fmt.Errorf("%w: %s is only available live, without an interval", ErrInvalidMarketQuery, canonical)
+		}
+		names = []string{canonical}
+	}
+	var custom []int
+	if params != "" {
+		if name == "" {
+			return nil, fmt.Errorf("%w: params requires name", ErrInvalidMarketQuery)
+		}
+		if custom, err = parseIndicatorParams(names[0], params); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &models.SymbolIndicators{Symbol: symbol, Interval: liveInterval, Indicators: []*models.IndicatorValue{}}
+	if live {
+		for _, n := range names {
+			result.Indicators = append(result.Indicators, s.liveIndicator(symbol, n, custom))
+		}
+		return result, nil
+	}
+
+	result.Interval = interval
+	klines, err := s.exchangeKlines(symbol, interval, maxSeriesKlines)
+	if err != nil {
+		return nil, err
+	}
+	closes := klineCloses(klines)
+	for _, n := range names {
+		value := &models.IndicatorValue{Name: n, Params: custom}
+		if value.Params == nil {
+			value.Params = defaultIndicatorParams(n)
+		}
+		value.Value, value.Ready = calculateIndicator(n, value.Params, closes)
+		if len(klines) > 0 {
+			value.DataAge = dataAge(time.UnixMilli(klines[len(klines)-1].CloseTime))
+		}
+		result.Indicators = append(result.Indicators, value)
+	}
+	return result, nil
+}
+
+// liveIndicator returns the live value of an indicator, calculated from the
+// live klines if custom parameters are given
+func (s *MarketDataService) liveIndicator(symbol, name string, custom []int) *models.IndicatorValue {
+	value := &models.IndicatorValue{Name: name, Params: defaultIndicatorParams(name)}
+	source := s.alerts.findSource(name)
+	if custom != nil {
+		value.Params = custom
+		value.Value, value.Ready = calculateIndicator(name, custom, klineCloses(s.indicators.Klines(symbol)))
+	} else {
+		value.Value, value.Ready = source.Indicator(symbol, name)
+	}
+	if clock, ok := source.(indicatorClock); ok {
+		if updated, ok := clock.IndicatorUpdated(symbol, name); ok {
+			value.DataAge = dataAge(updated)
+		}
+	}
+	return value
+}
+
+// exchangeKlines fetches the symbol's last limit closed klines of interval
+func (s *MarketDataService) exchangeKlines(symbol, interval string, limit int) ([]models.Kline, error) {
+	if _, ok := klineIntervals[interval]; !ok {
+		return nil, fmt.Errorf("%w: unsupported interval %s", ErrInvalidMarketQuery, interval)
+	}
+	// The last kline the exchange returns is usually still open
+	fetch := limit + 1
+	if fetch > maxMarketKlines {
+		fetch = maxMarketKlines
+	}
+	klines, err := s.binance.GetKlines(symbol, interval, fetch, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching klines: %v", err)
+	}
+	if n := len(klines); n > 0 && klines[n-1].CloseTime > time.Now().UnixMilli() {
+		klines = klines[:n-1]
+	}
+	if len(klines) > limit {
+		klines = klines[len(klines)-limit:]
+	}
+	return klines, nil
+}
+
+// trackedSymbol returns the symbol in upper case, or ErrUnknownSymbol if
+// it is neither configured nor streamed
+func (s *MarketDataService) trackedSymbol(symbol string) (string, error) {
+	symbol = strings.ToUpper(symbol)
+	if containsString(s.symbols, symbol) || containsString(s.indicators.Symbols(), symbol) {
+		return symbol, nil
+	}
+	return "", ErrUnknownSymbol
+}
+
+func defaultIndicatorParams(name string) []int {
+	switch name {
+	case "RSI":
+		return rsiParams
+	case "MACD":
+		return macdParams
+	}
+	return nil
+}
+
+// parseIndicatorParams parses comma separated periods for an indicator
+// that takes them
+func parseIndicatorParams(name, raw string) ([]int, error) {
+	defaults := defaultIndicatorParams(name)
+	if defaults == nil {
+		return nil, fmt.Errorf("%w: %s takes no params", ErrInvalidMarketQuery, name)
+	}
+	parts := strings.Split(raw, ",")
+	if len(parts) != len(defaults) {
+		return nil, fmt.Errorf("%w: %s takes %d params, e.g. %s", ErrInvalidMarketQuery, name, len(defaults), joinInts(defaults))
+	}
+	params := make([]int, len(parts))
+	for i, part := range parts {
+		period, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || period < 1 || period > maxIndicatorPeriod {
+			return nil, fmt.Errorf("%w: params must be periods from 1 to %d, as indicators are calculated from the last %d klines",
+				ErrInvalidMarketQuery, maxIndicatorPeriod, maxSeriesKlines)
+		}
+		params[i] = period
+	}
+	if name == "MACD" && params[0] >= params[1] {
+		return nil, fmt.Errorf("%w: the MACD fast period must be shorter than the slow period", ErrInvalidMarketQuery)
+	}
+	return params, nil
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func dataAge(updated time.Time) *models.DataAge {
+	age := time.Since(updated).Seconds()
+	if age < 0 {
+		age = 0 // Exchange timestamps may be slightly ahead of the local clock
+	}
+	return &models.DataAge{UpdatedAt: updated.UTC(), AgeSeconds: math.Round(age*1000) / 1000}
+}
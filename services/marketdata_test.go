@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseIndicatorParams(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []int
+	}{
+		{"RSI", "7", []int{7}},
+		{"RSI", "99", []int{99}},
+		{"MACD", "5, 35, 5", []int{5, 35, 5}},
+		{"MACD", "12,99,99", []int{12, 99, 99}},
+
+		{"RSI", "0", nil},
+		{"RSI", "100", nil},
+		{"RSI", "7,14", nil},
+		{"RSI", "seven", nil},
+		{"MACD", "12,100,9", nil},
+		{"MACD", "26,12,9", nil},
+		{"FUNDING_RATE", "7", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseIndicatorParams(tt.name, tt.raw)
+		if tt.want == nil {
+			if !errors.Is(err, ErrInvalidMarketQuery) {
+				t.Errorf("parseIndicatorParams(%s, %q) = %v, %v, want ErrInvalidMarketQuery", tt.name, tt.raw, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIndicatorParams(%s, %q) = %v, %v, want %v", tt.name, tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+// The longest periods are still calculated from the klines fetched for an
+// interval
+func TestLongestIndicatorPeriodsFit(t *testing.T) {
+	closes := make([]float64, maxSeriesKlines)
+	for i := range closes {
+		closes[i] = 100 + float64(i%5)
+	}
+	for name, params := range map[string][]int{
+		"RSI":  {maxIndicatorPeriod},
+		"MACD": {maxIndicatorPeriod - 1, maxIndicatorPeriod, maxIndicatorPeriod},
+	} {
+		if _, ready := calculateIndicator(name, params, closes); !ready {
+			t.Errorf("%s%v is not ready from %d klines", name, params, maxSeriesKlines)
+		}
+	}
+}
+
+func TestIntervalIndicatorsExcludeLiveOnly(t *testing.T) {
+	indicators := NewIndicatorService()
+	alerts := NewAlertService(nil, indicators, nil, nil, nil, nil)
+	alerts.AddIndicatorSource(&FuturesService{})
+	s := NewMarketDataService(indicators, alerts, nil, []string{"BTCUSDT"})
+
+	_, err := s.Indicators("BTCUSDT", "1h", "FUNDING_RATE", "")
+	if !errors.Is(err, ErrInvalidMarketQuery) {
+		t.Errorf("Indicators() of FUNDING_RATE with an interval = %v, want ErrInvalidMarketQuery", err)
+	}
+}
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"price-alert-system/models"
+)
+
+// ErrUnknownChannel is returned for channels without a registered notifier.
+var ErrUnknownChannel = errors.New("unknown channel")
+
+// Notification describes a triggered alert to deliver.
+type Notification struct {
+	Alert        models.Alert `json:"alert"`
+	CurrentValue float64      `json:"current_value"`
+	TriggeredAt  time.Time    `json:"triggered_at"`
+	// Price is the symbol's last price, zero if unknown
+	Price float64 `json:"price,omitempty"`
+	// Candles are the recent candles of the symbol, charted by RenderChart
+	Candles []Candle `json:"candles,omitempty"`
+	// Indicators are the values of every ready indicator of the alert's symbol
+	Indicators map[string]float64 `json:"indicators,omitempty"`
+}
+
+// Notifier delivers notifications over one channel. The target is the
+// channel specific recipient: an email address, a webhook URL, a chat ID or a
+// phone number.
+type Notifier interface {
+	Channel() string
+	Notify(target string, n *Notification) error
+}
+
+// DigestNotifier is implemented by notifiers that can merge several
+// notifications for the same target into one message.
+type DigestNotifier interface {
+	NotifyDigest(target string, ns []*Notification) error
+}
+
+// TargetResolver is implemented by notifiers that keep their own
+// registrations instead of delivering to the user's contact.
+type TargetResolver interface {
+	Targets(alert *models.Alert) ([]string, error)
+}
+
+// Route is one delivery of a notification. Err is set when the channel's
+// target could not be resolved.
+type Route struct {
+	Channel string
+	Target  string
+	Err     error
+}
+
+// Dispatcher routes triggered alerts to notifiers. An alert's own channels
+// take precedence, then the user's enabled channels, then the defaults.
+// Team alerts go to the team's routes, or every member's if it has none.
+type Dispatcher struct {
+	db              *sql.DB
+	contacts        *ContactService
+	mutex           sync.RWMutex
+	notifiers       map[string]Notifier
+	defaultChannels []string
+}
+
+func NewDispatcher(db *sql.DB, contacts *ContactService, defaultChannels []string) *Dispatcher {
+	return &Dispatcher{
+		db:              db,
+		contacts:        contacts,
+		notifiers:       make(map[string]Notifier),
+		defaultChannels: defaultChannels,
+	}
+}
+
+// Register makes a notifier available under its channel name.
+func (d *Dispatcher) Register(notifier Notifier) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.notifiers[notifier.Channel()] = notifier
+}
+
+// Channels returns the registered channel names.
+func (d *Dispatcher) Channels() []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	channels := make([]string, 0, len(d.notifiers))
+	for channel := range d.notifiers {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// ValidateChannels fails with ErrUnknownChannel if any channel is not registered.
+func (d *Dispatcher) ValidateChannels(channels []string) error {
+	for _, channel := range channels {
+		if _, ok := d.notifier(channel); !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownChannel, channel)
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) notifier(channel string) (Notifier, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	notifier, ok := d.notifiers[channel]
+	return notifier, ok
+}
+
+// Dispatch delivers n on every route of its alert and returns the joined
+// errors of the failed deliveries.
+func (d *Dispatcher) Dispatch(n *Notification) error {
+	routes, err := d.Routes(&n.Alert)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, route := range routes {
+		if route.Err != nil {
+			errs = append(errs, route.Err)
+			continue
+		}
+		if err := d.Deliver(route, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Deliver sends n over a single route.
+func (d *Dispatcher) Deliver(route Route, n *Notification) error {
+	notifier, ok := d.notifier(route.Channel)
+	if !ok {
+		return fmt.Errorf("%s: channel not configured", route.Channel)
+	}
+	if err := notifier.Notify(route.Target, n); err != nil {
+		return fmt.Errorf("%s: %v", route.Channel, err)
+	}
+	return nil
+}
+
+// DeliverDigest sends several notifications over a single route as one
+// message, or one by one if the channel cannot merge them.
+func (d *Dispatcher) DeliverDigest(route Route, ns []*Notification) error {
+	notifier, ok := d.notifier(route.Channel)
+	if !ok {
+		return fmt.Errorf("%s: channel not configured", route.Channel)
+	}
+	if digester, ok := notifier.(DigestNotifier); ok {
+		if err := digester.NotifyDigest(route.Target, ns); err != nil {
+			return fmt.Errorf("%s: %v", route.Channel, err)
+		}
+		return nil
+	}
+
+	var errs []error
+	for _, n := range ns {
+		if err := notifier.Notify(route.Target, n); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", route.Channel, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Routes resolves the channels and targets an alert is delivered to. Channels
+// whose target cannot be resolved are returned with Err set; the error is only
+// returned when the user's channels cannot be read.
+func (d *Dispatcher) Routes(alert *models.Alert) ([]Route, error) {
+	if alert.TeamID != nil {
+		return d.teamRoutes(alert)
+	}
+
+	userChannels, err := d.GetUserChannels(alert.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user channels: %v", err)
+	}
+	var enabled []string
+	for _, uc := range userChannels {
+		if uc.Enabled {
+			enabled = append(enabled, uc.Channel)
+		}
+	}
+
+	channels := alert.Channels
+	if len(channels) == 0 {
+		channels = enabled
+	}
+	if len(channels) == 0 {
+		channels = d.defaultChannels
+	}
+
+	var routes []Route
+	for _, channel := range channels {
+		if notifier, ok := d.notifier(channel); ok {
+			if resolver, ok := notifier.(TargetResolver); ok {
+				resolved, err := resolver.Targets(alert)
+				if err != nil {
+					routes = append(routes, Route{Channel: channel, Err: fmt.Errorf("%s: %v", channel, err)})
+					continue
+				}
+				for _, target := range resolved {
+					routes = append(routes, Route{Channel: channel, Target: target})
+				}
+				continue
+			}
+		}
+
+		contact, err := d.contacts.ContactForChannel(alert, channel)
+		if errors.Is(err, ErrContactNotFound) {
+			err = fmt.Errorf("%s: no contact for user %d", channel, alert.UserID)
+		} else if err == nil && !contact.Verified {
+			err = fmt.Errorf("%s: contact %d is not verified", channel, contact.ID)
+		}
+		if err != nil {
+			routes = append(routes, Route{Channel: channel, Err: err})
+			continue
+		}
+		routes = append(routes, Route{Channel: channel, Target: contact.Address})
+	}
+	return routes, nil
+}
+
+// teamRoutes resolves the deliveries of a team alert: the team's routes on
+// the alert's channels, or if the team has none, the routes of each member
+// as if the alert were theirs.
+func (d *Dispatcher) teamRoutes(alert *models.Alert) ([]Route, error) {
+	query := `SELECT c.id, c.channel, c.address, c.verified_at IS NOT NULL FROM team_routes r
+			  JOIN contacts c ON c.id = r.contact_id WHERE r.team_id = $1 ORDER BY r.id`
+	rows, err := d.db.Query(query, *alert.TeamID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching team routes: %v", err)
+	}
+	defer rows.Close()
+
+	var routes []Route
+	teamRoutes := 0
+	for rows.Next() {
+		var contactID int
+		var verified bool
+		var route Route
+		if err := rows.Scan(&contactID, &route.Channel, &route.Target, &verified); err != nil {
+			return nil, err
+		}
+		teamRoutes++
+		if len(alert.Channels) > 0 && !containsString(alert.Channels, route.Channel) {
+			continue
+		}
+		if !verified {
+			route = Route{Channel: route.Channel, Err: fmt.Errorf("%s: contact %d is not verified", route.Channel, contactID)}
+		}
+		routes = append(routes, route)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if teamRoutes > 0 {
+		return routes, nil
+	}
+
+	members, err := teamMembers(d.db, *alert.TeamID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching team members: %v", err)
+	}
+	// Members sharing a target, e.g. a Slack channel, get one delivery
+	seen := make(map[[2]string]bool)
+	for _, userID := range members {
+		member := *alert
+		member.UserID = userID
+		member.TeamID = nil
+		member.ContactID = nil
+		member.Email = ""
+		memberRoutes, err := d.Routes(&member)
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range memberRoutes {
+			key := [2]string{route.Channel, route.Target}
+			if route.Err == nil && seen[key] {
+				continue
+			}
+			seen[key] = true
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dispatcher) GetUserChannels(userID int) ([]*models.UserChannel, error) {
+	query := `SELECT user_id, channel, enabled FROM user_channels WHERE user_id = $1 ORDER BY channel`
+	rows, err := d.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*models.UserChannel
+	for rows.Next() {
+		uc := &models.UserChannel{}
+		if err := rows.Scan(&uc.UserID, &uc.Channel, &uc.Enabled); err != nil {
+			return nil, err
+		}
+		channels = append(channels, uc)
+	}
+	return channels, rows.Err()
+}
+
+func (d *Dispatcher) SetUserChannel(uc *models.UserChannel) error {
+	if err := d.ValidateChannels([]string{uc.Channel}); err != nil {
+		return err
+	}
+	query := `INSERT INTO user_channels (user_id, channel, enabled) VALUES ($1, $2, $3)
+			  ON CONFLICT (user_id, channel) DO UPDATE SET enabled = $3, updated_at = CURRENT_TIMESTAMP`
+	_, err := d.db.Exec(query, uc.UserID, uc.Channel, uc.Enabled)
+	return err
+}
+
+func (d *Dispatcher) DeleteUserChannel(userID int, channel string) error {
+	_, err := d.db.Exec(`DELETE FROM user_channels WHERE user_id = $1 AND channel = $2`, userID, channel)
+	return err
+}
+
+var notifierClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON posts payload to url with client and fails on non-2xx responses
+func postJSON(client *http.Client, url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return redactURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return doRequest(client, req)
+}
+
+// doRequest sends req with client and fails on non-2xx responses. The
+// response body is only logged: errors are stored as the last error of
+// deliveries, which users can read.
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return redactURL(err)
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+// checkResponse fails on non-2xx responses and logs their body
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		log.Printf("Unexpected response %s from %s: %s", resp.Status, resp.Request.URL.Host, respBody)
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
+
+// redactURL keeps only the scheme and host of the URL of a request error.
+// Notifier URLs carry secrets in their path, such as the Telegram bot token
+// or the key of a Slack or Discord webhook, and the errors are logged and
+// stored as the last error of deliveries.
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	redacted := "<redacted>"
+	if u, parseErr := url.Parse(urlErr.URL); parseErr == nil && u.Host != "" {
+		redacted = u.Scheme + "://" + u.Host
+	}
+	return &url.Error{Op: urlErr.Op, URL: redacted, Err: urlErr.Err}
+}
+
+// attachment is a file sent with postMultipart
+type attachment struct {
+	Field    string
+	Filename string
+	Data     []byte
+}
+
+// postMultipart posts form fields and a file to url with client and fails
+// on non-2xx responses
+func postMultipart(client *http.Client, url string, fields map[string]string, file attachment, headers map[string]string) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	part, err := writer.CreateFormFile(file.Field, file.Filename)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(file.Data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		return redactURL(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return doRequest(client, req)
+}
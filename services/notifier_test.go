@@ -0,0 +1,25 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTelegramErrorsHideBotToken(t *testing.T) {
+	const token = "123456:secret-bot-token"
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	err := NewTelegramNotifier(server.URL, token, nil).SendText("42", "hello")
+	if err == nil {
+		t.Fatal("SendText to a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("error %q contains the bot token", err)
+	}
+	if !strings.Contains(err.Error(), server.URL) {
+		t.Errorf("error %q does not name the API host %s", err, server.URL)
+	}
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"price-alert-system/models"
+)
+
+// Delivery statuses of outbox entries
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+	// DeliverySuppressed entries were never sent; see SuppressedReason
+	DeliverySuppressed = "suppressed"
+)
+
+// Reasons of suppressed deliveries
+const (
+	SuppressedDuplicate = "duplicate"
+	// SuppressedRateLimit is followed by the exhausted scope, user or channel
+	SuppressedRateLimit = "rate_limited_"
+)
+
+// Outbox stores notifications in the same transaction as the alert's state
+// change and delivers them in the background, retrying failures with
+// exponential backoff until MaxAttempts, after which they are dead-lettered.
+// Notifications of users with digests are held until their digest is due and
+// then merged into one message per channel and target. Each trigger
+// occurrence is queued once per route, and messages over the rate limits are
+// suppressed; both leave suppressed entries as a record.
+type Outbox struct {
+	db           *sql.DB
+	dispatcher   *Dispatcher
+	preferences  *PreferenceService
+	limiter      *RateLimiter
+	maxAttempts  int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	pollInterval time.Duration
+	batchSize    int
+	digestSize   int
+	lease        time.Duration
+	done         chan struct{}
+}
+
+func NewOutbox(db *sql.DB, dispatcher *Dispatcher, preferences *PreferenceService, limiter *RateLimiter, maxAttempts int, baseDelay, maxDelay time.Duration) *Outbox {
+	return &Outbox{
+		db:           db,
+		dispatcher:   dispatcher,
+		preferences:  preferences,
+		limiter:      limiter,
+		maxAttempts:  maxAttempts,
+		baseDelay:    baseDelay,
+		maxDelay:     maxDelay,
+		pollInterval: time.Second,
+		batchSize:    20,
+		digestSize:   500,             // Digest entries due together are claimed together
+		lease:        2 * time.Minute, // Claimed entries are retried if a worker dies mid delivery
+		done:         make(chan struct{}),
+	}
+}
+
+// Enqueue writes one entry per route within tx. Routes that could not be
+// resolved are stored dead-lettered so the failure is visible.
+func (o *Outbox) Enqueue(tx *sql.Tx, routes []Route, n *Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	prefs, err := o.preferences.GetPreferences(n.Alert.UserID)
+	if err != nil {
+		return err
+	}
+	delay, digest, heldReason := schedule(prefs, n.Alert.Priority, time.Now())
+
+	query := `INSERT INTO notification_outbox (alert_id, user_id, channel, target, payload, status, max_attempts, last_error, digest, held_reason,
+			  next_attempt_at, dedupe_key)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP + $11 * INTERVAL '1 second', $12)
+			  ON CONFLICT (dedupe_key) WHERE status <> 'suppressed' DO NOTHING`
+	duplicate := `INSERT INTO notification_outbox (alert_id, user_id, channel, target, payload, status, max_attempts, dedupe_key, suppressed_reason)
+			  VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8)`
+	for _, route := range routes {
+		key := dedupeKey(&n.Alert, route)
+		status, lastError := DeliveryPending, ""
+		if route.Err != nil {
+			status, lastError = DeliveryDead, route.Err.Error()
+		}
+		// Webhooks feed other systems, which get every notification as it happens
+		entryDigest, entryHeld, entryDelay := false, "", 0.0
+		if route.Channel != "webhook" {
+			entryDigest, entryHeld, entryDelay = digest, heldReason, delay.Seconds()
+		}
+		res, err := tx.Exec(query, n.Alert.ID, n.Alert.UserID, route.Channel, route.Target, payload, status, o.maxAttempts, lastError,
+			entryDigest, entryHeld, entryDelay, key)
+		if err != nil {
+			return err
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if inserted == 0 {
+			log.Printf("Suppressing duplicate notification %s", key)
+			_, err := tx.Exec(duplicate, n.Alert.ID, n.Alert.UserID, route.Channel, route.Target, payload, DeliverySuppressed, key, SuppressedDuplicate)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dedupeKey identifies a delivery of one trigger occurrence of an alert
+func dedupeKey(alert *models.Alert, route Route) string {
+	return fmt.Sprintf("%d:%d:%s:%s", alert.ID, alert.Occurrence, route.Channel, route.Target)
+}
+
+func (o *Outbox) Start() {
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			processed, err := o.processBatch()
+			if err != nil {
+				log.Printf("Error processing notification outbox: %v", err)
+			}
+			if processed < o.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-o.done:
+			return
+		}
+	}
+}
+
+func (o *Outbox) Stop() {
+	close(o.done)
+}
+
+type outboxEntry struct {
+	id       int64
+	alertID  int
+	userID   int
+	channel  string
+	target   string
+	payload  []byte
+	attempts int
+	max      int
+}
+
+// digestKey groups digest entries merged into one message
+type digestKey struct {
+	userID  int
+	channel string
+	target  string
+}
+
+// processBatch claims due entries and delivers them, merging due digest
+// entries of the same user, channel and target.
+func (o *Outbox) processBatch() (int, error) {
+	entries, err := o.claim(false, o.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		o.deliver([]outboxEntry{e})
+	}
+
+	digests, err := o.claim(true, o.digestSize)
+	if err != nil {
+		return len(entries), err
+	}
+	var keys []digestKey
+	groups := make(map[digestKey][]outboxEntry)
+	for _, e := range digests {
+		key := digestKey{userID: e.userID, channel: e.channel, target: e.target}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], e)
+	}
+	for _, key := range keys {
+		o.deliver(groups[key])
+	}
+	return len(entries), nil
+}
+
+// claim takes due entries by pushing their next attempt out by the lease, so
+// concurrent workers skip them.
+func (o *Outbox) claim(digest bool, limit int) ([]outboxEntry, error) {
+	query := `UPDATE notification_outbox SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+			  WHERE id IN (
+				  SELECT id FROM notification_outbox
+				  WHERE status = 'pending' AND digest = $3 AND next_attempt_at <= CURRENT_TIMESTAMP
+				  ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING id, alert_id, user_id, channel, target, payload, attempts, max_attempts`
+	rows, err := o.db.Query(query, limit, o.lease.Seconds(), digest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []outboxEntry
+	for rows.Next() {
+		var e outboxEntry
+		if err := rows.Scan(&e.id, &e.alertID, &e.userID, &e.channel, &e.target, &e.payload, &e.attempts, &e.max); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// deliver sends entries sharing a route, as a digest if there are several,
+// and records the outcome on each of them. A failed digest is retried as a
+// whole so its entries stay together.
+func (o *Outbox) deliver(entries []outboxEntry) {
+	first := entries[0]
+	route := Route{Channel: first.channel, Target: first.target}
+
+	if ok, scope := o.limiter.Allow(first.userID, first.channel); !ok {
+		o.suppress(entries, SuppressedRateLimit+scope)
+		return
+	}
+
+	notifications := make([]*Notification, 0, len(entries))
+	var err error
+	for _, e := range entries {
+		var n Notification
+		if err = json.Unmarshal(e.payload, &n); err != nil {
+			break
+		}
+		notifications = append(notifications, &n)
+	}
+	if err == nil {
+		if len(notifications) == 1 {
+			err = o.dispatcher.Deliver(route, notifications[0])
+		} else {
+			err = o.dispatcher.DeliverDigest(route, notifications)
+		}
+	}
+
+	delay := time.Duration(0)
+	for _, e := range entries {
+		attempts := e.attempts + 1
+		switch {
+		case err == nil:
+			_, dbErr := o.db.Exec(`UPDATE notification_outbox SET status = $1, attempts = $2, last_error = '', delivered_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $3`,
+				DeliveryDelivered, attempts, e.id)
+			if dbErr != nil {
+				log.Printf("Error marking delivery %d delivered: %v", e.id, dbErr)
+			}
+			o.completeAlert(e.alertID)
+
+		case attempts >= e.max:
+			log.Printf("Delivery %d to %s dead-lettered after %d attempts: %v", e.id, e.channel, attempts, err)
+			_, dbErr := o.db.Exec(`UPDATE notification_outbox SET status = $1, attempts = $2, last_error = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4`,
+				DeliveryDead, attempts, err.Error(), e.id)
+			if dbErr != nil {
+				log.Printf("Error dead-lettering delivery %d: %v", e.id, dbErr)
+			}
+			o.completeAlert(e.alertID)
+
+		default:
+			if delay == 0 {
+				delay = o.backoff(attempts)
+			}
+			log.Printf("Delivery %d to %s failed (attempt %d/%d), retrying in %s: %v", e.id, e.channel, attempts, e.max, delay, err)
+			_, dbErr := o.db.Exec(`UPDATE notification_outbox SET attempts = $1, last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second', updated_at = CURRENT_TIMESTAMP WHERE id = $4`,
+				attempts, err.Error(), delay.Seconds(), e.id)
+			if dbErr != nil {
+				log.Printf("Error rescheduling delivery %d: %v", e.id, dbErr)
+			}
+		}
+	}
+}
+
+// suppress records that entries were not sent and why
+func (o *Outbox) suppress(entries []outboxEntry, reason string) {
+	for _, e := range entries {
+		log.Printf("Delivery %d to %s suppressed: %s", e.id, e.channel, reason)
+		_, err := o.db.Exec(`UPDATE notification_outbox SET status = $1, suppressed_reason = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`,
+			DeliverySuppressed, reason, e.id)
+		if err != nil {
+			log.Printf("Error suppressing delivery %d: %v", e.id, err)
+		}
+		o.completeAlert(e.alertID)
+	}
+}
+
+// backoff doubles the delay with every attempt, capped at maxDelay, with
+// +/-20% jitter so failing deliveries do not retry in lockstep
+func (o *Outbox) backoff(attempts int) time.Duration {
+	delay := float64(o.baseDelay) * math.Pow(2, float64(attempts-1))
+	if delay > float64(o.maxDelay) {
+		delay = float64(o.maxDelay)
+	}
+	delay *= 0.8 + 0.4*rand.Float64()
+	return time.Duration(delay)
+}
+
+// completeAlert marks a triggered alert completed once none of its
+// deliveries are pending any more
+func (o *Outbox) completeAlert(alertID int) {
+	query := `UPDATE alerts SET status = 'completed', updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND status = 'triggered'
+			  AND NOT EXISTS (SELECT 1 FROM notification_outbox WHERE alert_id = $1 AND status = 'pending')`
+	res, err := o.db.Exec(query, alertID)
+	if err != nil {
+		log.Printf("Error updating alert status to completed: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Println("Alert completed:", alertID)
+	}
+}
+
+// deliveryColumns are the columns scanDeliveries reads, in order
+const deliveryColumns = `id, alert_id, channel, target, status, attempts, max_attempts, next_attempt_at, last_error, created_at, delivered_at,
+	digest, held_reason, COALESCE(dedupe_key, ''), suppressed_reason`
+
+// GetDeliveries lists the outbox entries of an alert.
+func (o *Outbox) GetDeliveries(alertID int) ([]*models.Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM notification_outbox WHERE alert_id = $1 ORDER BY id`
+	return o.queryDeliveries(query, alertID)
+}
+
+// GetSuppressed lists the user's suppressed deliveries, newest first.
+func (o *Outbox) GetSuppressed(userID, limit int) ([]*models.Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM notification_outbox
+			  WHERE user_id = $1 AND status = 'suppressed' ORDER BY created_at DESC, id DESC LIMIT $2`
+	return o.queryDeliveries(query, userID, limit)
+}
+
+func (o *Outbox) queryDeliveries(query string, args ...interface{}) ([]*models.Delivery, error) {
+	rows, err := o.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.Delivery
+	for rows.Next() {
+		d := &models.Delivery{}
+		err := rows.Scan(&d.ID, &d.AlertID, &d.Channel, &d.Target, &d.Status, &d.Attempts, &d.MaxAttempts,
+			&d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.DeliveredAt, &d.Digest, &d.HeldReason, &d.DedupeKey, &d.SuppressedReason)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RetryDelivery puts a dead-lettered delivery of the alert back in the queue
+// with a fresh set of attempts. An alert completed when its deliveries ran
+// out is triggered again until the retry finishes. It returns false if no
+// such delivery exists.
+func (o *Outbox) RetryDelivery(alertID int, id int64) (bool, error) {
+	tx, err := o.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE notification_outbox SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND alert_id = $2 AND status = 'dead'`
+	res, err := tx.Exec(query, id, alertID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`UPDATE alerts SET status = 'triggered', updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'completed'`, alertID)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
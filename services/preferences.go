@@ -0,0 +1,172 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"price-alert-system/models"
+)
+
+// Digest modes of user preferences
+const (
+	DigestImmediate = "immediate"
+	DigestBatched   = "batched"
+	DigestDaily     = "daily"
+)
+
+// HeldQuietHours marks outbox entries postponed by the user's quiet hours
+const HeldQuietHours = "quiet_hours"
+
+// ErrInvalidPreferences is wrapped by validation errors of preferences.
+var ErrInvalidPreferences = errors.New("invalid preferences")
+
+// PreferenceService stores per-user notification preferences.
+type PreferenceService struct {
+	db *sql.DB
+}
+
+func NewPreferenceService(db *sql.DB) *PreferenceService {
+	return &PreferenceService{
+		db: db,
+	}
+}
+
+// GetPreferences returns the user's preferences, or the defaults for users
+// who have not set any.
+func (s *PreferenceService) GetPreferences(userID int) (*models.Preferences, error) {
+	p := &models.Preferences{UserID: userID, TimeZone: "UTC", DigestMode: DigestImmediate}
+	query := `SELECT time_zone, digest_mode, digest_interval, digest_hour, quiet_start, quiet_end FROM users WHERE id = $1`
+	err := s.db.QueryRow(query, userID).Scan(&p.TimeZone, &p.DigestMode, &p.DigestInterval, &p.DigestHour, &p.QuietStart, &p.QuietEnd)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetPreferences validates and stores the user's preferences.
+func (s *PreferenceService) SetPreferences(p *models.Preferences) error {
+	if p.TimeZone == "" {
+		p.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(p.TimeZone); err != nil {
+		return fmt.Errorf("%w: unknown time_zone %s", ErrInvalidPreferences, p.TimeZone)
+	}
+	if (p.QuietStart == "") != (p.QuietEnd == "") {
+		return fmt.Errorf("%w: quiet_start and quiet_end must be set together", ErrInvalidPreferences)
+	}
+	if p.QuietStart != "" {
+		start, err := parseClock(p.QuietStart)
+		if err != nil {
+			return fmt.Errorf("%w: quiet_start: %v", ErrInvalidPreferences, err)
+		}
+		end, err := parseClock(p.QuietEnd)
+		if err != nil {
+			return fmt.Errorf("%w: quiet_end: %v", ErrInvalidPreferences, err)
+		}
+		if start == end {
+			return fmt.Errorf("%w: quiet_start and quiet_end must differ", ErrInvalidPreferences)
+		}
+	}
+	if p.DigestMode == "" {
+		p.DigestMode = DigestImmediate
+	}
+	switch p.DigestMode {
+	case DigestImmediate, DigestDaily:
+		p.DigestInterval = 0
+	case DigestBatched:
+		if p.DigestInterval < 1 || p.DigestInterval > 24*60 {
+			return fmt.Errorf("%w: digest_interval_minutes must be between 1 and 1440", ErrInvalidPreferences)
+		}
+	default:
+		return fmt.Errorf("%w: unknown digest_mode %s", ErrInvalidPreferences, p.DigestMode)
+	}
+	if p.DigestHour < 0 || p.DigestHour > 23 {
+		return fmt.Errorf("%w: digest_hour must be between 0 and 23", ErrInvalidPreferences)
+	}
+
+	query := `INSERT INTO users (id, time_zone, digest_mode, digest_interval, digest_hour, quiet_start, quiet_end)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  ON CONFLICT (id) DO UPDATE SET time_zone = $2, digest_mode = $3, digest_interval = $4, digest_hour = $5,
+			  quiet_start = $6, quiet_end = $7`
+	_, err := s.db.Exec(query, p.UserID, p.TimeZone, p.DigestMode, p.DigestInterval, p.DigestHour, p.QuietStart, p.QuietEnd)
+	return err
+}
+
+// schedule returns how long a notification created at now waits before
+// delivery, whether it is merged into a digest and why it was held, if it
+// was. Notifications falling into quiet hours wait for their end and are then
+// sent together as a digest, unless the alert has high priority.
+func schedule(p *models.Preferences, priority string, now time.Time) (time.Duration, bool, string) {
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now = now.In(loc)
+
+	delay, digest := digestDelay(p, now)
+	if priority == PriorityHigh {
+		return delay, digest, ""
+	}
+	if end, quiet := quietEnd(p, now.Add(delay)); quiet {
+		return end.Sub(now), true, HeldQuietHours
+	}
+	return delay, digest, ""
+}
+
+// quietEnd returns the end of the quiet hours t falls into, and false if it
+// is outside them.
+func quietEnd(p *models.Preferences, t time.Time) (time.Time, bool) {
+	if p.QuietStart == "" || p.QuietEnd == "" {
+		return time.Time{}, false
+	}
+	start, err := parseClock(p.QuietStart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(p.QuietEnd)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	endToday := time.Date(t.Year(), t.Month(), t.Day(), end/60, end%60, 0, 0, t.Location())
+	switch {
+	case start < end && minute >= start && minute < end:
+		return endToday, true
+	case start > end && minute >= start: // Quiet hours span midnight and end tomorrow
+		return endToday.AddDate(0, 0, 1), true
+	case start > end && minute < end:
+		return endToday, true
+	}
+	return time.Time{}, false
+}
+
+// parseClock converts "HH:MM" to minutes after midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// digestDelay returns how long a notification created at now waits for the
+// user's next digest, and false for immediate delivery. Batches end on
+// multiples of the interval so every notification of a batch is sent together.
+func digestDelay(p *models.Preferences, now time.Time) (time.Duration, bool) {
+	switch p.DigestMode {
+	case DigestBatched:
+		interval := time.Duration(p.DigestInterval) * time.Minute
+		return now.Truncate(interval).Add(interval).Sub(now), true
+	case DigestDaily:
+		next := time.Date(now.Year(), now.Month(), now.Day(), p.DigestHour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next.Sub(now), true
+	default:
+		return 0, false
+	}
+}
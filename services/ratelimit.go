@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Rate limit scopes reported when a notification is suppressed
+const (
+	RateLimitUser    = "user"
+	RateLimitChannel = "channel"
+)
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketLimit is the refill rate per second and capacity of token buckets
+type bucketLimit struct {
+	rate  float64
+	burst float64
+}
+
+// RateLimiter limits notifications with token buckets per user and per user
+// and channel. Every message, including a digest, takes one token from both.
+type RateLimiter struct {
+	mutex   sync.Mutex
+	user    bucketLimit
+	channel bucketLimit
+	buckets map[string]*tokenBucket
+}
+
+// maxBuckets triggers dropping full buckets, which are the same as new ones
+const maxBuckets = 10000
+
+// NewRateLimiter creates a limiter; a rate of zero per minute disables that
+// limit.
+func NewRateLimiter(userPerMinute, userBurst, channelPerMinute, channelBurst int) *RateLimiter {
+	return &RateLimiter{
+		user:    bucketLimit{rate: float64(userPerMinute) / 60, burst: float64(userBurst)},
+		channel: bucketLimit{rate: float64(channelPerMinute) / 60, burst: float64(channelBurst)},
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a token for a message to the user on the channel. If either
+// bucket is empty nothing is taken and the exhausted scope is returned.
+func (l *RateLimiter) Allow(userID int, channel string) (bool, string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if len(l.buckets) > maxBuckets {
+		l.prune(now)
+	}
+	user := l.bucket(fmt.Sprintf("user:%d", userID), l.user, now)
+	perChannel := l.bucket(fmt.Sprintf("channel:%d:%s", userID, channel), l.channel, now)
+	if user != nil && user.tokens < 1 {
+		return false, RateLimitUser
+	}
+	if perChannel != nil && perChannel.tokens < 1 {
+		return false, RateLimitChannel
+	}
+
+	if user != nil {
+		user.tokens--
+	}
+	if perChannel != nil {
+		perChannel.tokens--
+	}
+	return true, ""
+}
+
+// bucket returns the refilled bucket for key, or nil if the limit is disabled
+func (l *RateLimiter) bucket(key string, limit bucketLimit, now time.Time) *tokenBucket {
+	if limit.rate <= 0 {
+		return nil
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: limit.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(limit.burst, b.tokens+now.Sub(b.last).Seconds()*limit.rate)
+	b.last = now
+	return b
+}
+
+func (l *RateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		limit := l.user
+		if key[0] == 'c' {
+			limit = l.channel
+		}
+		if b.tokens+now.Sub(b.last).Seconds()*limit.rate >= limit.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordedMessage is one line of a recording: the raw stream message and
+// the time (Unix milliseconds) it was received.
+type RecordedMessage struct {
+	ReceivedAt int64           `json:"ts"`
+	Message    json.RawMessage `json:"msg"`
+}
+
+// Recorder persists raw stream messages to a gzip compressed NDJSON file.
+type Recorder struct {
+	mutex     sync.Mutex
+	file      *os.File
+	gz        *gzip.Writer
+	encoder   *json.Encoder
+	lastFlush time.Time
+}
+
+// NewRecorder opens path for appending. Each run appends a new gzip member,
+// which gzip readers transparently concatenate.
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &Recorder{
+		file:      file,
+		gz:        gz,
+		encoder:   json.NewEncoder(gz),
+		lastFlush: time.Now(),
+	}, nil
+}
+
+func (r *Recorder) Record(message []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.gz == nil {
+		return os.ErrClosed
+	}
+
+	// Copy the message, the websocket reader may reuse its buffer
+	msg := make(json.RawMessage, len(message))
+	copy(msg, message)
+
+	if err := r.encoder.Encode(RecordedMessage{ReceivedAt: time.Now().UnixMilli(), Message: msg}); err != nil {
+		return err
+	}
+
+	// Flush at most once a second so a crash loses little without hurting compression
+	if time.Since(r.lastFlush) >= time.Second {
+		r.lastFlush = time.Now()
+		return r.gz.Flush()
+	}
+	return nil
+}
+
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.gz == nil {
+		return nil
+	}
+	err := r.gz.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.gz = nil
+	return err
+}
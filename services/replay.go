@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"price-alert-system/models"
+)
+
+// ReplayProvider feeds recorded stream messages back as a TradeStream.
+// A speed of 1 replays in real time, 10 ten times faster and 0 (or less)
+// as fast as possible.
+type ReplayProvider struct {
+	files []string
+	speed float64
+}
+
+func NewReplayProvider(files []string, speed float64) *ReplayProvider {
+	return &ReplayProvider{
+		files: files,
+		speed: speed,
+	}
+}
+
+func (p *ReplayProvider) Connect() (TradeStream, error) {
+	if len(p.files) == 0 {
+		return nil, fmt.Errorf("no replay files configured")
+	}
+	return &replayStream{
+		files: p.files,
+		speed: p.speed,
+		done:  make(chan struct{}),
+	}, nil
+}
+
+type replayStream struct {
+	files   []string
+	speed   float64
+	next    int
+	file    *os.File
+	scanner *bufio.Scanner
+	lastTS  int64
+	done    chan struct{}
+}
+
+// ReadTrade returns the next recorded trade, sleeping for the recorded gap
+// scaled by the replay speed. It returns io.EOF once every file is consumed.
+func (r *replayStream) ReadTrade() (models.Trade, error) {
+	rec, err := r.nextRecord()
+	if err != nil {
+		return models.Trade{}, err
+	}
+
+	if r.lastTS != 0 && r.speed > 0 && rec.ReceivedAt > r.lastTS {
+		wait := time.Duration(float64(rec.ReceivedAt-r.lastTS)/r.speed) * time.Millisecond
+		select {
+		case <-time.After(wait):
+		case <-r.done:
+			r.closeFile()
+			return models.Trade{}, io.EOF
+		}
+	}
+	r.lastTS = rec.ReceivedAt
+
+	return parseTrade(rec.Message)
+}
+
+func (r *replayStream) nextRecord() (RecordedMessage, error) {
+	for {
+		select {
+		case <-r.done:
+			r.closeFile()
+			return RecordedMessage{}, io.EOF
+		default:
+		}
+
+		if r.scanner == nil {
+			if r.next >= len(r.files) {
+				return RecordedMessage{}, io.EOF
+			}
+			if err := r.open(r.files[r.next]); err != nil {
+				return RecordedMessage{}, err
+			}
+			r.next++
+		}
+
+		if !r.scanner.Scan() {
+			err := r.scanner.Err()
+			r.closeFile()
+			if err != nil {
+				return RecordedMessage{}, err
+			}
+			continue
+		}
+
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec RecordedMessage
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return RecordedMessage{}, fmt.Errorf("error decoding recorded message: %v", err)
+		}
+		return rec, nil
+	}
+}
+
+func (r *replayStream) open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	// Recordings are gzip whatever their name; plain NDJSON is read as is
+	buffered := bufio.NewReader(file)
+	var reader io.Reader = buffered
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("error opening %s: %v", path, err)
+		}
+		reader = gz
+	}
+
+	r.file = file
+	r.scanner = bufio.NewScanner(reader)
+	r.scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return nil
+}
+
+func (r *replayStream) closeFile() {
+	if r.file != nil {
+		r.file.Close()
+	}
+	r.file = nil
+	r.scanner = nil
+}
+
+func (r *replayStream) Close() error {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	record := func(path string, prices ...string) {
+		t.Helper()
+		recorder, err := NewRecorder(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, price := range prices {
+			msg := fmt.Sprintf(`{"stream":"btcusdt@trade","data":{"e":"trade","s":"BTCUSDT","p":%q,"T":%d}}`, price, 1714571100000+int64(i))
+			if err := recorder.Record([]byte(msg)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := recorder.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Recordings are gzip whatever their name, and a file recorded by two
+	// runs holds two gzip members
+	first := filepath.Join(dir, "first.ndjson")
+	record(first, "100.1", "100.2")
+	second := filepath.Join(dir, "second.ndjson.gz")
+	record(second, "100.3")
+	record(second, "100.4")
+	// Plain NDJSON, e.g. a decompressed recording, is read as is
+	plain := filepath.Join(dir, "plain.ndjson")
+	line := `{"ts":1714571100000,"msg":{"e":"trade","s":"BTCUSDT","p":"100.5","T":1714571100000}}` + "\n"
+	if err := os.WriteFile(plain, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := NewReplayProvider([]string{first, second, plain}, 0).Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	start := time.Now()
+	var prices []string
+	for {
+		trade, err := stream.ReadTrade()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadTrade() = %v", err)
+		}
+		if trade.Symbol != "BTCUSDT" {
+			t.Errorf("trade symbol = %q, want BTCUSDT", trade.Symbol)
+		}
+		prices = append(prices, trade.Price)
+	}
+	if got := fmt.Sprint(prices); got != "[100.1 100.2 100.3 100.4 100.5]" {
+		t.Errorf("replayed prices %s, want [100.1 100.2 100.3 100.4 100.5]", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("replay at speed 0 took %v", elapsed)
+	}
+}
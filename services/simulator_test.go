@@ -0,0 +1,179 @@
+package services_test
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"price-alert-system/config"
+	"price-alert-system/services"
+	"price-alert-system/simulator"
+)
+
+// phasedPath plays the paths sent on phases one after another, waiting for
+// the next phase once the current one is exhausted.
+type phasedPath struct {
+	phases  chan simulator.PricePath
+	current simulator.PricePath
+}
+
+func (p *phasedPath) Next() (float64, time.Duration, bool) {
+	for {
+		if p.current != nil {
+			if price, wait, ok := p.current.Next(); ok {
+				return price, wait, true
+			}
+		}
+		next, ok := <-p.phases
+		if !ok {
+			return 0, 0, false
+		}
+		p.current = next
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var alertColumns = []string{"id", "user_id", "team_id", "value", "direction", "indicator", "status", "email", "symbol", "channels",
+	"contact_id", "priority", "occurrence", "snoozed_until", "created_at", "updated_at"}
+
+// expectCheck expects a pass of the alert checker to find an RSI alert
+func expectCheck(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE alerts SET status = 'active', snoozed_until = NULL`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM alerts WHERE status = 'pending' OR status = 'active'`)).
+		WillReturnRows(sqlmock.NewRows(alertColumns).AddRow(1, 1, nil, 70.0, "UP", "RSI", "active", "ada@example.com", "BTCUSDT",
+			"{email}", 3, services.PriorityNormal, 1, nil, time.Now(), time.Now()))
+}
+
+func TestRSIExcursionTriggersAlert(t *testing.T) {
+	const minute = time.Minute
+
+	path := &phasedPath{phases: make(chan simulator.PricePath)}
+	sim := simulator.NewServer(path, simulator.Options{Symbol: "BTCUSDT"})
+	server := httptest.NewServer(sim.Handler())
+	defer server.Close()
+	defer sim.Close()
+
+	binance, err := services.NewBinanceService(config.ProviderConfig{
+		BaseURL:    server.URL,
+		WSURL:      "ws" + strings.TrimPrefix(server.URL, "http"),
+		StreamType: "trade",
+		Symbols:    []string{"BTCUSDT"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	indicators := services.NewIndicatorService()
+	contacts := services.NewContactService(db, nil, "http://localhost")
+	dispatcher := services.NewDispatcher(db, contacts, []string{"email"})
+	prefs := services.NewPreferenceService(db)
+	outbox := services.NewOutbox(db, dispatcher, prefs, services.NewRateLimiter(60, 10, 600, 100), 5, time.Second, time.Minute)
+	hub := services.NewHub(16)
+	alerts := services.NewAlertService(db, indicators, dispatcher, outbox, contacts, hub)
+	events := hub.Subscribe(1, false, nil)
+
+	manager := services.NewWebSocketManager(binance, indicators, alerts)
+	go manager.Start()
+	defer manager.Stop()
+	waitFor(t, "the trade stream", func() bool { return sim.Subscribers() == 1 })
+	sim.Start()
+
+	klines := func(n int) func() bool {
+		return func() bool { return len(indicators.Klines("BTCUSDT")) == n }
+	}
+
+	// A sideways market keeps the RSI near 50
+	var sideways []simulator.Step
+	for i := 0; i < 30; i++ {
+		sideways = append(sideways, simulator.Step{Price: 60000 - float64(i%2)*100, Duration: minute})
+	}
+	path.phases <- simulator.NewStepPath(minute, sideways...)
+	waitFor(t, "the sideways trades", klines(30))
+	if rsi, ready := indicators.Indicator("BTCUSDT", "RSI"); !ready || rsi > 70 {
+		t.Fatalf("sideways RSI = %f (ready %t), want at most 70", rsi, ready)
+	}
+
+	expectCheck(mock)
+	alerts.CheckAlertsOnce()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sideways market: %v", err)
+	}
+
+	// A rally pushes the RSI over the alert's 70
+	var rally []simulator.Step
+	for i := 1; i <= 12; i++ {
+		rally = append(rally, simulator.Step{Price: 60000 + float64(i)*200, Duration: minute})
+	}
+	path.phases <- simulator.NewStepPath(minute, rally...)
+	close(path.phases)
+	<-sim.Finished()
+	waitFor(t, "the rally trades", klines(42))
+	rsi, _ := indicators.Indicator("BTCUSDT", "RSI")
+	if rsi <= 70 {
+		t.Fatalf("rally RSI = %f, want over 70", rsi)
+	}
+
+	expectCheck(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM user_channels WHERE user_id = $1`)).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "channel", "enabled"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM contacts WHERE id = $1 AND user_id = $2`)).WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "channel", "address", "verified_at", "created_at"}).
+			AddRow(3, 1, "email", "ada@example.com", time.Now(), time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE alerts SET status = $1`)).WithArgs("triggered", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT time_zone, digest_mode`)).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"time_zone", "digest_mode", "digest_interval", "digest_hour", "quiet_start", "quiet_end"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO notification_outbox`)).
+		WithArgs(1, 1, "email", "ada@example.com", sqlmock.AnyArg(), services.DeliveryPending, 5, "", false, "", 0.0, "1:1:email:ada@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	alerts.CheckAlertsOnce()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("rally: %v", err)
+	}
+
+	select {
+	case e := <-events.C:
+		n, ok := e.Data.(*services.Notification)
+		if e.Type != services.EventAlertTriggered || !ok || n.Alert.ID != 1 || n.CurrentValue != rsi {
+			t.Errorf("unexpected event %+v", e)
+		}
+	default:
+		t.Error("no alert.triggered event was published")
+	}
+
+	// The REST API serves the same prices as klines
+	history, err := binance.GetKlines("BTCUSDT", "1m", 100, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 42 {
+		t.Fatalf("GetKlines() returned %d klines, want 42", len(history))
+	}
+	if last := history[len(history)-1].Close; last != 62400 {
+		t.Errorf("last kline closes at %f, want 62400", last)
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SlackNotifier posts alerts to Slack as Block Kit messages with action
+// buttons. A target starting with https:// is an incoming webhook URL, which
+// cannot take files. Any other target is a channel ID posted to with the bot
+// token, which also uploads the chart into the message's thread.
+type SlackNotifier struct {
+	apiURL    string
+	botToken  string
+	publicURL string
+	renderer  *Renderer
+	signer    *ButtonSigner
+}
+
+func NewSlackNotifier(apiURL, botToken, publicURL string, renderer *Renderer, signer *ButtonSigner) *SlackNotifier {
+	return &SlackNotifier{
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		botToken:  botToken,
+		publicURL: publicURL,
+		renderer:  renderer,
+		signer:    signer,
+	}
+}
+
+func (s *SlackNotifier) Channel() string {
+	return "slack"
+}
+
+func (s *SlackNotifier) Notify(target string, n *Notification) error {
+	msg, err := s.renderer.Render(s.Channel(), n)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"text":   msg.Text,
+		"blocks": slackBlocks(msg, s.renderer.templateData(n), alertURL(s.publicURL, n.Alert.ID), s.signer.buttonValue(n)),
+	}
+	if strings.HasPrefix(target, "https://") {
+		return postJSON(targetClient, target, payload, nil)
+	}
+	if s.botToken == "" {
+		return fmt.Errorf("SLACK_BOT_TOKEN is required to post to channel %s", target)
+	}
+
+	payload["channel"] = target
+	var posted struct {
+		TS string `json:"ts"`
+	}
+	if err := s.call("chat.postMessage", payload, &posted); err != nil {
+		return err
+	}
+
+	// The alert is out; a failed chart upload must not send it again
+	if chart := notificationChart(n); chart != nil {
+		if err := s.uploadFile(target, posted.TS, chartFilename, chart); err != nil {
+			log.Printf("Error uploading chart of alert %d to Slack: %v", n.Alert.ID, err)
+		}
+	}
+	return nil
+}
+
+// NotifyDigest posts several notifications as one message.
+func (s *SlackNotifier) NotifyDigest(target string, ns []*Notification) error {
+	msg, err := s.renderer.RenderDigest(s.Channel(), ns)
+	if err != nil {
+		return err
+	}
+	return s.postText(target, msg.Text)
+}
+
+func (s *SlackNotifier) postText(target, text string) error {
+	if strings.HasPrefix(target, "https://") {
+		return postJSON(targetClient, target, map[string]string{"text": text}, nil)
+	}
+	if s.botToken == "" {
+		return fmt.Errorf("SLACK_BOT_TOKEN is required to post to channel %s", target)
+	}
+	return s.call("chat.postMessage", map[string]interface{}{"channel": target, "text": text}, nil)
+}
+
+// uploadFile shares a file in the thread of a channel message, using Slack's
+// external upload flow.
+func (s *SlackNotifier) uploadFile(channel, threadTS, filename string, data []byte) error {
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	form := url.Values{"filename": {filename}, "length": {strconv.Itoa(len(data))}}
+	if err := s.call("files.getUploadURLExternal", form, &upload); err != nil {
+		return err
+	}
+
+	if err := postMultipart(notifierClient, upload.UploadURL, nil, attachment{Field: "file", Filename: filename, Data: data}, nil); err != nil {
+		return fmt.Errorf("uploading %s: %v", filename, err)
+	}
+
+	return s.call("files.completeUploadExternal", map[string]interface{}{
+		"files":      []map[string]string{{"id": upload.FileID, "title": filename}},
+		"channel_id": channel,
+		"thread_ts":  threadTS,
+	}, nil)
+}
+
+// call invokes a Web API method with a form or JSON body. Slack reports
+// errors with "ok": false in a successful response.
+func (s *SlackNotifier) call(method string, params interface{}, result interface{}) error {
+	var body io.Reader
+	contentType := "application/json; charset=utf-8"
+	if form, ok := params.(url.Values); ok {
+		body = strings.NewReader(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.apiURL+"/"+method, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+s.botToken)
+
+	resp, err := notifierClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected response %s: %s", method, resp.Status, data)
+	}
+
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("%s: %s", method, status.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
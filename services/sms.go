@@ -0,0 +1,47 @@
+package services
+
+// SMSNotifier sends text messages through an HTTP SMS gateway that accepts
+// {"to": "<phone number>", "message": "<text>"} with a bearer token.
+type SMSNotifier struct {
+	gatewayURL string
+	token      string
+	renderer   *Renderer
+}
+
+func NewSMSNotifier(gatewayURL, token string, renderer *Renderer) *SMSNotifier {
+	return &SMSNotifier{
+		gatewayURL: gatewayURL,
+		token:      token,
+		renderer:   renderer,
+	}
+}
+
+func (s *SMSNotifier) Channel() string {
+	return "sms"
+}
+
+func (s *SMSNotifier) Notify(phoneNumber string, n *Notification) error {
+	msg, err := s.renderer.Render(s.Channel(), n)
+	if err != nil {
+		return err
+	}
+
+	return s.send(phoneNumber, msg.Text)
+}
+
+// NotifyDigest sends several notifications as one message.
+func (s *SMSNotifier) NotifyDigest(phoneNumber string, ns []*Notification) error {
+	msg, err := s.renderer.RenderDigest(s.Channel(), ns)
+	if err != nil {
+		return err
+	}
+	return s.send(phoneNumber, msg.Text)
+}
+
+func (s *SMSNotifier) send(phoneNumber, message string) error {
+	var headers map[string]string
+	if s.token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + s.token}
+	}
+	return postJSON(notifierClient, s.gatewayURL, map[string]string{"to": phoneNumber, "message": message}, headers)
+}
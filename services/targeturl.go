@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrUnsafeURL is returned for notification URLs given by users that are not
+// public http(s) addresses.
+var ErrUnsafeURL = errors.New("URL must be a public http(s) address")
+
+// allowPrivateTargets lets tests deliver to local servers.
+var allowPrivateTargets = false
+
+// Address ranges that are neither private nor loopback for the net package
+// but still do not reach the public internet.
+var reservedNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("240.0.0.0/4"),
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+// targetClient sends notifications to URLs given by users: webhooks and
+// Slack and Discord webhook URLs. The address is checked on every dial, so
+// a host cannot resolve to a public address when the URL is saved and to a
+// private one when it is delivered to. It uses no proxy, which would dial
+// the target on our behalf, and does not follow redirects.
+var targetClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: checkDialAddress,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// CheckTargetURL checks that a URL given by a user is an absolute http(s) URL
+// whose host only resolves to public addresses.
+func CheckTargetURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrUnsafeURL
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s", ErrUnsafeURL, u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrUnsafeURL, u.Hostname(), addr.IP)
+		}
+	}
+	return nil
+}
+
+// checkDialAddress refuses connections to addresses that are not public.
+// It runs after name resolution, on the address actually dialed.
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%w: refusing to connect to %s", ErrUnsafeURL, host)
+	}
+	return nil
+}
+
+func publicIP(ip net.IP) bool {
+	if allowPrivateTargets {
+		return true
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, reserved := range reservedNets {
+		if reserved.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
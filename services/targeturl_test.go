@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckTargetURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://8.8.8.8/hook", true},
+		{"http://[2001:4860:4860::8888]:8080/hook", true},
+		{"ftp://8.8.8.8/hook", false},
+		{"/hook", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://100.64.0.1/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://[fe80::1]/hook", false},
+		{"http://[fd00::1]/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+	}
+	for _, tt := range tests {
+		err := CheckTargetURL(tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckTargetURL(%q) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrUnsafeURL) {
+			t.Errorf("CheckTargetURL(%q) = %v, want ErrUnsafeURL", tt.url, err)
+		}
+	}
+}
+
+func TestTargetClientRefusesPrivateAddresses(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+	defer server.Close()
+
+	err := postJSON(targetClient, server.URL, map[string]string{"text": "hello"}, nil)
+	if !errors.Is(err, ErrUnsafeURL) {
+		t.Errorf("postJSON() to %s = %v, want ErrUnsafeURL", server.URL, err)
+	}
+	if hits != 0 {
+		t.Errorf("the private server got %d requests", hits)
+	}
+}
+
+func TestTargetClientDoesNotFollowRedirects(t *testing.T) {
+	allowPrivateTargets = true
+	defer func() { allowPrivateTargets = false }()
+
+	var redirected bool
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { redirected = true }))
+	defer internal.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", internal.URL)
+		w.WriteHeader(http.StatusFound)
+		w.Write([]byte("internal details"))
+	}))
+	defer server.Close()
+
+	err := postJSON(targetClient, server.URL, map[string]string{"text": "hello"}, nil)
+	if err == nil {
+		t.Fatal("postJSON() succeeded on a redirect")
+	}
+	if redirected {
+		t.Error("the redirect was followed")
+	}
+	if strings.Contains(err.Error(), "internal details") {
+		t.Errorf("error %q contains the response body", err)
+	}
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"price-alert-system/models"
+
+	"github.com/lib/pq"
+)
+
+// Team roles. Viewers see the team's alerts, editors also change them and
+// owners also manage the team.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var (
+	ErrTeamNotFound = errors.New("team not found")
+	ErrInvalidTeam  = errors.New("invalid team")
+	// ErrLastOwner is returned for changes that would leave a team without
+	// an owner.
+	ErrLastOwner = errors.New("a team must keep at least one owner")
+)
+
+var (
+	readRoles  = []string{RoleOwner, RoleEditor, RoleViewer}
+	writeRoles = []string{RoleOwner, RoleEditor}
+)
+
+// alertAccess returns the condition on the alerts table selecting the alerts
+// the principal may access: their own, and those of teams they have one of
+// roles in. Admins access every alert. Its arguments are numbered from n.
+func alertAccess(p *Principal, roles []string, n int) (string, []interface{}) {
+	condition := fmt.Sprintf(`($%d OR (team_id IS NULL AND user_id = $%d)
+		OR team_id IN (SELECT team_id FROM team_members WHERE user_id = $%d AND role = ANY($%d)))`, n, n+1, n+1, n+2)
+	return condition, []interface{}{p.Admin, p.UserID, pq.Array(roles)}
+}
+
+// teamMembers returns the IDs of a team's members
+func teamMembers(db *sql.DB, teamID int) ([]int, error) {
+	rows, err := db.Query(`SELECT user_id FROM team_members WHERE team_id = $1 ORDER BY user_id`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+	return users, rows.Err()
+}
+
+// TeamService manages teams, their members and the contacts their alerts
+// are delivered to.
+type TeamService struct {
+	db       *sql.DB
+	contacts *ContactService
+}
+
+func NewTeamService(db *sql.DB, contacts *ContactService) *TeamService {
+	return &TeamService{db: db, contacts: contacts}
+}
+
+// CreateTeam creates a team owned by the user.
+func (s *TeamService) CreateTeam(userID int, name string) (*models.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be 1 to 100 characters", ErrInvalidTeam)
+	}
+	if err := s.contacts.EnsureUser(userID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	team := &models.Team{Name: name, Role: RoleOwner}
+	if err := tx.QueryRow(`INSERT INTO teams (name) VALUES ($1) RETURNING id, created_at`, name).Scan(&team.ID, &team.CreatedAt); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`INSERT INTO team_members (team_id, user_id, role) VALUES ($1, $2, $3)`, team.ID, userID, RoleOwner); err != nil {
+		return nil, err
+	}
+	return team, tx.Commit()
+}
+
+// GetTeams returns the teams the principal is a member of, or every team
+// for admins.
+func (s *TeamService) GetTeams(p *Principal) ([]*models.Team, error) {
+	query := `SELECT t.id, t.name, COALESCE(m.role, ''), t.created_at FROM teams t
+			  LEFT JOIN team_members m ON m.team_id = t.id AND m.user_id = $2
+			  WHERE $1 OR m.user_id IS NOT NULL ORDER BY t.id`
+	rows, err := s.db.Query(query, p.Admin, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []*models.Team{}
+	for rows.Next() {
+		team := &models.Team{}
+		if err := rows.Scan(&team.ID, &team.Name, &team.Role, &team.CreatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// GetTeam returns a team with its members. It returns ErrTeamNotFound if
+// the principal is not a member.
+func (s *TeamService) GetTeam(p *Principal, id int) (*models.Team, error) {
+	role, err := s.Role(p, id)
+	if err != nil {
+		return nil, err
+	}
+	team := &models.Team{ID: id, Role: role}
+	err = s.db.QueryRow(`SELECT name, created_at FROM teams WHERE id = $1`, id).Scan(&team.Name, &team.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	team.Members, err = s.GetMembers(id)
+	if err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// Role returns the principal's role in a team; admins own every team. It
+// returns ErrTeamNotFound if the team does not exist or the principal is
+// not a member.
+func (s *TeamService) Role(p *Principal, teamID int) (string, error) {
+	var role string
+	err := s.db.QueryRow(`SELECT CASE WHEN $3 THEN 'owner' ELSE m.role END FROM teams t
+						 LEFT JOIN team_members m ON m.team_id = t.id AND m.user_id = $2
+						 WHERE t.id = $1 AND ($3 OR m.user_id IS NOT NULL)`, teamID, p.UserID, p.Admin).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrTeamNotFound
+	}
+	return role, err
+}
+
+// DeleteTeam removes a team and its alerts.
+func (s *TeamService) DeleteTeam(id int) error {
+	_, err := s.db.Exec(`DELETE FROM teams WHERE id = $1`, id)
+	return err
+}
+
+func (s *TeamService) GetMembers(teamID int) ([]*models.TeamMember, error) {
+	rows, err := s.db.Query(`SELECT team_id, user_id, role, created_at FROM team_members WHERE team_id = $1 ORDER BY user_id`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*models.TeamMember{}
+	for rows.Next() {
+		m := &models.TeamMember{}
+		if err := rows.Scan(&m.TeamID, &m.UserID, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetMember adds a user to a team or changes their role.
+func (s *TeamService) SetMember(teamID, userID int, role string) (*models.TeamMember, error) {
+	if role != RoleOwner && role != RoleEditor && role != RoleViewer {
+		return nil, fmt.Errorf("%w: role must be %s, %s or %s", ErrInvalidTeam, RoleOwner, RoleEditor, RoleViewer)
+	}
+	if userID <= 0 {
+		return nil, fmt.Errorf("%w: invalid user ID", ErrInvalidTeam)
+	}
+	if err := s.contacts.EnsureUser(userID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := lockTeam(tx, teamID); err != nil {
+		return nil, err
+	}
+
+	m := &models.TeamMember{TeamID: teamID, UserID: userID, Role: role}
+	query := `INSERT INTO team_members (team_id, user_id, role) VALUES ($1, $2, $3)
+			  ON CONFLICT (team_id, user_id) DO UPDATE SET role = $3 RETURNING created_at`
+	if err := tx.QueryRow(query, teamID, userID, role).Scan(&m.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := checkOwners(tx, teamID); err != nil {
+		return nil, err
+	}
+	return m, tx.Commit()
+}
+
+// RemoveMember removes a user from a team, along with the team's routes to
+// their contacts.
+func (s *TeamService) RemoveMember(teamID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := lockTeam(tx, teamID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`, teamID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM team_routes WHERE team_id = $1 AND contact_id IN (SELECT id FROM contacts WHERE user_id = $2)`,
+		teamID, userID); err != nil {
+		return err
+	}
+	if err := checkOwners(tx, teamID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockTeam serializes membership changes of a team, so concurrent changes
+// cannot both remove the last owners
+func lockTeam(tx *sql.Tx, teamID int) error {
+	_, err := tx.Exec(`SELECT 1 FROM teams WHERE id = $1 FOR UPDATE`, teamID)
+	return err
+}
+
+// checkOwners fails with ErrLastOwner if the team has no owner left
+func checkOwners(tx *sql.Tx, teamID int) error {
+	var owners int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM team_members WHERE team_id = $1 AND role = 'owner'`, teamID).Scan(&owners); err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+const teamRouteQuery = `SELECT r.id, r.team_id, c.id, c.channel, c.address, c.verified_at IS NOT NULL, r.created_at
+						FROM team_routes r JOIN contacts c ON c.id = r.contact_id`
+
+func scanTeamRoute(row rowScanner) (*models.TeamRoute, error) {
+	r := &models.TeamRoute{}
+	err := row.Scan(&r.ID, &r.TeamID, &r.ContactID, &r.Channel, &r.Address, &r.Verified, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *TeamService) GetRoutes(teamID int) ([]*models.TeamRoute, error) {
+	rows, err := s.db.Query(teamRouteQuery+` WHERE r.team_id = $1 ORDER BY r.id`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := []*models.TeamRoute{}
+	for rows.Next() {
+		r, err := scanTeamRoute(rows)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
+
+// AddRoute delivers the team's alerts to a contact of one of its members.
+// Unless the principal is an admin the contact must be their own.
+func (s *TeamService) AddRoute(p *Principal, teamID, contactID int) (*models.TeamRoute, error) {
+	var owner int
+	err := s.db.QueryRow(`SELECT c.user_id FROM contacts c JOIN team_members m ON m.user_id = c.user_id AND m.team_id = $2
+						 WHERE c.id = $1`, contactID, teamID).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !p.CanActAs(owner)) {
+		return nil, ErrContactNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	query := `INSERT INTO team_routes (team_id, contact_id) VALUES ($1, $2)
+			  ON CONFLICT (team_id, contact_id) DO UPDATE SET contact_id = EXCLUDED.contact_id RETURNING id`
+	if err := s.db.QueryRow(query, teamID, contactID).Scan(&id); err != nil {
+		return nil, err
+	}
+	return scanTeamRoute(s.db.QueryRow(teamRouteQuery+` WHERE r.id = $1`, id))
+}
+
+func (s *TeamService) DeleteRoute(teamID, id int) error {
+	_, err := s.db.Exec(`DELETE FROM team_routes WHERE id = $1 AND team_id = $2`, id, teamID)
+	return err
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// telegramCaptionLimit is the longest photo caption Telegram accepts
+const telegramCaptionLimit = 1024
+
+// TelegramNotifier sends messages through the Telegram Bot API.
+type TelegramNotifier struct {
+	apiURL   string
+	botToken string
+	renderer *Renderer
+}
+
+func NewTelegramNotifier(apiURL, botToken string, renderer *Renderer) *TelegramNotifier {
+	return &TelegramNotifier{
+		apiURL:   strings.TrimSuffix(apiURL, "/"),
+		botToken: botToken,
+		renderer: renderer,
+	}
+}
+
+func (t *TelegramNotifier) Channel() string {
+	return "telegram"
+}
+
+func (t *TelegramNotifier) Notify(chatID string, n *Notification) error {
+	msg, err := t.renderer.Render(t.Channel(), n)
+	if err != nil {
+		return err
+	}
+
+	// The chart is sent as a photo captioned with the message if it fits
+	chart := notificationChart(n)
+	caption := ""
+	if chart == nil || len([]rune(msg.Text)) > telegramCaptionLimit {
+		if err := t.SendText(chatID, msg.Text); err != nil {
+			return err
+		}
+	} else {
+		caption = msg.Text
+	}
+	if chart == nil {
+		return nil
+	}
+	return postMultipart(notifierClient, t.method("sendPhoto"), map[string]string{"chat_id": chatID, "caption": caption},
+		attachment{Field: "photo", Filename: chartFilename, Data: chart}, nil)
+}
+
+// NotifyDigest sends several notifications as one message.
+func (t *TelegramNotifier) NotifyDigest(chatID string, ns []*Notification) error {
+	msg, err := t.renderer.RenderDigest(t.Channel(), ns)
+	if err != nil {
+		return err
+	}
+	return t.SendText(chatID, msg.Text)
+}
+
+// SendText sends a plain text message to the chat.
+func (t *TelegramNotifier) SendText(chatID, text string) error {
+	return postJSON(notifierClient, t.method("sendMessage"), map[string]string{"chat_id": chatID, "text": text}, nil)
+}
+
+func (t *TelegramNotifier) method(name string) string {
+	return fmt.Sprintf("%s/bot%s/%s", t.apiURL, t.botToken, name)
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"price-alert-system/models"
+)
+
+const (
+	telegramLinkCodeTTL  = 15 * time.Minute
+	telegramLinkAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	telegramPollTimeout  = 25 // seconds
+)
+
+const telegramHelp = `Commands:
+/alerts - list your open alerts
+/new BTCUSDT rsi < 30 - alert when an indicator crosses a value
+/cancel 71 - cancel an alert
+/price ETHUSDT - latest price and indicators
+/link CODE - link this chat to your account`
+
+// TelegramBot answers chat commands sent to the bot. It long polls the Bot
+// API for updates, so it needs no public URL and works against a local
+// stand-in of the API. Chats are linked to users with one-time codes and
+// become the users' telegram contacts.
+type TelegramBot struct {
+	db        *sql.DB
+	notifier  *TelegramNotifier
+	alerts    *AlertService
+	contacts  *ContactService
+	formatter *PriceFormatter
+	client    *http.Client
+	mutex     sync.Mutex
+	username  string
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func NewTelegramBot(db *sql.DB, notifier *TelegramNotifier, alerts *AlertService, contacts *ContactService, formatter *PriceFormatter) *TelegramBot {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TelegramBot{
+		db:        db,
+		notifier:  notifier,
+		alerts:    alerts,
+		contacts:  contacts,
+		formatter: formatter,
+		client:    &http.Client{Timeout: (telegramPollTimeout + 10) * time.Second},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID   int64  `json:"id"`
+			Type string `json:"type"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// Start polls for updates until Stop is called.
+func (b *TelegramBot) Start() {
+	var me struct {
+		Username string `json:"username"`
+	}
+	if err := b.call("getMe", nil, &me); err != nil {
+		log.Printf("Error fetching Telegram bot info: %v", err)
+	}
+	b.mutex.Lock()
+	b.username = me.Username
+	b.mutex.Unlock()
+
+	var offset int64
+	for b.ctx.Err() == nil {
+		var updates []telegramUpdate
+		params := url.Values{
+			"offset":          {strconv.FormatInt(offset, 10)},
+			"timeout":         {strconv.Itoa(telegramPollTimeout)},
+			"allowed_updates": {`["message"]`},
+		}
+		if err := b.call("getUpdates", params, &updates); err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error polling Telegram updates: %v", err)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-b.ctx.Done():
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil || update.Message.Text == "" {
+				continue
+			}
+			chatID := strconv.FormatInt(update.Message.Chat.ID, 10)
+			reply := b.HandleCommand(chatID, update.Message.Text)
+			if err := b.notifier.SendText(chatID, reply); err != nil {
+				log.Printf("Error replying to Telegram chat %s: %v", chatID, err)
+			}
+		}
+	}
+}
+
+func (b *TelegramBot) Stop() {
+	b.cancel()
+}
+
+// call invokes a Bot API method, unwrapping the result on success.
+func (b *TelegramBot) call(method string, params url.Values, result interface{}) error {
+	req, err := http.NewRequestWithContext(b.ctx, http.MethodPost, b.notifier.method(method), strings.NewReader(params.Encode()))
+	if err != nil {
+		return redactURL(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("%s: unexpected response %s: %v", method, resp.Status, err)
+	}
+	if !body.OK {
+		return fmt.Errorf("%s: %s", method, body.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(body.Result, result)
+}
+
+// LinkURL returns a link that opens the bot with the code filled in, or ""
+// if the bot's username is not known.
+func (b *TelegramBot) LinkURL(code string) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.username == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/%s?start=%s", b.username, code)
+}
+
+// CreateLinkCode issues a one-time code that links the chat it is sent from
+// to the user.
+func (b *TelegramBot) CreateLinkCode(userID int) (string, time.Time, error) {
+	if err := b.contacts.EnsureUser(userID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	code := make([]byte, 8)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(telegramLinkAlphabet))))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		code[i] = telegramLinkAlphabet[n.Int64()]
+	}
+
+	// Codes expire in database time, like the outbox schedule
+	var expires time.Time
+	query := `INSERT INTO telegram_link_codes (code, user_id, expires_at)
+			  VALUES ($1, $2, CURRENT_TIMESTAMP + $3 * INTERVAL '1 second')
+			  RETURNING expires_at`
+	err := b.db.QueryRow(query, string(code), userID, telegramLinkCodeTTL.Seconds()).Scan(&expires)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return string(code), expires, nil
+}
+
+// linkChat redeems a code, making the chat the user's telegram contact.
+func (b *TelegramBot) linkChat(chatID, code string) (int, error) {
+	var userID int
+	query := `DELETE FROM telegram_link_codes WHERE code = $1 AND expires_at > CURRENT_TIMESTAMP RETURNING user_id`
+	err := b.db.QueryRow(query, strings.ToUpper(code)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := b.contacts.LinkTelegramChat(userID, chatID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// HandleCommand runs a chat command and returns the reply.
+func (b *TelegramBot) HandleCommand(chatID, text string) string {
+	args := strings.Fields(text)
+	if len(args) == 0 || !strings.HasPrefix(args[0], "/") {
+		return "Unknown command.\n\n" + telegramHelp
+	}
+	// Commands in groups may be addressed as /alerts@BotName
+	command := strings.ToLower(strings.SplitN(args[0], "@", 2)[0])
+	args = args[1:]
+
+	switch command {
+	case "/start", "/link":
+		if len(args) == 0 {
+			return "Welcome! Link this chat to your account with the code from the app: /link CODE\n\n" + telegramHelp
+		}
+		userID, err := b.linkChat(chatID, args[0])
+		if errors.Is(err, ErrInvalidToken) {
+			return "That code is invalid or has expired. Request a new one from the app."
+		}
+		if err != nil {
+			log.Printf("Error linking Telegram chat %s: %v", chatID, err)
+			return "Something went wrong, please try again."
+		}
+		log.Printf("Linked Telegram chat %s to user %d", chatID, userID)
+		return "This chat is now linked to your account. Alerts will be sent here.\n\n" + telegramHelp
+	case "/help":
+		return telegramHelp
+	case "/price":
+		if len(args) != 1 {
+			return "Usage: /price ETHUSDT"
+		}
+		return b.price(strings.ToUpper(args[0]))
+	}
+
+	contact, err := b.contacts.LinkedTelegramContact(chatID)
+	if errors.Is(err, ErrContactNotFound) {
+		return "This chat is not linked to an account yet. Get a code from the app and send /link CODE."
+	}
+	if err != nil {
+		log.Printf("Error looking up Telegram chat %s: %v", chatID, err)
+		return "Something went wrong, please try again."
+	}
+
+	switch command {
+	case "/alerts":
+		return b.listAlerts(&Principal{UserID: contact.UserID, Method: "telegram"})
+	case "/new":
+		return b.newAlert(contact, args)
+	case "/cancel":
+		if len(args) != 1 {
+			return "Usage: /cancel 71"
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+		if err != nil {
+			return "Usage: /cancel 71"
+		}
+		err = b.alerts.CancelAlert(&Principal{UserID: contact.UserID, Method: "telegram"}, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Sprintf("You have no open alert #%d.", id)
+		}
+		if err != nil {
+			log.Printf("Error cancelling alert %d: %v", id, err)
+			return "Something went wrong, please try again."
+		}
+		return fmt.Sprintf("Alert #%d cancelled.", id)
+	default:
+		return "Unknown command.\n\n" + telegramHelp
+	}
+}
+
+func (b *TelegramBot) listAlerts(p *Principal) string {
+	alerts, err := b.alerts.GetOpenAlerts(p)
+	if err != nil {
+		log.Printf("Error fetching alerts of user %d: %v", p.UserID, err)
+		return "Something went wrong, please try again."
+	}
+	if len(alerts) == 0 {
+		return "You have no open alerts. Create one with /new BTCUSDT rsi < 30"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Open alerts:")
+	for _, alert := range alerts {
+		fmt.Fprintf(&sb, "\n#%d %s %s %s %s", alert.ID, alert.Symbol, alert.Indicator, directionOperator(alert.Direction),
+			b.formatter.FormatIndicator(alert.Symbol, alert.Indicator, alert.Value))
+		if alert.TeamID != nil {
+			fmt.Fprintf(&sb, " (team %d)", *alert.TeamID)
+		}
+	}
+	return sb.String()
+}
+
+// newAlert creates an alert from "/new SYMBOL INDICATOR OPERATOR VALUE",
+// delivered to this chat.
+func (b *TelegramBot) newAlert(contact *models.Contact, args []string) string {
+	const usage = "Usage: /new BTCUSDT rsi < 30"
+	if len(args) != 4 {
+		return usage
+	}
+
+	var direction string
+	switch strings.ToLower(args[2]) {
+	case ">", "above":
+		direction = "UP"
+	case "<", "below":
+		direction = "DOWN"
+	default:
+		return usage
+	}
+	value, err := strconv.ParseFloat(args[3], 64)
+	if err != nil {
+		return usage
+	}
+	indicator, ok := b.alerts.indicatorName(args[1])
+	if !ok {
+		return fmt.Sprintf("Unknown indicator %s. Available: %s", args[1], strings.Join(b.alerts.indicatorNames(), ", "))
+	}
+
+	alert := &models.Alert{
+		UserID:    contact.UserID,
+		Symbol:    args[0],
+		Indicator: indicator,
+		Direction: direction,
+		Value:     value,
+		Channels:  []string{b.notifier.Channel()},
+		ContactID: &contact.ID,
+	}
+	err = b.alerts.CreateAlert(&Principal{UserID: contact.UserID, Method: "telegram"}, alert)
+	if errors.Is(err, ErrInvalidAlert) {
+		return err.Error()
+	}
+	if err != nil {
+		log.Printf("Error creating alert from Telegram chat %s: %v", contact.Address, err)
+		return "Something went wrong, please try again."
+	}
+	return fmt.Sprintf("Alert #%d created: %s %s %s %s", alert.ID, alert.Symbol, alert.Indicator, args[2],
+		b.formatter.FormatIndicator(alert.Symbol, alert.Indicator, alert.Value))
+}
+
+func (b *TelegramBot) price(symbol string) string {
+	price, ok := b.alerts.indicatorService.Price(symbol)
+	if !ok {
+		return fmt.Sprintf("No market data for %s.", symbol)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s", symbol, b.formatter.FormatPrice(symbol, price))
+	indicators := b.alerts.indicatorSnapshot(symbol)
+	names := make([]string, 0, len(indicators))
+	for name := range indicators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "\n%s %s", name, b.formatter.FormatIndicator(symbol, name, indicators[name]))
+	}
+	return sb.String()
+}
+
+func directionOperator(direction string) string {
+	if strings.ToUpper(direction) == "DOWN" {
+		return "<"
+	}
+	return ">"
+}
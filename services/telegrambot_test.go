@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestContactsRejectTelegramChats(t *testing.T) {
+	contacts := NewContactService(nil, nil, "")
+	if _, err := contacts.CreateContact(1, "telegram", "42"); !errors.Is(err, ErrInvalidContact) {
+		t.Errorf("CreateContact(telegram) = %v, want ErrInvalidContact", err)
+	}
+	if _, err := contacts.FindOrCreateContact(1, "telegram", "42"); !errors.Is(err, ErrInvalidContact) {
+		t.Errorf("FindOrCreateContact(telegram) = %v, want ErrInvalidContact", err)
+	}
+}
+
+func TestTelegramBotOnlyTrustsLinkedChats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	bot := NewTelegramBot(db, nil, nil, NewContactService(db, nil, ""), nil)
+
+	linked := regexp.QuoteMeta(`WHERE channel = 'telegram' AND address = $1 AND verified_at IS NOT NULL AND linked_at IS NOT NULL`)
+	contactRows := []string{"id", "user_id", "channel", "address", "verified_at", "created_at"}
+
+	// A chat given as a contact without redeeming a code finds no account
+	mock.ExpectQuery(linked).WithArgs("42").WillReturnRows(sqlmock.NewRows(contactRows))
+	if reply := bot.HandleCommand("42", "/alerts"); !strings.Contains(reply, "not linked") {
+		t.Errorf("/alerts from an unlinked chat = %q", reply)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM telegram_link_codes WHERE code = $1`)).WithArgs("K7QF2M9X").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (id)`)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM contacts WHERE channel = 'telegram' AND address = $1 AND user_id <> $2`)).
+		WithArgs("42", 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO contacts (user_id, channel, address, verified_at, linked_at)`)).WithArgs(1, "42").
+		WillReturnRows(sqlmock.NewRows(contactRows).AddRow(6, 1, "telegram", "42", time.Now(), time.Now()))
+	if reply := bot.HandleCommand("42", "/link k7qf2m9x"); !strings.Contains(reply, "now linked") {
+		t.Errorf("/link = %q", reply)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
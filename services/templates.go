@@ -0,0 +1,384 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"price-alert-system/models"
+)
+
+// ErrInvalidTemplate is wrapped by errors of user supplied templates.
+var ErrInvalidTemplate = errors.New("invalid template")
+
+// maxSubjectLength bounds rendered subjects
+const maxSubjectLength = 200
+
+// DefaultSubject is the subject template used unless the user sets their own
+const DefaultSubject = `{{.Symbol}} {{.Indicator}} {{.Condition}} {{.Value}}`
+
+// Default templates per channel. Channels without their own templates use
+// the "default" text template.
+var (
+	defaultTextTemplates = map[string]string{
+		"default": `{{.Subject}} (current {{.CurrentValue}})`,
+		"email": `{{.Subject}}
+
+Your alert #{{.AlertID}} has been triggered.
+
+Symbol:        {{.Symbol}}
+Indicator:     {{.Indicator}}
+Condition:     {{.Condition}} {{.Value}}
+Current value: {{.CurrentValue}}
+{{if .Price}}Price:         {{.Price}}
+{{end}}Triggered at:  {{.TriggeredAt}}
+{{if .Indicators}}
+Indicators:
+{{range .Indicators}}  {{.Name}}: {{.Value}}
+{{end}}{{end}}`,
+		"slack": `*{{.Subject}}*
+{{.Indicator}} is {{.CurrentValue}}, {{.Condition}} {{.Value}} (alert #{{.AlertID}}, {{.TriggeredAt}})`,
+		"discord": `**{{.Subject}}**
+{{.Indicator}} is {{.CurrentValue}}, {{.Condition}} {{.Value}} (alert #{{.AlertID}}, {{.TriggeredAt}})`,
+		"telegram": `{{.Subject}}
+{{.Indicator}} is {{.CurrentValue}}, {{.Condition}} {{.Value}}
+Alert #{{.AlertID}}, {{.TriggeredAt}}`,
+		"sms": `{{.Subject}} (now {{.CurrentValue}})`,
+	}
+	defaultHTMLTemplates = map[string]string{
+		"email": `<h1>{{.Subject}}</h1>
+<p>Your alert #{{.AlertID}} has been triggered:</p>
+<table>
+	<tr><td>Symbol</td><td>{{.Symbol}}</td></tr>
+	<tr><td>Indicator</td><td>{{.Indicator}}</td></tr>
+	<tr><td>Condition</td><td>{{.Condition}} {{.Value}}</td></tr>
+	<tr><td>Current value</td><td><strong>{{.CurrentValue}}</strong></td></tr>
+{{if .Price}}	<tr><td>Price</td><td>{{.Price}}</td></tr>
+{{end}}	<tr><td>Triggered at</td><td>{{.TriggeredAt}}</td></tr>
+</table>
+{{if .Chart}}<p><img src="cid:` + chartFilename + `" alt="{{.Symbol}} chart" width="800" height="480"></p>
+{{end}}{{if .Indicators}}<h2>Indicators</h2>
+<ul>
+{{range .Indicators}}	<li>{{.Name}}: {{.Value}}</li>
+{{end}}</ul>
+{{end}}`,
+	}
+)
+
+// DigestSubject is the subject of digests
+const DigestSubject = `{{.Count}} price alerts triggered`
+
+// Digest templates per channel, executed with DigestData
+var (
+	digestTextTemplates = map[string]string{
+		"default": `{{.Subject}}
+{{range .Alerts}}- {{.Subject}} (current {{.CurrentValue}}, {{.TriggeredAt}})
+{{end}}`,
+		"email": `{{.Subject}}
+{{range .Alerts}}
+{{.Subject}}
+  Alert #{{.AlertID}}: {{.Indicator}} {{.Condition}} {{.Value}}, current value {{.CurrentValue}}{{if .Price}}, price {{.Price}}{{end}}
+  Triggered at {{.TriggeredAt}}
+{{end}}`,
+		"slack": `*{{.Subject}}*
+{{range .Alerts}}• {{.Subject}} (current {{.CurrentValue}}, {{.TriggeredAt}})
+{{end}}`,
+		"discord": `**{{.Subject}}**
+{{range .Alerts}}- {{.Subject}} (current {{.CurrentValue}}, {{.TriggeredAt}})
+{{end}}`,
+		"sms": `{{.Subject}}: {{range $i, $a := .Alerts}}{{if $i}}; {{end}}{{$a.Symbol}} {{$a.Indicator}} {{$a.CurrentValue}}{{end}}`,
+	}
+	digestHTMLTemplates = map[string]string{
+		"email": `<h1>{{.Subject}}</h1>
+<table>
+	<tr><th>Alert</th><th>Condition</th><th>Current value</th><th>Price</th><th>Triggered at</th></tr>
+{{range .Alerts}}	<tr><td>#{{.AlertID}} {{.Symbol}} {{.Indicator}}</td><td>{{.Condition}} {{.Value}}</td><td><strong>{{.CurrentValue}}</strong></td><td>{{.Price}}</td><td>{{.TriggeredAt}}</td></tr>
+{{end}}</table>`,
+	}
+)
+
+// DigestData is what digest templates are executed with.
+type DigestData struct {
+	Subject string
+	Count   int
+	Alerts  []*TemplateData
+}
+
+// Message is a rendered notification. HTML is only set for channels that
+// support it and is an alternative to Text.
+type Message struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// TemplateData is what notification templates are executed with. Values are
+// formatted with the precision of the symbol.
+type TemplateData struct {
+	AlertID      int
+	UserID       int
+	Symbol       string
+	Indicator    string
+	Direction    string
+	Condition    string // "above" or "below"
+	Value        string
+	CurrentValue string
+	Price        string // Empty if the symbol's price is unknown
+	TriggeredAt  string
+	Indicators   []IndicatorValue
+	Chart        bool   // Whether a chart image accompanies the message
+	Subject      string // Empty while the subject itself is rendered
+}
+
+// IndicatorValue is one entry of TemplateData.Indicators.
+type IndicatorValue struct {
+	Name  string
+	Value string
+}
+
+// Renderer renders notifications from the channel templates and the user's
+// subject.
+type Renderer struct {
+	db        *sql.DB
+	formatter *PriceFormatter
+	subject   *texttemplate.Template
+	text      map[string]*texttemplate.Template
+	html      map[string]*htmltemplate.Template
+	digest    *texttemplate.Template
+	// Digest templates per channel
+	digestText map[string]*texttemplate.Template
+	digestHTML map[string]*htmltemplate.Template
+}
+
+func NewRenderer(db *sql.DB, formatter *PriceFormatter) *Renderer {
+	r := &Renderer{
+		db:        db,
+		formatter: formatter,
+		subject:   texttemplate.Must(texttemplate.New("subject").Parse(DefaultSubject)),
+		text:      make(map[string]*texttemplate.Template),
+		html:      make(map[string]*htmltemplate.Template),
+		digest:    texttemplate.Must(texttemplate.New("digest").Parse(DigestSubject)),
+
+		digestText: make(map[string]*texttemplate.Template),
+		digestHTML: make(map[string]*htmltemplate.Template),
+	}
+	for channel, tmpl := range defaultTextTemplates {
+		r.text[channel] = texttemplate.Must(texttemplate.New(channel).Parse(tmpl))
+	}
+	for channel, tmpl := range defaultHTMLTemplates {
+		r.html[channel] = htmltemplate.Must(htmltemplate.New(channel).Parse(tmpl))
+	}
+	for channel, tmpl := range digestTextTemplates {
+		r.digestText[channel] = texttemplate.Must(texttemplate.New(channel).Parse(tmpl))
+	}
+	for channel, tmpl := range digestHTMLTemplates {
+		r.digestHTML[channel] = htmltemplate.Must(htmltemplate.New(channel).Parse(tmpl))
+	}
+	return r
+}
+
+// Render renders n for a channel with the subject of the alert's user.
+func (r *Renderer) Render(channel string, n *Notification) (*Message, error) {
+	subject, err := r.GetSubjectTemplate(n.Alert.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return r.Preview(channel, subject, n)
+}
+
+// Preview renders n for a channel with the given subject template, or the
+// default subject if it is empty.
+func (r *Renderer) Preview(channel, subject string, n *Notification) (*Message, error) {
+	subjectTmpl := r.subject
+	if subject != "" {
+		var err error
+		if subjectTmpl, err = parseSubject(subject); err != nil {
+			return nil, err
+		}
+	}
+
+	data := r.templateData(n)
+	msg := &Message{}
+	var buf bytes.Buffer
+	if err := subjectTmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	msg.Subject = cleanSubject(buf.String())
+	data.Subject = msg.Subject
+
+	textTmpl, ok := r.text[channel]
+	if !ok {
+		textTmpl = r.text["default"]
+	}
+	buf.Reset()
+	if err := textTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	msg.Text = strings.TrimSpace(buf.String())
+
+	if htmlTmpl, ok := r.html[channel]; ok {
+		buf.Reset()
+		if err := htmlTmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
+
+// RenderDigest renders several notifications of one user as a single
+// message. Each entry carries its subject from the user's subject template.
+func (r *Renderer) RenderDigest(channel string, ns []*Notification) (*Message, error) {
+	subject, err := r.GetSubjectTemplate(ns[0].Alert.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &DigestData{Count: len(ns)}
+	for _, n := range ns {
+		msg, err := r.Preview(channel, subject, n)
+		if err != nil {
+			return nil, err
+		}
+		entry := r.templateData(n)
+		entry.Subject = msg.Subject
+		data.Alerts = append(data.Alerts, entry)
+	}
+
+	msg := &Message{}
+	var buf bytes.Buffer
+	if err := r.digest.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	msg.Subject = cleanSubject(buf.String())
+	data.Subject = msg.Subject
+
+	textTmpl, ok := r.digestText[channel]
+	if !ok {
+		textTmpl = r.digestText["default"]
+	}
+	buf.Reset()
+	if err := textTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	msg.Text = strings.TrimSpace(buf.String())
+
+	if htmlTmpl, ok := r.digestHTML[channel]; ok {
+		buf.Reset()
+		if err := htmlTmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
+
+func (r *Renderer) templateData(n *Notification) *TemplateData {
+	alert := n.Alert
+	condition := "above"
+	if strings.ToUpper(alert.Direction) == "DOWN" {
+		condition = "below"
+	}
+
+	data := &TemplateData{
+		AlertID:      alert.ID,
+		UserID:       alert.UserID,
+		Symbol:       alert.Symbol,
+		Indicator:    alert.Indicator,
+		Direction:    strings.ToUpper(alert.Direction),
+		Condition:    condition,
+		Value:        r.formatter.FormatIndicator(alert.Symbol, alert.Indicator, alert.Value),
+		CurrentValue: r.formatter.FormatIndicator(alert.Symbol, alert.Indicator, n.CurrentValue),
+		TriggeredAt:  n.TriggeredAt.UTC().Format(time.RFC1123),
+		Chart:        chartAvailable(n),
+	}
+	if n.Price != 0 {
+		data.Price = r.formatter.FormatPrice(alert.Symbol, n.Price)
+	}
+
+	names := make([]string, 0, len(n.Indicators))
+	for name := range n.Indicators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data.Indicators = append(data.Indicators, IndicatorValue{
+			Name:  name,
+			Value: r.formatter.FormatIndicator(alert.Symbol, name, n.Indicators[name]),
+		})
+	}
+	return data
+}
+
+// GetSubjectTemplate returns the user's subject template, or the default.
+func (r *Renderer) GetSubjectTemplate(userID int) (string, error) {
+	var subject sql.NullString
+	err := r.db.QueryRow(`SELECT subject_template FROM users WHERE id = $1`, userID).Scan(&subject)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if !subject.Valid || subject.String == "" {
+		return DefaultSubject, nil
+	}
+	return subject.String, nil
+}
+
+// SetSubjectTemplate validates and stores the user's subject template. An
+// empty subject restores the default.
+func (r *Renderer) SetSubjectTemplate(userID int, subject string) error {
+	var value sql.NullString
+	if subject != "" {
+		// Render a sample so templates failing at execution are rejected too
+		if _, err := r.Preview("email", subject, sampleNotification(userID)); err != nil {
+			return err
+		}
+		value = sql.NullString{String: subject, Valid: true}
+	}
+
+	query := `INSERT INTO users (id, subject_template) VALUES ($1, $2)
+			  ON CONFLICT (id) DO UPDATE SET subject_template = $2`
+	_, err := r.db.Exec(query, userID, value)
+	return err
+}
+
+func parseSubject(subject string) (*texttemplate.Template, error) {
+	tmpl, err := texttemplate.New("subject").Option("missingkey=error").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return tmpl, nil
+}
+
+// cleanSubject keeps subjects on one line and bounded in length
+func cleanSubject(subject string) string {
+	subject = strings.Join(strings.Fields(subject), " ")
+	if len(subject) > maxSubjectLength {
+		subject = strings.ToValidUTF8(subject[:maxSubjectLength], "")
+	}
+	return subject
+}
+
+// sampleNotification is used to check subject templates
+func sampleNotification(userID int) *Notification {
+	return &Notification{
+		Alert: models.Alert{
+			ID:        1,
+			UserID:    userID,
+			Symbol:    DefaultSymbol,
+			Indicator: "RSI",
+			Direction: "UP",
+			Value:     70,
+			Status:    "triggered",
+		},
+		CurrentValue: 71.5,
+		TriggeredAt:  time.Now(),
+		Price:        65000,
+		Indicators:   map[string]float64{"RSI": 71.5},
+	}
+}
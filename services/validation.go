@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"price-alert-system/models"
+)
+
+// FieldError describes what is wrong with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects the field errors of a request. It wraps the
+// error of the kind of request, e.g. ErrInvalidAlert.
+type ValidationError struct {
+	Err    error
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Field + ": " + f.Message
+	}
+	return fmt.Sprintf("%v: %s", e.Err, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Add records an error of a field.
+func (e *ValidationError) Add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// OrNil returns e if it has field errors and nil otherwise.
+func (e *ValidationError) OrNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9]{2,20}$`)
+
+// indicatorRanges bound the values of indicators with a fixed range.
+// Thresholds of priceIndicators must be positive.
+var indicatorRanges = map[string][2]float64{
+	"RSI": {0, 100},
+}
+
+// validateAlert checks the fields of an alert and normalizes the symbol,
+// direction, indicator and priority.
+func (s *AlertService) validateAlert(alert *models.Alert) error {
+	verr := &ValidationError{Err: ErrInvalidAlert}
+
+	if alert.UserID <= 0 {
+		verr.Add("user_id", "must be a positive integer")
+	}
+
+	if alert.Symbol == "" {
+		alert.Symbol = DefaultSymbol
+	}
+	alert.Symbol = strings.ToUpper(strings.TrimSpace(alert.Symbol))
+	if !symbolPattern.MatchString(alert.Symbol) {
+		verr.Add("symbol", "must be 2 to 20 letters and digits, e.g. BTCUSDT")
+	}
+
+	alert.Direction = strings.ToUpper(strings.TrimSpace(alert.Direction))
+	if alert.Direction != "UP" && alert.Direction != "DOWN" {
+		verr.Add("direction", "must be UP or DOWN")
+	}
+
+	indicator, ok := s.indicatorName(strings.TrimSpace(alert.Indicator))
+	if ok {
+		alert.Indicator = indicator
+	} else {
+		verr.Add("indicator", "must be one of %s", strings.Join(s.indicatorNames(), ", "))
+	}
+
+	switch {
+	case math.IsNaN(alert.Value) || math.IsInf(alert.Value, 0):
+		verr.Add("value", "must be a finite number")
+	case priceIndicators[alert.Indicator] && alert.Value <= 0:
+		verr.Add("value", "must be positive for %s", alert.Indicator)
+	default:
+		if r, ok := indicatorRanges[alert.Indicator]; ok && (alert.Value < r[0] || alert.Value > r[1]) {
+			verr.Add("value", "must be between %g and %g for %s", r[0], r[1], alert.Indicator)
+		}
+	}
+
+	alert.Email = strings.TrimSpace(alert.Email)
+	if alert.Email != "" {
+		if _, err := mail.ParseAddress(alert.Email); err != nil {
+			verr.Add("email", "must be a valid email address")
+		}
+	}
+
+	if alert.Priority == "" {
+		alert.Priority = PriorityNormal
+	}
+	if alert.Priority != PriorityNormal && alert.Priority != PriorityHigh {
+		verr.Add("priority", "must be %s or %s", PriorityNormal, PriorityHigh)
+	}
+
+	for i, channel := range alert.Channels {
+		if err := s.dispatcher.ValidateChannels([]string{channel}); err != nil {
+			verr.Add(fmt.Sprintf("channels[%d]", i), "unknown channel %q, available: %s", channel, strings.Join(s.dispatcher.Channels(), ", "))
+		}
+	}
+
+	return verr.OrNil()
+}
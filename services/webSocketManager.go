@@ -1,26 +1,38 @@
 package services
 
 import (
+	"errors"
+	"io"
 	"log"
 	"strconv"
 	"time"
 
-	"github.com/gorilla/websocket"
-
 	"price-alert-system/models"
 )
 
+// TradeProvider opens a stream of trades for the WebSocketManager to consume.
+type TradeProvider interface {
+	Connect() (TradeStream, error)
+}
+
+// TradeStream yields trades until it is closed. A stream that has no more
+// data to deliver, such as a finished replay, returns io.EOF.
+type TradeStream interface {
+	ReadTrade() (models.Trade, error)
+	Close() error
+}
+
 type WebSocketManager struct {
-	binanceService   *BinanceService
+	provider         TradeProvider
 	indicatorService *IndicatorService
 	alertService     *AlertService
-	conn             *websocket.Conn
+	stream           TradeStream
 	done             chan struct{}
 }
 
-func NewWebSocketManager(binanceService *BinanceService, indicatorService *IndicatorService, alertService *AlertService) *WebSocketManager {
+func NewWebSocketManager(provider TradeProvider, indicatorService *IndicatorService, alertService *AlertService) *WebSocketManager {
 	return &WebSocketManager{
-		binanceService:   binanceService,
+		provider:         provider,
 		indicatorService: indicatorService,
 		alertService:     alertService,
 		done:             make(chan struct{}),
@@ -35,7 +47,11 @@ func (m *WebSocketManager) Start() {
 			continue
 		}
 
-		m.readMessages()
+		err := m.readMessages()
+		if errors.Is(err, io.EOF) {
+			log.Println("Trade stream exhausted")
+			return
+		}
 
 		select {
 		case <-m.done:
@@ -49,23 +65,25 @@ func (m *WebSocketManager) Start() {
 
 func (m *WebSocketManager) Stop() {
 	close(m.done)
-	if m.conn != nil {
-		m.conn.Close()
+	if m.stream != nil {
+		m.stream.Close()
 	}
 }
 
 func (m *WebSocketManager) connect() error {
 	var err error
-	m.conn, err = m.binanceService.ConnectWebSocket()
+	m.stream, err = m.provider.Connect()
 	return err
 }
 
-func (m *WebSocketManager) readMessages() {
+func (m *WebSocketManager) readMessages() error {
 	for {
-		trade, err := m.binanceService.ReadMessage(m.conn)
+		trade, err := m.stream.ReadTrade()
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			return
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Error reading message: %v", err)
+			}
+			return err
 		}
 
 		price, err := strconv.ParseFloat(trade.Price, 64)
@@ -84,11 +102,11 @@ func (m *WebSocketManager) readMessages() {
 			CloseTime: trade.TradeTime,
 		}
 
-		m.indicatorService.UpdateKlines(kline)
+		m.indicatorService.UpdateKlines(trade.Symbol, kline)
 
 		select {
 		case <-m.done:
-			return
+			return nil
 		default:
 		}
 	}
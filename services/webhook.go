@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"price-alert-system/models"
+	"price-alert-system/webhook"
+)
+
+// WebhookNotifier posts signed webhook.Payload requests to registered URLs.
+// Webhooks registered for an alert take precedence over the user's.
+type WebhookNotifier struct {
+	db *sql.DB
+}
+
+func NewWebhookNotifier(db *sql.DB) *WebhookNotifier {
+	return &WebhookNotifier{
+		db: db,
+	}
+}
+
+func (w *WebhookNotifier) Channel() string {
+	return "webhook"
+}
+
+// Targets returns the IDs of the webhooks the alert is delivered to.
+func (w *WebhookNotifier) Targets(alert *models.Alert) ([]string, error) {
+	query := `SELECT id FROM webhooks WHERE user_id = $1 AND (alert_id = $2 OR alert_id IS NULL)
+			  AND (alert_id IS NOT NULL OR NOT EXISTS (SELECT 1 FROM webhooks WHERE alert_id = $2))
+			  ORDER BY id`
+	rows, err := w.db.Query(query, alert.UserID, alert.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []string
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		targets = append(targets, strconv.Itoa(id))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no webhook registered for alert %d or user %d", alert.ID, alert.UserID)
+	}
+	return targets, nil
+}
+
+func (w *WebhookNotifier) Notify(target string, n *Notification) error {
+	var url, secret string
+	err := w.db.QueryRow(`SELECT url, secret FROM webhooks WHERE id = $1`, target).Scan(&url, &secret)
+	if err != nil {
+		return fmt.Errorf("error fetching webhook %s: %v", target, err)
+	}
+
+	deliveryID := webhookDeliveryID(target, n)
+	body, err := json.Marshal(webhookPayload(deliveryID, n))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return redactURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "price-alert-system-webhook/"+webhook.Version)
+	req.Header.Set(webhook.DeliveryHeader, deliveryID)
+	webhook.SetHeaders(req.Header, secret, time.Now(), body)
+
+	return doRequest(targetClient, req)
+}
+
+// webhookDeliveryID identifies the delivery of an alert occurrence to a
+// webhook. It is derived from the outbox dedupe key, so retries of a
+// delivery carry the same ID and receivers can drop the repeats.
+func webhookDeliveryID(target string, n *Notification) string {
+	sum := sha256.Sum256([]byte(dedupeKey(&n.Alert, Route{Channel: "webhook", Target: target})))
+	return hex.EncodeToString(sum[:16])
+}
+
+func webhookPayload(deliveryID string, n *Notification) *webhook.Payload {
+	return &webhook.Payload{
+		Version:    webhook.Version,
+		Event:      webhook.EventAlertTriggered,
+		DeliveryID: deliveryID,
+		CreatedAt:  time.Now().UTC(),
+		Alert: webhook.Alert{
+			ID:        n.Alert.ID,
+			UserID:    n.Alert.UserID,
+			Symbol:    n.Alert.Symbol,
+			Indicator: n.Alert.Indicator,
+			Direction: n.Alert.Direction,
+			Value:     n.Alert.Value,
+			Status:    n.Alert.Status,
+		},
+		Trigger: webhook.Trigger{
+			Value:       n.CurrentValue,
+			TriggeredAt: n.TriggeredAt.UTC(),
+		},
+		Indicators: n.Indicators,
+	}
+}
+
+// CreateWebhook registers a webhook for a user, or for one of the user's
+// alerts when AlertID is set, and generates its signing secret.
+func (w *WebhookNotifier) CreateWebhook(hook *models.Webhook) error {
+	hook.Secret = "whsec_" + randomHex(32)
+	query := `INSERT INTO webhooks (user_id, alert_id, url, secret) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	return w.db.QueryRow(query, hook.UserID, hook.AlertID, hook.URL, hook.Secret).Scan(&hook.ID, &hook.CreatedAt)
+}
+
+// GetWebhooks lists a user's webhooks without their secrets.
+func (w *WebhookNotifier) GetWebhooks(userID int) ([]*models.Webhook, error) {
+	query := `SELECT id, user_id, alert_id, url, created_at FROM webhooks WHERE user_id = $1 ORDER BY id`
+	rows, err := w.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*models.Webhook
+	for rows.Next() {
+		hook := &models.Webhook{}
+		if err := rows.Scan(&hook.ID, &hook.UserID, &hook.AlertID, &hook.URL, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+func (w *WebhookNotifier) DeleteWebhook(userID, id int) error {
+	_, err := w.db.Exec(`DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, id, userID)
+	return err
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
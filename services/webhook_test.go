@@ -0,0 +1,91 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"price-alert-system/models"
+	"price-alert-system/webhook"
+)
+
+func TestWebhookNotifierNotify(t *testing.T) {
+	const secret = "whsec_test"
+	allowPrivateTargets = true
+	defer func() { allowPrivateTargets = false }()
+
+	var requests []*http.Request
+	var payloads []webhook.Payload
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := webhook.VerifyRequest(r, secret, webhook.DefaultTolerance)
+		if err != nil {
+			t.Errorf("VerifyRequest() = %v", err)
+		}
+		var payload webhook.Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("error decoding payload: %v", err)
+		}
+		requests = append(requests, r)
+		payloads = append(payloads, payload)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT url, secret FROM webhooks WHERE id = $1`)).
+			WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"url", "secret"}).AddRow(server.URL, secret))
+	}
+
+	n := &Notification{
+		Alert:        models.Alert{ID: 71, UserID: 1, Symbol: "BTCUSDT", Indicator: "RSI", Direction: "UP", Value: 70, Status: "triggered", Occurrence: 2},
+		CurrentValue: 71.23,
+		TriggeredAt:  time.Date(2024, 5, 1, 13, 45, 0, 0, time.UTC),
+	}
+	notifier := NewWebhookNotifier(db)
+	if err := notifier.Notify("7", n); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	// A retry of the same delivery
+	if err := notifier.Notify("7", n); err != nil {
+		t.Fatalf("Notify() retry = %v", err)
+	}
+	status = http.StatusInternalServerError
+	if err := notifier.Notify("7", n); err == nil {
+		t.Error("Notify() succeeded on a 500 response")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if len(payloads) != 3 {
+		t.Fatalf("got %d requests, want 3", len(payloads))
+	}
+	first := payloads[0]
+	if first.Event != webhook.EventAlertTriggered || first.Alert.ID != 71 || first.Alert.Symbol != "BTCUSDT" || first.Trigger.Value != 71.23 {
+		t.Errorf("unexpected payload %+v", first)
+	}
+	if got := requests[0].Header.Get(webhook.DeliveryHeader); got != first.DeliveryID || got == "" {
+		t.Errorf("%s = %q, want the payload's delivery ID %q", webhook.DeliveryHeader, got, first.DeliveryID)
+	}
+	if payloads[1].DeliveryID != first.DeliveryID {
+		t.Errorf("retry delivery ID = %q, want %q", payloads[1].DeliveryID, first.DeliveryID)
+	}
+
+	next := *n
+	next.Alert.Occurrence++
+	if webhookDeliveryID("7", &next) == first.DeliveryID || webhookDeliveryID("8", n) == first.DeliveryID {
+		t.Error("other occurrences and webhooks share the delivery ID")
+	}
+}
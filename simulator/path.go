@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+
+	"price-alert-system/services"
+)
+
+// PricePath scripts the trades served by the simulator. Next returns the
+// next trade price and the simulated time since the previous trade, or
+// ok == false once the path is exhausted.
+type PricePath interface {
+	Next() (price float64, wait time.Duration, ok bool)
+}
+
+// RandomWalk is a geometric random walk: every interval the price moves by a
+// normally distributed fraction with the given volatility.
+type RandomWalk struct {
+	price      float64
+	volatility float64
+	interval   time.Duration
+	remaining  int
+	rng        *rand.Rand
+}
+
+// NewRandomWalk creates a walk of count trades. The same seed always yields
+// the same prices.
+func NewRandomWalk(start, volatility float64, interval time.Duration, count int, seed int64) *RandomWalk {
+	return &RandomWalk{
+		price:      start,
+		volatility: volatility,
+		interval:   interval,
+		remaining:  count,
+		rng:        rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (p *RandomWalk) Next() (float64, time.Duration, bool) {
+	if p.remaining <= 0 {
+		return 0, 0, false
+	}
+	p.remaining--
+	p.price *= 1 + p.volatility*p.rng.NormFloat64()
+	return p.price, p.interval, true
+}
+
+// Step holds Price for Duration.
+type Step struct {
+	Price    float64
+	Duration time.Duration
+}
+
+// StepPath emits one trade every interval at the price of the current step.
+type StepPath struct {
+	steps    []Step
+	interval time.Duration
+	index    int
+	elapsed  time.Duration
+}
+
+func NewStepPath(interval time.Duration, steps ...Step) *StepPath {
+	return &StepPath{
+		steps:    steps,
+		interval: interval,
+	}
+}
+
+func (p *StepPath) Next() (float64, time.Duration, bool) {
+	for p.index < len(p.steps) && p.elapsed >= p.steps[p.index].Duration {
+		p.index++
+		p.elapsed = 0
+	}
+	if p.index >= len(p.steps) {
+		return 0, 0, false
+	}
+	p.elapsed += p.interval
+	return p.steps[p.index].Price, p.interval, true
+}
+
+// ReplayPath serves the trades of files written by services.Recorder, keeping
+// the gaps between their trade times.
+type ReplayPath struct {
+	stream   services.TradeStream
+	lastTime int64
+}
+
+func NewReplayPath(files ...string) (*ReplayPath, error) {
+	stream, err := services.NewReplayProvider(files, 0).Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayPath{stream: stream}, nil
+}
+
+func (p *ReplayPath) Next() (float64, time.Duration, bool) {
+	for {
+		trade, err := p.stream.ReadTrade()
+		if err != nil {
+			p.stream.Close()
+			return 0, 0, false
+		}
+		price, err := strconv.ParseFloat(trade.Price, 64)
+		if err != nil {
+			continue
+		}
+
+		var wait time.Duration
+		if p.lastTime != 0 && trade.TradeTime > p.lastTime {
+			wait = time.Duration(trade.TradeTime-p.lastTime) * time.Millisecond
+		}
+		p.lastTime = trade.TradeTime
+		return price, wait, true
+	}
+}
@@ -0,0 +1,499 @@
+// Package simulator serves Binance compatible trade streams and REST klines
+// from scripted price paths so the service can run without the exchange.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var klineIntervals = map[string]time.Duration{
+	"1s":  time.Second,
+	"1m":  time.Minute,
+	"3m":  3 * time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+type Options struct {
+	// Symbol served by the simulator, defaults to BTCUSDT
+	Symbol string
+	// Speed is simulated time per real time: 1 waits the scripted gaps, 60
+	// runs a minute per second and 0 emits trades without waiting
+	Speed float64
+	// StartTime is the simulated time of the first trade, defaults to now
+	StartTime time.Time
+	// Quantity of every trade, defaults to 1
+	Quantity float64
+}
+
+type trade struct {
+	ID       int64
+	Time     int64
+	Price    float64
+	Quantity float64
+}
+
+type subscriber struct {
+	trades chan trade
+	done   chan struct{}
+}
+
+// Server runs a price path and serves it over the Binance stream and REST
+// protocols. Trades are generated once Start is called and broadcast to every
+// connected stream client.
+type Server struct {
+	opts        Options
+	path        PricePath
+	mutex       sync.RWMutex
+	trades      []trade
+	subscribers map[*subscriber]struct{}
+	upgrader    websocket.Upgrader
+	startOnce   sync.Once
+	finished    chan struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+func NewServer(path PricePath, opts Options) *Server {
+	if opts.Symbol == "" {
+		opts.Symbol = "BTCUSDT"
+	}
+	opts.Symbol = strings.ToUpper(opts.Symbol)
+	if opts.StartTime.IsZero() {
+		opts.StartTime = time.Now()
+	}
+	if opts.Quantity == 0 {
+		opts.Quantity = 1
+	}
+
+	return &Server{
+		opts:        opts,
+		path:        path,
+		subscribers: make(map[*subscriber]struct{}),
+		finished:    make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Handler serves the trade, aggTrade and kline_<interval> streams as raw
+// (/ws/) and combined (/stream) streams, /api/v3/klines, /api/v3/uiKlines and
+// /api/v3/ping.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/", s.handleStream)
+	mux.HandleFunc("/stream", s.handleStream)
+	mux.HandleFunc("/api/v3/klines", s.handleKlines)
+	mux.HandleFunc("/api/v3/uiKlines", s.handleKlines)
+	mux.HandleFunc("/api/v3/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	})
+	return mux
+}
+
+// Start begins generating trades from the price path. Calling it again has
+// no effect.
+func (s *Server) Start() {
+	s.startOnce.Do(func() {
+		go s.run()
+	})
+}
+
+// Finished is closed once the price path is exhausted.
+func (s *Server) Finished() <-chan struct{} {
+	return s.finished
+}
+
+// Subscribers returns the number of connected stream clients.
+func (s *Server) Subscribers() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.subscribers)
+}
+
+// Close stops trade generation.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+func (s *Server) run() {
+	defer close(s.finished)
+
+	now := s.opts.StartTime
+	var id int64
+	for {
+		price, wait, ok := s.path.Next()
+		if !ok {
+			return
+		}
+
+		if s.opts.Speed > 0 && wait > 0 {
+			select {
+			case <-time.After(time.Duration(float64(wait) / s.opts.Speed)):
+			case <-s.closed:
+				return
+			}
+		}
+		now = now.Add(wait)
+		id++
+
+		t := trade{ID: id, Time: now.UnixMilli(), Price: price, Quantity: s.opts.Quantity}
+		s.mutex.Lock()
+		s.trades = append(s.trades, t)
+		subscribers := make([]*subscriber, 0, len(s.subscribers))
+		for sub := range s.subscribers {
+			subscribers = append(subscribers, sub)
+		}
+		s.mutex.Unlock()
+
+		// Block on each subscriber so scripted paths are delivered in full
+		for _, sub := range subscribers {
+			select {
+			case sub.trades <- t:
+			case <-sub.done:
+			case <-s.closed:
+				return
+			}
+		}
+	}
+}
+
+// streamSpec is one stream a client subscribed to
+type streamSpec struct {
+	name     string
+	kind     string
+	interval int64
+	candle   *candle
+}
+
+type candle struct {
+	openTime               int64
+	open, high, low, close float64
+	volume, quoteVolume    float64
+	count                  int64
+}
+
+func (s *Server) parseStream(name string) (*streamSpec, error) {
+	symbol, kind, _ := strings.Cut(name, "@")
+	if strings.ToUpper(symbol) != s.opts.Symbol {
+		return nil, fmt.Errorf("unknown symbol in stream %q", name)
+	}
+	spec := &streamSpec{name: name, kind: kind}
+	if interval, ok := strings.CutPrefix(kind, "kline_"); ok {
+		step, ok := klineIntervals[interval]
+		if !ok {
+			return nil, fmt.Errorf("unknown interval in stream %q", name)
+		}
+		spec.kind = "kline"
+		spec.interval = step.Milliseconds()
+		return spec, nil
+	}
+	if kind != "trade" && kind != "aggTrade" {
+		return nil, fmt.Errorf("unknown stream %q", name)
+	}
+	return spec, nil
+}
+
+// handleStream serves raw streams at /ws/<stream> and combined streams at
+// /stream?streams=<stream>/<stream>.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	combined := r.URL.Path == "/stream"
+	names := []string{strings.TrimPrefix(r.URL.Path, "/ws/")}
+	if combined {
+		names = strings.Split(r.URL.Query().Get("streams"), "/")
+	}
+
+	var specs []*streamSpec
+	for _, name := range names {
+		spec, err := s.parseStream(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		specs = append(specs, spec)
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Simulator upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := &subscriber{
+		trades: make(chan trade, 256),
+		done:   make(chan struct{}),
+	}
+	s.mutex.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.subscribers, sub)
+		s.mutex.Unlock()
+	}()
+
+	// Detect the client going away
+	go func() {
+		defer close(sub.done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case t := <-sub.trades:
+			for _, spec := range specs {
+				var msg interface{} = s.streamMessage(spec, t)
+				if combined {
+					msg = map[string]interface{}{"stream": spec.name, "data": msg}
+				}
+				if err := conn.WriteJSON(msg); err != nil {
+					return
+				}
+			}
+		case <-sub.done:
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// Stream events are structs rather than maps so fields keep Binance's order;
+// decoders matching keys case-insensitively rely on "t" preceding "T".
+type tradeEvent struct {
+	EventType    string `json:"e"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"`
+	TradeID      int64  `json:"t"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	TradeTime    int64  `json:"T"`
+	IsBuyerMaker bool   `json:"m"`
+	Ignore       bool   `json:"M"`
+}
+
+type aggTradeEvent struct {
+	EventType    string `json:"e"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"`
+	AggTradeID   int64  `json:"a"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	FirstID      int64  `json:"f"`
+	LastID       int64  `json:"l"`
+	TradeTime    int64  `json:"T"`
+	IsBuyerMaker bool   `json:"m"`
+	Ignore       bool   `json:"M"`
+}
+
+type klineEvent struct {
+	EventType string       `json:"e"`
+	EventTime int64        `json:"E"`
+	Symbol    string       `json:"s"`
+	Kline     klinePayload `json:"k"`
+}
+
+type klinePayload struct {
+	OpenTime            int64  `json:"t"`
+	CloseTime           int64  `json:"T"`
+	Symbol              string `json:"s"`
+	Interval            string `json:"i"`
+	Open                string `json:"o"`
+	Close               string `json:"c"`
+	High                string `json:"h"`
+	Low                 string `json:"l"`
+	Volume              string `json:"v"`
+	Trades              int64  `json:"n"`
+	Closed              bool   `json:"x"`
+	QuoteVolume         string `json:"q"`
+	TakerBuyVolume      string `json:"V"`
+	TakerBuyQuoteVolume string `json:"Q"`
+}
+
+func (s *Server) streamMessage(spec *streamSpec, t trade) interface{} {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	switch spec.kind {
+	case "kline":
+		c := spec.candle
+		if openTime := t.Time / spec.interval * spec.interval; c == nil || c.openTime != openTime {
+			c = &candle{openTime: openTime, open: t.Price, high: t.Price, low: t.Price}
+			spec.candle = c
+		}
+		if t.Price > c.high {
+			c.high = t.Price
+		}
+		if t.Price < c.low {
+			c.low = t.Price
+		}
+		c.close = t.Price
+		c.volume += t.Quantity
+		c.quoteVolume += t.Quantity * t.Price
+		c.count++
+
+		return klineEvent{
+			EventType: "kline",
+			EventTime: t.Time,
+			Symbol:    s.opts.Symbol,
+			Kline: klinePayload{
+				OpenTime:            c.openTime,
+				CloseTime:           c.openTime + spec.interval - 1,
+				Symbol:              s.opts.Symbol,
+				Interval:            strings.TrimPrefix(spec.name[strings.Index(spec.name, "@")+1:], "kline_"),
+				Open:                format(c.open),
+				Close:               format(c.close),
+				High:                format(c.high),
+				Low:                 format(c.low),
+				Volume:              format(c.volume),
+				Trades:              c.count,
+				QuoteVolume:         format(c.quoteVolume),
+				TakerBuyVolume:      format(c.volume),
+				TakerBuyQuoteVolume: format(c.quoteVolume),
+			},
+		}
+	case "aggTrade":
+		return aggTradeEvent{
+			EventType:  "aggTrade",
+			EventTime:  t.Time,
+			Symbol:     s.opts.Symbol,
+			AggTradeID: t.ID,
+			Price:      format(t.Price),
+			Quantity:   format(t.Quantity),
+			FirstID:    t.ID,
+			LastID:     t.ID,
+			TradeTime:  t.Time,
+			Ignore:     true,
+		}
+	default:
+		return tradeEvent{
+			EventType: "trade",
+			EventTime: t.Time,
+			Symbol:    s.opts.Symbol,
+			TradeID:   t.ID,
+			Price:     format(t.Price),
+			Quantity:  format(t.Quantity),
+			TradeTime: t.Time,
+			Ignore:    true,
+		}
+	}
+}
+
+func (s *Server) handleKlines(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if strings.ToUpper(query.Get("symbol")) != s.opts.Symbol {
+		writeError(w, http.StatusBadRequest, -1121, "Invalid symbol.")
+		return
+	}
+	step, ok := klineIntervals[query.Get("interval")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, -1120, "Invalid interval.")
+		return
+	}
+
+	limit := 500
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			writeError(w, http.StatusBadRequest, -1100, "Illegal characters found in parameter 'limit'.")
+			return
+		}
+		limit = n
+	}
+	startTime, _ := strconv.ParseInt(query.Get("startTime"), 10, 64)
+	endTime, _ := strconv.ParseInt(query.Get("endTime"), 10, 64)
+
+	klines := s.klines(step.Milliseconds(), startTime, endTime)
+	if len(klines) > limit {
+		if startTime != 0 {
+			klines = klines[:limit]
+		} else {
+			klines = klines[len(klines)-limit:]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(klines)
+}
+
+// klines aggregates the generated trades into rows of the klines response.
+func (s *Server) klines(step, startTime, endTime int64) [][]interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	var rows [][]interface{}
+	var open, high, low, close, volume, quoteVolume float64
+	var count int64
+	bucket := int64(-1)
+
+	flush := func() {
+		if bucket < 0 {
+			return
+		}
+		openTime := bucket * step
+		rows = append(rows, []interface{}{
+			openTime, format(open), format(high), format(low), format(close), format(volume),
+			openTime + step - 1, format(quoteVolume), count, format(volume), format(quoteVolume), "0",
+		})
+	}
+
+	for _, t := range s.trades {
+		if (startTime != 0 && t.Time < startTime) || (endTime != 0 && t.Time > endTime) {
+			continue
+		}
+		if b := t.Time / step; b != bucket {
+			flush()
+			bucket = b
+			open, high, low, volume, quoteVolume, count = t.Price, t.Price, t.Price, 0, 0, 0
+		}
+		if t.Price > high {
+			high = t.Price
+		}
+		if t.Price < low {
+			low = t.Price
+		}
+		close = t.Price
+		volume += t.Quantity
+		quoteVolume += t.Quantity * t.Price
+		count++
+	}
+	flush()
+
+	return rows
+}
+
+func writeError(w http.ResponseWriter, status int, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "msg": msg})
+}
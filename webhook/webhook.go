@@ -0,0 +1,134 @@
+// Package webhook describes the payload of outbound alert webhooks and how
+// they are signed, so receivers can verify them.
+//
+// Every request carries the headers
+//
+//	X-Alert-Timestamp: <unix seconds>
+//	X-Alert-Signature: v1=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// computed with the secret returned when the webhook was registered. The
+// signature header may hold several comma separated v1 values while a secret
+// is being rotated; a request is valid if any of them matches.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Alert-Signature"
+	TimestampHeader = "X-Alert-Timestamp"
+	DeliveryHeader  = "X-Alert-Delivery"
+
+	// Version of the payload format
+	Version = "1"
+	// EventAlertTriggered is sent when an alert's condition is met
+	EventAlertTriggered = "alert.triggered"
+
+	// DefaultTolerance is the accepted age of a request, limiting replays
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrMissingSignature = errors.New("webhook: missing signature headers")
+	ErrInvalidSignature = errors.New("webhook: signature mismatch")
+	ErrExpired          = errors.New("webhook: timestamp outside tolerance")
+)
+
+// Payload is the JSON body of every webhook request.
+type Payload struct {
+	Version    string             `json:"version"`
+	Event      string             `json:"event"`
+	DeliveryID string             `json:"delivery_id"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Alert      Alert              `json:"alert"`
+	Trigger    Trigger            `json:"trigger"`
+	Indicators map[string]float64 `json:"indicators,omitempty"`
+}
+
+type Alert struct {
+	ID        int     `json:"id"`
+	UserID    int     `json:"user_id"`
+	Symbol    string  `json:"symbol"`
+	Indicator string  `json:"indicator"`
+	Direction string  `json:"direction"`
+	Value     float64 `json:"value"`
+	Status    string  `json:"status"`
+}
+
+// Trigger is the indicator value that met the alert's condition.
+type Trigger struct {
+	Value       float64   `json:"value"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// Sign returns the hex HMAC-SHA256 signature of body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetHeaders adds the timestamp and signature headers for body to h.
+func SetHeaders(h http.Header, secret string, timestamp time.Time, body []byte) {
+	ts := timestamp.Unix()
+	h.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	h.Set(SignatureHeader, "v1="+Sign(secret, ts, body))
+}
+
+// Verify checks the signature headers of a request with the given body. A
+// tolerance of zero uses DefaultTolerance.
+func Verify(secret string, h http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	tsHeader, sigHeader := h.Get(TimestampHeader), h.Get(SignatureHeader)
+	if tsHeader == "" || sigHeader == "" {
+		return ErrMissingSignature
+	}
+
+	ts, err := strconv.ParseInt(tsHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrInvalidSignature)
+	}
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return ErrExpired
+	}
+
+	expected, _ := hex.DecodeString(Sign(secret, ts, body))
+	for _, part := range strings.Split(sigHeader, ",") {
+		version, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || version != "v1" {
+			continue
+		}
+		actual, err := hex.DecodeString(value)
+		if err == nil && hmac.Equal(actual, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// VerifyRequest reads the body of r and verifies its signature, returning
+// the body for decoding.
+func VerifyRequest(r *http.Request, secret string, tolerance time.Duration) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(secret, r.Header, body, tolerance, time.Now()); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const secret = "whsec_test"
+
+var body = []byte(`{"version":"1","event":"alert.triggered"}`)
+
+func signedHeaders(secret string, sentAt time.Time, body []byte) http.Header {
+	h := http.Header{}
+	SetHeaders(h, secret, sentAt, body)
+	return h
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1714571100, 0)
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		body      []byte
+		tolerance time.Duration
+		want      error
+	}{
+		{"valid", signedHeaders(secret, now, body), body, 0, nil},
+		{"within tolerance", signedHeaders(secret, now.Add(-4*time.Minute), body), body, 0, nil},
+		{"too old", signedHeaders(secret, now.Add(-6*time.Minute), body), body, 0, ErrExpired},
+		{"too far ahead", signedHeaders(secret, now.Add(6*time.Minute), body), body, 0, ErrExpired},
+		{"custom tolerance", signedHeaders(secret, now.Add(-6*time.Minute), body), body, 10 * time.Minute, nil},
+		{"tampered body", signedHeaders(secret, now, body), []byte(`{"version":"1","event":"alert.cancelled"}`), 0, ErrInvalidSignature},
+		{"other secret", signedHeaders("whsec_other", now, body), body, 0, ErrInvalidSignature},
+		{"missing headers", http.Header{}, body, 0, ErrMissingSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(secret, tt.header, tt.body, tt.tolerance, now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedTimestamp(t *testing.T) {
+	now := time.Unix(1714571100, 0)
+	h := signedHeaders(secret, now, body)
+	h.Set(TimestampHeader, strconv.FormatInt(now.Unix()+1, 10))
+	if err := Verify(secret, h, body, 0, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with a changed timestamp = %v, want ErrInvalidSignature", err)
+	}
+
+	h.Set(TimestampHeader, "yesterday")
+	if err := Verify(secret, h, body, 0, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with an invalid timestamp = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifySecretRotation(t *testing.T) {
+	const oldSecret, newSecret = "whsec_old", "whsec_new"
+	now := time.Unix(1714571100, 0)
+	ts := now.Unix()
+
+	h := http.Header{}
+	h.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	h.Set(SignatureHeader, "v0=ignored, v1="+Sign(oldSecret, ts, body)+", v1="+Sign(newSecret, ts, body))
+
+	for _, s := range []string{oldSecret, newSecret} {
+		if err := Verify(s, h, body, 0, now); err != nil {
+			t.Errorf("Verify() with %s = %v, want nil", s, err)
+		}
+	}
+	if err := Verify("whsec_retired", h, body, 0, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with a retired secret = %v, want ErrInvalidSignature", err)
+	}
+
+	// Only v1 signatures count
+	h.Set(SignatureHeader, "v0="+Sign(newSecret, ts, body))
+	if err := Verify(newSecret, h, body, 0, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with a v0 signature = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewReader(body))
+	SetHeaders(r.Header, secret, time.Now(), body)
+
+	got, err := VerifyRequest(r, secret, DefaultTolerance)
+	if err != nil {
+		t.Fatalf("VerifyRequest() = %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("VerifyRequest() body = %s, want %s", got, body)
+	}
+}